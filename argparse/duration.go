@@ -0,0 +1,16 @@
+package argparse
+
+import "time"
+
+var ArgDuration = argDuration{}
+
+type argDuration struct{}
+
+func (argDuration) Parse(str string) (interface{}, int, error) {
+	i := spaceEndIndex(str)
+	d, err := time.ParseDuration(str[:i])
+	if err != nil {
+		err = ErrInvalidSyntax
+	}
+	return d, i, err
+}
@@ -0,0 +1,27 @@
+package argparse_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pbtrung/scat/argparse"
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestArgDuration(t *testing.T) {
+	str := "1m30s"
+	d, n, err := argparse.ArgDuration.Parse(str)
+	assert.NoError(t, err)
+	assert.Equal(t, 90*time.Second, d)
+	assert.Equal(t, 5, n)
+
+	str = "500ms "
+	d, n, err = argparse.ArgDuration.Parse(str)
+	assert.NoError(t, err)
+	assert.Equal(t, 500*time.Millisecond, d)
+	assert.Equal(t, 5, n)
+
+	str = "1"
+	_, _, err = argparse.ArgDuration.Parse(str)
+	assert.Equal(t, argparse.ErrInvalidSyntax, err)
+}
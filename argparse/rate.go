@@ -0,0 +1,23 @@
+package argparse
+
+import "strings"
+
+// ArgRate parses a rate in bytes per second, as bytes followed by "/s" (ex:
+// 2mib/s).
+var ArgRate = argRate{}
+
+type argRate struct{}
+
+const rateSuffix = "/s"
+
+func (argRate) Parse(str string) (interface{}, int, error) {
+	i := spaceEndIndex(str)
+	if !strings.HasSuffix(str[:i], rateSuffix) {
+		return nil, 0, ErrInvalidSyntax
+	}
+	n, _, err := ArgBytes.Parse(str[:i-len(rateSuffix)])
+	if err == nil && n.(uint64) == 0 {
+		err = ErrInvalidSyntax
+	}
+	return n, i, err
+}
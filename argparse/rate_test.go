@@ -0,0 +1,27 @@
+package argparse_test
+
+import (
+	"testing"
+
+	"github.com/pbtrung/scat/argparse"
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestArgRate(t *testing.T) {
+	str := "2mib/s"
+	r, n, err := argparse.ArgRate.Parse(str)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2*1024*1024), r)
+	assert.Equal(t, 6, n)
+
+	str = "1kb/s "
+	r, n, err = argparse.ArgRate.Parse(str)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1000), r)
+	assert.Equal(t, 5, n)
+
+	for _, str := range []string{"2mib", "0b/s", "/s"} {
+		_, _, err = argparse.ArgRate.Parse(str)
+		assert.Equal(t, argparse.ErrInvalidSyntax, err, str)
+	}
+}
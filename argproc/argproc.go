@@ -1,16 +1,28 @@
 package argproc
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/pbtrung/scat"
 	ap "github.com/pbtrung/scat/argparse"
+	"github.com/pbtrung/scat/compress"
+	"github.com/pbtrung/scat/index"
+	"github.com/pbtrung/scat/journal"
 	"github.com/pbtrung/scat/procs"
+	"github.com/pbtrung/scat/ratelimit"
+	"github.com/pbtrung/scat/slots"
+	"github.com/pbtrung/scat/split"
 	"github.com/pbtrung/scat/stats"
 	"github.com/pbtrung/scat/stores"
+	"github.com/pbtrung/scat/stores/lscache"
 	"github.com/pbtrung/scat/stores/quota"
 	storestripe "github.com/pbtrung/scat/stores/stripe"
 	"github.com/pbtrung/scat/stripe"
@@ -20,7 +32,44 @@ import (
 var chainBrackets = ap.Brackets{'{', '}'}
 
 func New(tmp *tmpdedup.Dir, stats *stats.Statsd) ap.Parser {
-	argProc := builder{tmp, stats}.argProc()
+	return NewWithHeader(tmp, stats, &index.Header{Created: time.Now()})
+}
+
+// Like New(), filling hdr, written by index procs, with parameters of procs of
+// the chain as they get parsed.
+func NewWithHeader(tmp *tmpdedup.Dir, stats *stats.Statsd, hdr *index.Header,
+) ap.Parser {
+	return NewWithOptions(tmp, stats, Options{Header: hdr})
+}
+
+// Options of procs built by NewWithOptions() and NewRestoreWithOptions().
+// Zero fields are unused.
+type Options struct {
+	// filled with parameters of procs of the chain, written by index procs
+	Header *index.Header
+
+	// progress of index and stripe procs, to resume from
+	Journal *journal.Journal
+
+	// listings of stores given to stripe and multireader procs
+	LsCache *lscache.Cache
+
+	// global limit in bytes per second of transfers of stores given to stripe
+	// and multireader procs, on top of their own
+	BwLimit uint64
+
+	// registers slots of concur, backlog and adapt procs, to resize them
+	// while running
+	Slots *slots.Registry
+
+	// replaces procs of stores with stand-ins writing nothing, keeping their
+	// listings: see stores.Dry. Index and catalog outputs are discarded.
+	DryRun bool
+}
+
+func NewWithOptions(tmp *tmpdedup.Dir, stats *stats.Statsd, opts Options,
+) ap.Parser {
+	argProc := newBuilder(tmp, stats, opts).argProc()
 	return ap.ArgFilter{
 		Parser: ap.ArgPiped{Arg: argProc, Nest: chainBrackets},
 		Filter: func(val interface{}) (interface{}, error) {
@@ -37,9 +86,62 @@ func newChain(args []interface{}) (chain procs.Chain) {
 	return
 }
 
+// Returns a parser of "id=store" pairs, as found in multireader(), for
+// commands operating on stores directly rather than through a proc string.
+func NewStores(tmp *tmpdedup.Dir) ap.Parser {
+	argNamed := ap.ArgPair{
+		Left:  ap.ArgStr,
+		Right: builder{tmp: tmp}.newArgStore(),
+		Run: func(iid, istore interface{}) (interface{}, error) {
+			var (
+				id    = iid.(string)
+				store = istore.(stores.Store)
+			)
+			return stores.Named{id, store}, nil
+		},
+	}
+	return ap.ArgFilter{
+		Parser: ap.ArgVariadic{argNamed},
+		Filter: func(val interface{}) (interface{}, error) {
+			args := val.([]interface{})
+			named := make([]stores.Named, len(args))
+			for i, n := range args {
+				named[i] = n.(stores.Named)
+			}
+			return named, nil
+		},
+	}
+}
+
 type builder struct {
-	tmp   *tmpdedup.Dir
-	stats *stats.Statsd
+	tmp       *tmpdedup.Dir
+	stats     *stats.Statsd
+	idxHeader *index.Header
+	journal   *journal.Journal
+	lsCache   *lscache.Cache
+	bwLimit   *ratelimit.Limiter
+	slots     *slots.Registry
+	dryRun    bool
+}
+
+func newBuilder(tmp *tmpdedup.Dir, stats *stats.Statsd, opts Options,
+) builder {
+	b := builder{
+		tmp:       tmp,
+		stats:     stats,
+		idxHeader: opts.Header,
+		journal:   opts.Journal,
+		lsCache:   opts.LsCache,
+		slots:     opts.Slots,
+		dryRun:    opts.DryRun,
+	}
+	if opts.BwLimit > 0 {
+		b.bwLimit = ratelimit.New(opts.BwLimit)
+		if stats != nil {
+			stats.Limit = opts.BwLimit
+		}
+	}
+	return b
 }
 
 func (b builder) argProc() ap.Parser {
@@ -59,9 +161,12 @@ func (b builder) argProc() ap.Parser {
 
 	procFns := b.newArgProc(argProc, argDynProc, argStore)
 	for k, v := range argStore {
-		procFns[k] = newArgStoreProc(v, getProc)
+		procFns[k] = newArgStoreProc(v, b.getStoreProc())
 		procFns["u"+k] = newArgStoreProc(v, getUnproc)
 	}
+	// any proc, stores included
+	procFns["retry"] = newArgRetry(argProc)
+	procFns["adapt"] = b.newArgAdapt(argProc)
 	if b.stats != nil {
 		for k, v := range procFns {
 			procFns[k] = b.newArgStatsProc(v, k)
@@ -73,6 +178,63 @@ func (b builder) argProc() ap.Parser {
 	return argProc
 }
 
+func newArgRetry(argProc ap.Parser) ap.Parser {
+	return ap.ArgLambda{
+		Args: ap.Args{ap.ArgInt, ap.ArgDuration, argProc},
+		Run: func(args []interface{}) (interface{}, error) {
+			return newRetry(args[0].(int), args[1].(time.Duration),
+				args[2].(procs.Proc)), nil
+		},
+	}
+}
+
+func newRetry(n int, backoff time.Duration, proc procs.Proc) procs.Proc {
+	return procs.Retry{
+		Proc:      proc,
+		N:         n,
+		Backoff:   backoff,
+		Retryable: stores.IsTransient,
+	}
+}
+
+// Window of throughput and errors after which adaptive slots are adjusted.
+const adaptWindow = 10 * time.Second
+
+func (b builder) newArgAdapt(argProc ap.Parser) ap.Parser {
+	return ap.ArgLambda{
+		Args: ap.Args{ap.ArgInt, ap.ArgInt, argProc},
+		Run: func(args []interface{}) (interface{}, error) {
+			s, err := b.newAdaptive(args[0].(int), args[1].(int))
+			if err != nil {
+				return nil, err
+			}
+			return procs.Adaptive{Proc: args[2].(procs.Proc), Slots: s}, nil
+		},
+	}
+}
+
+func (b builder) newAdaptive(min, max int) (*slots.Adaptive, error) {
+	if min < 1 || max < min {
+		return nil, fmt.Errorf("invalid adaptive slots: %d to %d", min, max)
+	}
+	s := slots.NewAdaptive(min, max, adaptWindow)
+	b.register("adapt", s.Slots)
+	return s, nil
+}
+
+// Returns n slots, registered under kind if resizable.
+func (b builder) newSlots(kind string, n int) *slots.Slots {
+	s := slots.New(n)
+	b.register(kind, s)
+	return s
+}
+
+func (b builder) register(kind string, s *slots.Slots) {
+	if b.slots != nil {
+		b.slots.Add(kind, s)
+	}
+}
+
 func newArgStoreProc(argStore ap.Parser, getProc getProcFn) ap.Parser {
 	return ap.ArgFilter{
 		Parser: argStore,
@@ -111,17 +273,44 @@ func (b builder) newArgProc(argProc, argDynp, argStore ap.Parser) ap.ArgFn {
 				var (
 					path = args[0].(string)
 				)
-				w, err := openOut(path)
-				return procs.NewIndexProc(w), err
+				w, err := b.openBackupOut(path)
+				return procs.NewIndexProcJournal(w, b.idxHeader, b.journal), err
+			},
+		},
+		"catalog": ap.ArgLambda{
+			Args: ap.Args{ap.ArgStr},
+			Run: func(args []interface{}) (interface{}, error) {
+				var (
+					path = args[0].(string)
+				)
+				w, err := b.openBackupOut(path)
+				return procs.NewCatalog(w), err
 			},
 		},
 		"uindex": ap.ArgLambda{
-			Run: func([]interface{}) (interface{}, error) {
-				return procs.IndexUnproc, nil
+			Args: ap.ArgVariadic{ap.ArgBytes},
+			Run: func(args []interface{}) (interface{}, error) {
+				switch len(args) {
+				case 0:
+					return procs.IndexUnproc, nil
+				case 1:
+					return nil, ap.ErrTooFewArgs
+				case 2:
+				default:
+					return nil, ap.ErrTooManyArgs
+				}
+				var (
+					offset = args[0].(uint64)
+					length = args[1].(uint64)
+				)
+				return procs.NewIndexUnprocRange(int64(offset), int64(length)), nil
 			},
 		},
 		"split": ap.ArgLambda{
 			Run: func([]interface{}) (interface{}, error) {
+				b.setHeader(func(h *index.Header) {
+					h.SplitMin, h.SplitMax = split.DefaultMin, split.DefaultMax
+				})
 				return procs.Split, nil
 			},
 		},
@@ -132,6 +321,9 @@ func (b builder) newArgProc(argProc, argDynp, argStore ap.Parser) ap.ArgFn {
 					min = uintBytes(args[0])
 					max = uintBytes(args[1])
 				)
+				b.setHeader(func(h *index.Header) {
+					h.SplitMin, h.SplitMax = min, max
+				})
 				return procs.NewSplitSize(min, max), nil
 			},
 		},
@@ -142,7 +334,8 @@ func (b builder) newArgProc(argProc, argDynp, argStore ap.Parser) ap.ArgFn {
 					nslots = args[0].(int)
 					proc   = args[1].(procs.Proc)
 				)
-				return procs.NewBacklog(nslots, proc), nil
+				s := b.newSlots("backlog", nslots)
+				return procs.NewBacklogSlots(s, proc), nil
 			},
 		},
 		"concur": ap.ArgLambda{
@@ -152,11 +345,12 @@ func (b builder) newArgProc(argProc, argDynp, argStore ap.Parser) ap.ArgFn {
 					max  = args[0].(int)
 					dynp = args[1].(procs.DynProcer)
 				)
-				return procs.NewConcur(max, dynp), nil
+				s := b.newSlots("concur", max)
+				return procs.NewConcurSlots(s, dynp), nil
 			},
 		},
 		"multireader": ap.ArgLambda{
-			Args: ap.ArgVariadic{b.newArgCopier(argStore, getUnproc)},
+			Args: ap.ArgVariadic{b.newArgReadCopier(argStore)},
 			Run: func(args []interface{}) (interface{}, error) {
 				copiers := make([]stores.Copier, len(args))
 				for i, icp := range args {
@@ -165,10 +359,19 @@ func (b builder) newArgProc(argProc, argDynp, argStore ap.Parser) ap.ArgFn {
 				return stores.NewMultiReader(copiers)
 			},
 		},
-		"parity":  newArgParity(getProc),
-		"uparity": newArgParity(getUnproc),
-		"gzip":    newArgGzip(getProc),
-		"ugzip":   newArgGzip(getUnproc),
+		"parity":      b.newArgParity(getProc, true),
+		"uparity":     b.newArgParity(getUnproc, false),
+		"gzip":        b.newArgCompress(compress.Gzip, getProc, true),
+		"ugzip":       b.newArgCompress(compress.Gzip, getUnproc, false),
+		"zstd":        b.newArgCompress(compress.Zstd, getProc, true),
+		"uzstd":       b.newArgCompress(compress.Zstd, getUnproc, false),
+		"lz4":         b.newArgCompress(compress.Lz4, getProc, true),
+		"ulz4":        b.newArgCompress(compress.Lz4, getUnproc, false),
+		"xz":          b.newArgCompress(compress.Xz, getProc, true),
+		"uxz":         b.newArgCompress(compress.Xz, getUnproc, false),
+		"udecompress": newArgDecompress(),
+		"encrypt":     newArgEncrypt(getProc),
+		"uencrypt":    newArgEncrypt(getUnproc),
 		"sort": ap.ArgLambda{
 			Run: func([]interface{}) (interface{}, error) {
 				return &procs.Sort{}, nil
@@ -203,6 +406,14 @@ func (b builder) newArgProc(argProc, argDynp, argStore ap.Parser) ap.ArgFn {
 				return procs.NewGroup(size), nil
 			},
 		},
+		// Unproc only used by restore chains derived from backup ones: see
+		// NewRestore()
+		"reversible": ap.ArgLambda{
+			Args: ap.Args{argProc, argProc},
+			Run: func(args []interface{}) (interface{}, error) {
+				return args[0], nil
+			},
+		},
 		"cmd": newArgCmdProc(func(fn procs.CmdFunc) procs.Proc {
 			return fn
 		}),
@@ -216,7 +427,8 @@ func (b builder) newArgProc(argProc, argDynp, argStore ap.Parser) ap.ArgFn {
 }
 
 func (b builder) newArgDynProc(argStore ap.Parser) ap.ArgFn {
-	newS := func(min, excl int, iress []interface{}) (procs.DynProcer, error) {
+	newS := func(sopts stripeOpts, min, excl int, iress []interface{},
+	) (procs.DynProcer, error) {
 		qman := quota.NewMan()
 		if b.stats != nil {
 			qman.OnUse = func(res quota.Res, use, max uint64) {
@@ -225,42 +437,63 @@ func (b builder) newArgDynProc(argStore ap.Parser) ap.ArgFn {
 				cnt.Quota.Max = max
 			}
 		}
-		for _, ires := range iress {
+		ress := make([]quotaRes, len(iress))
+		for i, ires := range iress {
 			res := ires.(quotaRes)
 			qman.AddResQuota(res.copier, res.max)
+			ress[i] = res
+		}
+		domains, err := sopts.stripeDomains(ress)
+		if err != nil {
+			return nil, err
 		}
-		cfg := stripe.Config{Min: min, Excl: excl}
-		return storestripe.New(cfg, qman)
+		cfg := stripe.Config{Min: min, Excl: excl, Domains: domains}
+		opts := storestripe.Options{Journal: b.journal}
+		if sopts.newPolicy != nil {
+			opts.Policy = sopts.newPolicy(qman)
+		}
+		if b.stats != nil {
+			opts.OnDedup = b.stats.AddDedup
+			opts.OnCopy = b.stats.AddCopy
+			opts.OnPresent = b.stats.AddPresent
+		}
+		return storestripe.NewWithOptions(cfg, qman, opts)
 	}
-	argQuota := b.newArgQuota(b.newArgCopier(argStore, getProc))
+	argCopier := b.newArgCopier(argStore, b.getStoreProc(), true)
+	argQuota := b.newArgQuota(argCopier)
+	argStripeOpts := newArgStripeOpts()
 	return ap.ArgFn{
 		"mincopies": ap.ArgLambda{
 			Args: ap.Args{
+				argStripeOpts,
 				ap.ArgInt,
 				ap.ArgVariadic{argQuota},
 			},
 			Run: func(args []interface{}) (interface{}, error) {
 				const excl = 0
 				var (
-					min   = args[0].(int)
-					iress = args[1].([]interface{})
+					sopts = args[0].(stripeOpts)
+					min   = args[1].(int)
+					iress = args[2].([]interface{})
 				)
-				return newS(min, excl, iress)
+				return newS(sopts, min, excl, iress)
 			},
 		},
 		"stripe": ap.ArgLambda{
 			Args: ap.Args{
+				argStripeOpts,
 				ap.ArgInt,
 				ap.ArgInt,
 				ap.ArgVariadic{argQuota},
 			},
 			Run: func(args []interface{}) (interface{}, error) {
 				var (
-					min   = args[0].(int)
-					excl  = args[1].(int)
-					iress = args[2].([]interface{})
+					sopts = args[0].(stripeOpts)
+					min   = args[1].(int)
+					excl  = args[2].(int)
+					iress = args[3].([]interface{})
 				)
-				return newS(min, excl, iress)
+				return newS(sopts, min, excl, iress)
 			},
 		},
 	}
@@ -278,7 +511,7 @@ func (b builder) newArgStore() ap.ArgFn {
 		}
 		return stores.Dir{path, part}
 	}
-	return ap.ArgFn{
+	fns := ap.ArgFn{
 		"rclone": ap.ArgLambda{
 			Args: ap.Args{ap.ArgStr},
 			Run: func(args []interface{}) (interface{}, error) {
@@ -307,22 +540,94 @@ func (b builder) newArgStore() ap.ArgFn {
 				return stores.NewScp(host, dir), nil
 			},
 		},
+		"sftp": ap.ArgLambda{
+			Args: ap.Args{ap.ArgStr, ap.ArgStr, ap.ArgVariadic{ap.ArgInt}},
+			Run: func(args []interface{}) (interface{}, error) {
+				var (
+					host = args[0].(string)
+					dir  = newDir(args[1:])
+				)
+				return stores.NewSftp(host, dir), nil
+			},
+		},
+		"webdav": ap.ArgLambda{
+			Args: ap.Args{ap.ArgStr, ap.ArgVariadic{ap.ArgInt}},
+			Run: func(args []interface{}) (interface{}, error) {
+				dir := newDir(args)
+				return stores.NewWebdav(dir.Path, dir.Part)
+			},
+		},
+		"s3": ap.ArgLambda{
+			Args: ap.Args{ap.ArgStr, ap.ArgStr, ap.ArgVariadic{ap.ArgStr}},
+			Run: func(args []interface{}) (interface{}, error) {
+				var (
+					endpoint = args[0].(string)
+					bucket   = args[1].(string)
+					iprefix  = args[2].([]interface{})
+				)
+				prefix := ""
+				switch len(iprefix) {
+				case 0:
+				case 1:
+					prefix = iprefix[0].(string)
+				default:
+					return nil, ap.ErrTooManyArgs
+				}
+				return stores.NewS3(endpoint, bucket, prefix), nil
+			},
+		},
+	}
+	fns["retry"] = ap.ArgLambda{
+		Args: ap.Args{ap.ArgInt, ap.ArgDuration, fns},
+		Run: func(args []interface{}) (interface{}, error) {
+			return stores.NewRetry(
+				args[2].(stores.Store),
+				args[0].(int),
+				args[1].(time.Duration),
+			), nil
+		},
+	}
+	fns["adapt"] = ap.ArgLambda{
+		Args: ap.Args{ap.ArgInt, ap.ArgInt, fns},
+		Run: func(args []interface{}) (interface{}, error) {
+			s, err := b.newAdaptive(args[0].(int), args[1].(int))
+			if err != nil {
+				return nil, err
+			}
+			return stores.NewAdaptive(args[2].(stores.Store), s), nil
+		},
 	}
+	return fns
 }
 
-func (b builder) newArgCopier(argStore ap.Parser, getProc getProcFn) ap.Parser {
+// Copies written by procs of copiers get recorded to the listing cache if
+// write is set, unless in a dry run.
+func (b builder) newArgCopier(argStore ap.Parser, getProc getProcFn,
+	write bool,
+) ap.Parser {
 	return ap.ArgPair{
 		Left:  ap.ArgStr,
-		Right: argStore,
-		Run: func(iid, istore interface{}) (interface{}, error) {
+		Right: argStoreDef{argStore},
+		Run: func(iid, idef interface{}) (interface{}, error) {
 			var (
 				id    = iid.(string)
-				store = istore.(stores.Store)
+				def   = idef.(storeDef)
+				store = def.store
 			)
 			var (
 				lser stores.Lister = store
 				proc procs.Proc    = getProc(store)
 			)
+			if b.lsCache != nil {
+				st := lscache.Store{Id: id, Def: def.str}
+				lser = b.lsCache.Lister(st, lser)
+				if write && !b.dryRun {
+					proc = b.lsCache.Proc(st, proc)
+				}
+			}
+			if b.bwLimit != nil {
+				proc = ratelimit.Proc{proc, ratelimit.Limiters{b.bwLimit}}
+			}
 			if b.stats != nil {
 				lser = quotaInitReport{
 					lser:       lser,
@@ -335,28 +640,163 @@ func (b builder) newArgCopier(argStore ap.Parser, getProc getProcFn) ap.Parser {
 	}
 }
 
-func (b builder) newArgQuota(argCopier ap.Parser) ap.Parser {
-	argQuotaMax := ap.ArgPair{
-		Left:  argCopier,
-		Right: ap.ArgBytes,
-		Run: func(icp, ibytes interface{}) (interface{}, error) {
-			qr := quotaRes{
-				copier: icp.(stores.Copier),
-				max:    ibytes.(uint64),
-			}
-			return qr, nil
+// Parses a store along with the string defining it.
+type argStoreDef struct {
+	store ap.Parser
+}
+
+type storeDef struct {
+	store stores.Store
+	str   string
+}
+
+func (arg argStoreDef) Parse(str string) (interface{}, int, error) {
+	store, n, err := arg.store.Parse(str)
+	if err != nil {
+		return nil, n, err
+	}
+	return storeDef{store.(stores.Store), str[:n]}, n, nil
+}
+
+// Like newArgCopier() for reading, ignoring any quota so that the same store
+// list may be given to multireader() and stripe().
+func (b builder) newArgReadCopier(argStore ap.Parser) ap.Parser {
+	return ap.ArgFilter{
+		Parser: argCopierQuota{b.newArgCopier(argStore, getUnproc, false)},
+		Filter: func(val interface{}) (interface{}, error) {
+			cq := val.(copierQuota)
+			return b.limitCopier(cq.copier, cq.rate), nil
 		},
 	}
+}
+
+// Parses a copier optionally followed by "=" and the right-hand side parsed
+// by argQuotaRate, then by labels parsed by argLabels. Unlike ap.ArgOr of all
+// forms, the copier is parsed once, so that side effects of parsing stores
+// (ex: registering slots) happen once.
+type argCopierQuota struct {
+	copier ap.Parser
+}
+
+type copierQuota struct {
+	copier stores.Copier
+	quotaRate
+	labels map[string]string
+}
+
+func (arg argCopierQuota) Parse(str string) (interface{}, int, error) {
+	icp, n, err := arg.copier.Parse(str)
+	if err != nil {
+		return nil, n, err
+	}
+	res := copierQuota{
+		copier:    icp.(stores.Copier),
+		quotaRate: quotaRate{max: quota.Unlimited},
+	}
+	if n < len(str) && str[n] == '=' {
+		n++
+		iqr, m, err := argQuotaRate{}.Parse(str[n:])
+		n += m
+		if err != nil {
+			return nil, n, ap.ErrDetails{err, str, n}
+		}
+		res.quotaRate = iqr.(quotaRate)
+	}
+	if n < len(str) && rune(str[n]) == labelsBrackets.Open {
+		ilabels, m, err := argLabels{}.Parse(str[n:])
+		n += m
+		if err != nil {
+			return nil, n, ap.ErrDetails{err, str, n}
+		}
+		res.labels = ilabels.(map[string]string)
+	}
+	return res, n, nil
+}
+
+var labelsBrackets = ap.Brackets{'[', ']'}
+
+// Parses "[name=value,...]" labels of copiers, ex: [provider=google,site=home].
+type argLabels struct{}
+
+func (argLabels) Parse(str string) (interface{}, int, error) {
+	end := strings.IndexRune(str, labelsBrackets.Close)
+	if end == -1 {
+		return nil, 0, ap.ErrUnclosedBracket
+	}
+	labels := map[string]string{}
+	for _, kv := range strings.Split(str[1:end], ",") {
+		i := strings.Index(kv, "=")
+		if i < 1 {
+			return nil, 1, fmt.Errorf("invalid label: %q", kv)
+		}
+		labels[kv[:i]] = kv[i+1:]
+	}
+	return labels, end + 1, nil
+}
+
+// Limits transfers of cp to rate bytes per second, unless 0.
+func (b builder) limitCopier(cp stores.Copier, rate uint64) stores.Copier {
+	if rate == 0 {
+		return cp
+	}
+	lim := ratelimit.New(rate)
+	cp.Proc = ratelimit.Proc{cp.Proc, ratelimit.Limiters{lim}}
+	if b.stats != nil {
+		b.stats.Counter(cp.Id()).Limit = rate
+	}
+	return cp
+}
+
+// Parses the "quota", "quota@rate" or "@rate" right-hand side of copiers: see
+// ap.ArgBytes and ap.ArgRate.
+type argQuotaRate struct{}
+
+type quotaRate struct {
+	max  uint64 // quota.Unlimited if none
+	rate uint64 // 0 if none
+}
+
+const rateSep = "@"
+
+func (argQuotaRate) Parse(str string) (interface{}, int, error) {
+	n := strings.IndexFunc(str, func(r rune) bool {
+		return unicode.IsSpace(r) || r == labelsBrackets.Open
+	})
+	if n == -1 {
+		n = len(str)
+	}
+	qr := quotaRate{max: quota.Unlimited}
+	qstr, rstr := str[:n], ""
+	if i := strings.Index(qstr, rateSep); i != -1 {
+		qstr, rstr = qstr[:i], qstr[i+len(rateSep):]
+		rate, _, err := ap.ArgRate.Parse(rstr)
+		if err != nil {
+			return nil, 0, ap.ErrDetails{err, str, i + len(rateSep)}
+		}
+		qr.rate = rate.(uint64)
+		if qstr == "" {
+			return qr, n, nil
+		}
+	}
+	max, _, err := ap.ArgBytes.Parse(qstr)
+	if err != nil {
+		return nil, 0, err
+	}
+	qr.max = max.(uint64)
+	return qr, n, nil
+}
+
+func (b builder) newArgQuota(argCopier ap.Parser) ap.Parser {
 	argRes := ap.ArgFilter{
-		Parser: ap.ArgOr{argQuotaMax, argCopier},
+		Parser: argCopierQuota{argCopier},
 		Filter: func(val interface{}) (interface{}, error) {
-			if cp, ok := val.(stores.Copier); ok {
-				val = quotaRes{
-					copier: cp,
-					max:    quota.Unlimited,
-				}
+			cq := val.(copierQuota)
+			res := quotaRes{
+				copier: b.limitCopier(cq.copier, cq.rate),
+				max:    cq.max,
+				labels: cq.labels,
 			}
-			return val, nil
+			return res, nil
 		},
 	}
 	if b.stats == nil {
@@ -387,7 +827,13 @@ func (r quotaInitReport) Ls() ([]stores.LsEntry, error) {
 	return r.lser.Ls()
 }
 
-func newArgParity(getProc getProcFn) ap.Parser {
+func (b builder) setHeader(fn func(*index.Header)) {
+	if b.idxHeader != nil {
+		fn(b.idxHeader)
+	}
+}
+
+func (b builder) newArgParity(getProc getProcFn, track bool) ap.Parser {
 	return ap.ArgLambda{
 		Args: ap.Args{ap.ArgInt, ap.ArgInt},
 		Run: func(args []interface{}) (interface{}, error) {
@@ -399,15 +845,93 @@ func newArgParity(getProc getProcFn) ap.Parser {
 			if err != nil {
 				return nil, err
 			}
+			if track {
+				b.setHeader(func(h *index.Header) {
+					h.NData, h.NParity = ndata, nparity
+				})
+			}
 			return getProc(parity), nil
 		},
 	}
 }
 
-func newArgGzip(getProc getProcFn) ap.Parser {
+func (b builder) newArgCompress(codec compress.Codec, getProc getProcFn,
+	track bool,
+) ap.Parser {
+	return ap.ArgLambda{
+		Args: ap.ArgVariadic{ap.ArgInt},
+		Run: func(args []interface{}) (interface{}, error) {
+			level := compress.DefaultLevel
+			switch len(args) {
+			case 0:
+			case 1:
+				level = args[0].(int)
+			default:
+				return nil, ap.ErrTooManyArgs
+			}
+			comp, err := procs.NewCompress(codec, level)
+			if err != nil {
+				return nil, err
+			}
+			if track {
+				b.setHeader(func(h *index.Header) {
+					h.Compress = codec.String()
+				})
+			}
+			return getProc(comp), nil
+		},
+	}
+}
+
+// Decompression takes no level: any codec is told by its frame header.
+func newArgDecompress() ap.Parser {
 	return ap.ArgLambda{
 		Run: func([]interface{}) (interface{}, error) {
-			return getProc(procs.Gzip{}), nil
+			return procs.Decompress, nil
+		},
+	}
+}
+
+func newArgEncrypt(getProc getProcFn) ap.Parser {
+	argKey := ap.ArgFn{
+		"keyfile": ap.ArgLambda{
+			Args: ap.Args{ap.ArgStr},
+			Run: func(args []interface{}) (interface{}, error) {
+				var (
+					path = args[0].(string)
+				)
+				b, err := ioutil.ReadFile(path)
+				if err != nil {
+					return nil, err
+				}
+				return procs.EncryptFileKey(b), nil
+			},
+		},
+		"passfile": ap.ArgLambda{
+			Args: ap.Args{ap.ArgStr},
+			Run: func(args []interface{}) (interface{}, error) {
+				var (
+					path = args[0].(string)
+				)
+				b, err := ioutil.ReadFile(path)
+				if err != nil {
+					return nil, err
+				}
+				return procs.EncryptPassKey(bytes.TrimRight(b, "\r\n"))
+			},
+		},
+	}
+	return ap.ArgLambda{
+		Args: ap.Args{argKey},
+		Run: func(args []interface{}) (interface{}, error) {
+			var (
+				key = args[0].([]byte)
+			)
+			enc, err := procs.NewEncrypt(key)
+			if err != nil {
+				return nil, err
+			}
+			return getProc(enc), nil
 		},
 	}
 }
@@ -443,9 +967,21 @@ func getUnproc(p procs.ProcUnprocer) procs.Proc {
 	return p.Unproc()
 }
 
+func getDryProc(procs.ProcUnprocer) procs.Proc {
+	return stores.NewDry().Proc()
+}
+
+func (b builder) getStoreProc() getProcFn {
+	if b.dryRun {
+		return getDryProc
+	}
+	return getProc
+}
+
 type quotaRes struct {
 	max    uint64
 	copier stores.Copier
+	labels map[string]string
 }
 
 func uintBytes(val interface{}) uint {
@@ -464,6 +1000,15 @@ func openOut(path string) (io.WriteCloser, error) {
 	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 }
 
+// Like openOut(), discarding writes in dry runs: indexes and catalogs would
+// reference chunks not stored.
+func (b builder) openBackupOut(path string) (io.WriteCloser, error) {
+	if b.dryRun {
+		return nopWriteCloser{ioutil.Discard}, nil
+	}
+	return openOut(path)
+}
+
 type nopWriteCloser struct {
 	io.Writer
 }
@@ -1,12 +1,250 @@
 package argproc_test
 
 import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/pbtrung/scat"
 	"github.com/pbtrung/scat/argproc"
+	"github.com/pbtrung/scat/procs"
+	"github.com/pbtrung/scat/slots"
+	"github.com/pbtrung/scat/stores/lscache"
+	assert "github.com/stretchr/testify/require"
 )
 
 func TestNew(t *testing.T) {
 	// just test that it compiles
 	argproc.New(nil, nil)
 }
+
+func TestDecompress(t *testing.T) {
+	parser := argproc.New(nil, nil)
+	_, _, err := parser.Parse("udecompress")
+	assert.NoError(t, err)
+	_, _, err = parser.Parse("udecompress(3)")
+	assert.Error(t, err)
+	_, _, err = parser.Parse("zstd(3)")
+	assert.NoError(t, err)
+}
+
+func TestMultireaderQuota(t *testing.T) {
+	// quotas are accepted and ignored, as in stripe()
+	_, _, err := argproc.New(nil, nil).Parse("multireader(a=cp(/tmp)=1gib)")
+	assert.NoError(t, err)
+}
+
+func TestRetry(t *testing.T) {
+	parser := argproc.New(nil, nil)
+	res, _, err := parser.Parse("retry(2 10ms cmd cat)")
+	assert.NoError(t, err)
+	assert.IsType(t, procs.Retry{}, res.(procs.Chain)[0])
+
+	// stores
+	_, _, err = parser.Parse("concur 2 stripe(1 1 a=retry(2 1s cp(/tmp))=1gib)")
+	assert.NoError(t, err)
+	_, _, err = parser.Parse("retry(2 1s cp(/tmp))")
+	assert.NoError(t, err)
+
+	_, _, err = parser.Parse("retry(2 1 cmd cat)")
+	assert.Error(t, err)
+}
+
+func TestBwLimit(t *testing.T) {
+	parser := argproc.NewWithOptions(nil, nil, argproc.Options{BwLimit: 1024})
+	_, _, err := parser.Parse("concur 2 stripe(1 1 " +
+		"a=cp(/tmp)=1gib@2mib/s b=cp(/tmp)=@1mib/s c=cp(/tmp))")
+	assert.NoError(t, err)
+	_, _, err = parser.Parse("multireader(a=cp(/tmp)=1gib@2mib/s)")
+	assert.NoError(t, err)
+
+	// rate required after separator, per second
+	_, _, err = parser.Parse("multireader(a=cp(/tmp)@)")
+	assert.Error(t, err)
+	_, _, err = parser.Parse("multireader(a=cp(/tmp)@2mib)")
+	assert.Error(t, err)
+}
+
+func TestSlots(t *testing.T) {
+	reg := slots.NewRegistry()
+	parser := argproc.NewWithOptions(nil, nil, argproc.Options{Slots: reg})
+	_, _, err := parser.Parse("backlog 2 { concur 4 stripe(1 1 " +
+		"a=adapt(1 4 cp(/tmp)) b=cp(/tmp)) | adapt(1 2 cmd cat) }")
+	assert.NoError(t, err)
+	// stores parsed once, inner procs first
+	assert.Equal(t, []string{"adapt1", "concur1", "adapt2", "backlog1"},
+		reg.Names())
+	assert.Equal(t, 4, reg.Get("concur1").Cap())
+	assert.Equal(t, 1, reg.Get("adapt1").Cap())
+
+	// registry optional
+	_, _, err = argproc.New(nil, nil).Parse("concur 2 stripe(1 1 " +
+		"a=adapt(1 4 cp(/tmp)))")
+	assert.NoError(t, err)
+
+	_, _, err = parser.Parse("adapt(2 1 cmd cat)")
+	assert.Error(t, err)
+	_, _, err = parser.Parse("multireader(a=cp(/tmp)@1mib/s)")
+	assert.Error(t, err)
+}
+
+func TestDryRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	parser := argproc.NewWithOptions(nil, nil, argproc.Options{DryRun: true})
+	res, _, err := parser.Parse("checksum | concur 2 stripe(1 0 " +
+		"a=cp(" + dir + ") b=cp(" + dir + "))")
+	assert.NoError(t, err)
+	proc := res.(procs.Proc)
+	err = procs.Process(proc, scat.NewChunk(0, scat.BytesData("abc")))
+	assert.NoError(t, err)
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(files))
+}
+
+func TestDryRunIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	idxPath := filepath.Join(dir, "idx")
+	catPath := filepath.Join(dir, "cat")
+	for _, path := range []string{idxPath, catPath} {
+		assert.NoError(t, ioutil.WriteFile(path, []byte("keep"), 0644))
+	}
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "a", Mode: 0600, Size: 3}))
+	_, err = tw.Write([]byte("aaa"))
+	assert.NoError(t, err)
+	assert.NoError(t, tw.Close())
+
+	parser := argproc.NewWithOptions(nil, nil, argproc.Options{DryRun: true})
+	res, _, err := parser.Parse(fmt.Sprintf(
+		"catalog %s | split | backlog 2 { checksum | index %s"+
+			" | group 1 | concur 2 stripe(1 0 a=cp(%s)) }",
+		catPath, idxPath, dir,
+	))
+	assert.NoError(t, err)
+	proc := res.(procs.Proc)
+	err = procs.Process(proc, scat.NewChunk(0, scat.BytesData(buf.Bytes())))
+	assert.NoError(t, err)
+
+	// outputs referencing chunks not stored left untouched
+	for _, path := range []string{idxPath, catPath} {
+		b, err := ioutil.ReadFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, "keep", string(b), path)
+	}
+}
+
+func TestDryRunLsCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	storeDir := filepath.Join(dir, "store")
+	assert.NoError(t, os.Mkdir(storeDir, 0755))
+	cache, err := lscache.Open(filepath.Join(dir, "cache"), time.Hour)
+	assert.NoError(t, err)
+	defer cache.Close()
+	str := "checksum | concur 2 stripe(1 0 a=cp(" + storeDir + "))"
+	run := func(dryRun bool) {
+		parser := argproc.NewWithOptions(nil, nil, argproc.Options{
+			LsCache: cache,
+			DryRun:  dryRun,
+		})
+		res, _, err := parser.Parse(str)
+		assert.NoError(t, err)
+		err = procs.Process(res.(procs.Proc),
+			scat.NewChunk(0, scat.BytesData("abc")))
+		assert.NoError(t, err)
+	}
+
+	// dry run: copies planned but not recorded as stored
+	run(true)
+	files, err := ioutil.ReadDir(storeDir)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(files))
+
+	// real run on the same cache: copies written
+	run(false)
+	files, err = ioutil.ReadDir(storeDir)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(files))
+}
+
+func TestPolicy(t *testing.T) {
+	parser := argproc.New(nil, nil)
+	for _, str := range []string{
+		"stripe(quota 1 1 a=cp(/tmp) b=cp(/tmp))",
+		"stripe(rate() 1 1 a=cp(/tmp) b=cp(/tmp))",
+		"stripe(local(b) 2 1 a=cp(/tmp) b=cp(/tmp))",
+		"stripe(cost(a=0.02/0.09 b=0.005) 1 0 a=cp(/tmp) b=cp(/tmp))",
+		"mincopies(local(a) 2 a=cp(/tmp) b=cp(/tmp))",
+	} {
+		_, _, err := parser.Parse("concur 2 " + str)
+		assert.NoError(t, err, str)
+	}
+	for _, str := range []string{
+		"stripe(foo 1 1 a=cp(/tmp))",
+		"stripe(local() 1 1 a=cp(/tmp))",
+		"stripe(local(b) 1 1 a=cp(/tmp))",
+		"stripe(cost(a=x) 1 1 a=cp(/tmp))",
+		"stripe(cost(a=1) 1 1 a=cp(/tmp) b=cp(/tmp))",
+	} {
+		_, _, err := parser.Parse("concur 2 " + str)
+		assert.Error(t, err, str)
+	}
+}
+
+func TestDomains(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	ids := []string{"a1", "a2", "b"}
+	for _, id := range ids {
+		assert.NoError(t, os.Mkdir(filepath.Join(dir, id), 0755))
+	}
+	parser := argproc.New(nil, nil)
+	res, _, err := parser.Parse(fmt.Sprintf("checksum | concur 2 stripe("+
+		"distinct(provider 2) 2 0"+
+		" a1=cp(%[1]s/a1)[provider=x,site=home]"+
+		" a2=cp(%[1]s/a2)=1gib@1mib/s[provider=x]"+
+		" b=cp(%[1]s/b)=@1mib/s[provider=y])", dir))
+	assert.NoError(t, err)
+	for i := 0; i < 4; i++ {
+		data := scat.BytesData(fmt.Sprint(i))
+		err = procs.Process(res.(procs.Proc), scat.NewChunk(i, data))
+		assert.NoError(t, err)
+	}
+	counts := map[string]int{}
+	for _, id := range ids {
+		files, err := ioutil.ReadDir(filepath.Join(dir, id))
+		assert.NoError(t, err)
+		counts[id] = len(files)
+	}
+	assert.Equal(t, 4, counts["b"])
+	assert.Equal(t, 4, counts["a1"]+counts["a2"])
+
+	// along a policy
+	_, _, err = parser.Parse("concur 2 stripe(cost(a=1 b=2) distinct(site 2)" +
+		" 1 0 a=cp(/tmp)[site=x] b=cp(/tmp)=1gib[site=y])")
+	assert.NoError(t, err)
+
+	for _, str := range []string{
+		"stripe(distinct(site 2) 1 0 a=cp(/tmp)[provider=x])",
+		"stripe(distinct(site 0) 1 0 a=cp(/tmp)[site=x])",
+		"stripe(1 0 a=cp(/tmp)[site])",
+		"stripe(1 0 a=cp(/tmp)[site=x)",
+		"stripe(quota rate 1 0 a=cp(/tmp))",
+	} {
+		_, _, err := parser.Parse("concur 2 " + str)
+		assert.Error(t, err, str)
+	}
+}
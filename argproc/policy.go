@@ -0,0 +1,203 @@
+package argproc
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	ap "github.com/pbtrung/scat/argparse"
+	"github.com/pbtrung/scat/stores/quota"
+	storestripe "github.com/pbtrung/scat/stores/stripe"
+	"github.com/pbtrung/scat/stripe"
+)
+
+// Returns the striping policy of copiers sharing qman.
+type newPolicyFn func(qman *quota.Man) storestripe.Policy
+
+// Options of stripe procs leading their args, before min copies: a policy
+// and failure domains, each a name with or without args.
+type stripeOpts struct {
+	newPolicy newPolicyFn // nil for round-robin
+	domains   []labelDomain
+}
+
+// Copies on at least min distinct values of label: see stripe.Domain.
+type labelDomain struct {
+	label string
+	min   int
+}
+
+// Parses stripeOpts: see storestripe.Policy and stripe.Domain.
+type argStripeOpts map[string]ap.Parser
+
+func newArgStripeOpts() argStripeOpts {
+	return argStripeOpts{
+		"distinct": ap.ArgLambda{
+			Args: ap.Args{ap.ArgStr, ap.ArgInt},
+			Run: func(args []interface{}) (interface{}, error) {
+				d := labelDomain{label: args[0].(string), min: args[1].(int)}
+				if d.min < 1 {
+					return nil, fmt.Errorf("invalid min values: %d", d.min)
+				}
+				return d, nil
+			},
+		},
+		"quota": ap.ArgLambda{
+			Run: func([]interface{}) (interface{}, error) {
+				return newPolicyFn(func(qman *quota.Man) storestripe.Policy {
+					return storestripe.QuotaWeighted{Qman: qman}
+				}), nil
+			},
+		},
+		"rate": ap.ArgLambda{
+			Run: func([]interface{}) (interface{}, error) {
+				return newPolicyFn(func(*quota.Man) storestripe.Policy {
+					return storestripe.NewRateWeighted()
+				}), nil
+			},
+		},
+		"local": ap.ArgLambda{
+			Args: ap.ArgVariadic{ap.ArgStr},
+			Run: func(args []interface{}) (interface{}, error) {
+				if len(args) == 0 {
+					return nil, ap.ErrTooFewArgs
+				}
+				return newPolicyFn(func(*quota.Man) storestripe.Policy {
+					return &storestripe.Local{Ids: args}
+				}), nil
+			},
+		},
+		"cost": ap.ArgLambda{
+			Args: ap.ArgVariadic{ap.ArgPair{
+				Left:  ap.ArgStr,
+				Right: argPrice{},
+				Run: func(id, price interface{}) (interface{}, error) {
+					return idPrice{id, price.(storestripe.Price)}, nil
+				},
+			}},
+			Run: func(args []interface{}) (interface{}, error) {
+				if len(args) == 0 {
+					return nil, ap.ErrTooFewArgs
+				}
+				prices := make(map[interface{}]storestripe.Price, len(args))
+				for _, arg := range args {
+					p := arg.(idPrice)
+					prices[p.id] = p.price
+				}
+				return newPolicyFn(func(*quota.Man) storestripe.Policy {
+					return &storestripe.Cost{Prices: prices}
+				}), nil
+			},
+		},
+	}
+}
+
+func (arg argStripeOpts) Parse(str string) (interface{}, int, error) {
+	opts := stripeOpts{}
+	pos := 0
+	for {
+		pos += countLeftSpaces(str[pos:])
+		val, n, err := arg.parseOne(str[pos:])
+		if err != nil {
+			return nil, pos + n, ap.ErrDetails{err, str, pos + n}
+		}
+		if n == 0 {
+			return opts, pos, nil
+		}
+		switch val := val.(type) {
+		case newPolicyFn:
+			if opts.newPolicy != nil {
+				return nil, pos, ap.ErrDetails{
+					errors.New("more than one policy"), str, pos,
+				}
+			}
+			opts.newPolicy = val
+		case labelDomain:
+			opts.domains = append(opts.domains, val)
+		}
+		pos += n
+	}
+}
+
+// Parses one named option, if str starts with a name, min copies coming
+// first otherwise.
+func (arg argStripeOpts) parseOne(str string) (interface{}, int, error) {
+	n := strings.IndexFunc(str, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	if n == -1 {
+		n = len(str)
+	}
+	if n == 0 {
+		return nil, 0, nil
+	}
+	parser, ok := arg[str[:n]]
+	if !ok {
+		return nil, n, fmt.Errorf("no such policy: %q", str[:n])
+	}
+	if n < len(str) && str[n] == '(' {
+		res, m, err := parser.Parse(str[n:])
+		return res, n + m, err
+	}
+	res, _, err := parser.Parse("()")
+	return res, n, err
+}
+
+func countLeftSpaces(str string) int {
+	return len(str) - len(strings.TrimLeftFunc(str, unicode.IsSpace))
+}
+
+// Returns the failure domains of copiers by their labels.
+func (opts stripeOpts) stripeDomains(ress []quotaRes) ([]stripe.Domain, error) {
+	domains := make([]stripe.Domain, len(opts.domains))
+	for i, d := range opts.domains {
+		values := make(map[interface{}]string, len(ress))
+		for _, res := range ress {
+			id := res.copier.Id()
+			v, ok := res.labels[d.label]
+			if !ok {
+				return nil, fmt.Errorf("distinct: no label %q for copier %v",
+					d.label, id)
+			}
+			values[id] = v
+		}
+		domains[i] = stripe.Domain{Values: values, Min: d.min}
+	}
+	return domains, nil
+}
+
+type idPrice struct {
+	id    interface{}
+	price storestripe.Price
+}
+
+// Parses "storage[/egress]" prices per GiB, ex: 0.005/0.01.
+type argPrice struct{}
+
+const priceSep = "/"
+
+func (argPrice) Parse(str string) (interface{}, int, error) {
+	n := strings.IndexFunc(str, unicode.IsSpace)
+	if n == -1 {
+		n = len(str)
+	}
+	sstr, estr := str[:n], ""
+	if i := strings.Index(sstr, priceSep); i != -1 {
+		sstr, estr = sstr[:i], sstr[i+len(priceSep):]
+	}
+	var (
+		p   storestripe.Price
+		err error
+	)
+	if p.Storage, err = strconv.ParseFloat(sstr, 64); err != nil {
+		return nil, 0, err
+	}
+	if estr != "" {
+		if p.Egress, err = strconv.ParseFloat(estr, 64); err != nil {
+			return nil, len(sstr) + len(priceSep), err
+		}
+	}
+	return p, n, nil
+}
@@ -0,0 +1,299 @@
+package argproc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	ap "github.com/pbtrung/scat/argparse"
+	"github.com/pbtrung/scat/compress"
+	"github.com/pbtrung/scat/procs"
+	"github.com/pbtrung/scat/slots"
+	"github.com/pbtrung/scat/stats"
+	"github.com/pbtrung/scat/stores"
+	"github.com/pbtrung/scat/tmpdedup"
+)
+
+var (
+	errRestoreNoIndex     = errors.New("backup chain has no index to restore from")
+	errRestoreManyIndexes = errors.New("backup chain has more than one index")
+	errRestoreManySplits  = errors.New("backup chain has more than one split")
+)
+
+// NewRestore returns a parser of backup proc strings deriving the restore
+// chain: fed an index written by the backup chain, it writes the original
+// stream to w.
+//
+// Procs are reversed in reverse order: uindex first, parity becomes group and
+// uparity, stripe becomes multireader, split becomes join, etc. Only the last
+// checksum of the chain is verified. Procs without inverse (ex: cmd) must be
+// wrapped in reversible(proc unproc).
+func NewRestore(tmp *tmpdedup.Dir, stats *stats.Statsd, w io.Writer,
+) ap.Parser {
+	return NewRestoreWithOptions(tmp, stats, w, Options{})
+}
+
+// Like NewRestore(), with opts as for NewWithOptions(). Only LsCache, BwLimit
+// and Slots apply.
+func NewRestoreWithOptions(tmp *tmpdedup.Dir, stats *stats.Statsd,
+	w io.Writer, opts Options,
+) ap.Parser {
+	b := newBuilder(tmp, stats, Options{
+		LsCache: opts.LsCache,
+		BwLimit: opts.BwLimit,
+		Slots:   opts.Slots,
+	})
+	argRev := b.restoreArgProc(w)
+	return ap.ArgFilter{
+		Parser: ap.ArgPiped{Arg: argRev, Nest: chainBrackets},
+		Filter: func(val interface{}) (interface{}, error) {
+			return newRestoreChain(val.([]interface{}), w)
+		},
+	}
+}
+
+// Restore counterparts of backup procs, as parsed in restore mode.
+type (
+	// placed at the position mirroring the backup proc
+	revProc struct {
+		proc procs.Proc
+	}
+	revChain   []interface{}
+	revBacklog struct {
+		slots *slots.Slots
+		chain revChain
+	}
+	revIndex    struct{}
+	revChecksum struct{}
+	revSplit    struct{}
+	revNone     struct{}
+	revUnknown  struct {
+		name string
+	}
+)
+
+type revState struct {
+	w        io.Writer
+	indexes  int
+	splits   int
+	checksum bool
+	unknown  []string
+}
+
+func newRestoreChain(args []interface{}, w io.Writer) (procs.Proc, error) {
+	st := &revState{w: w}
+	chain := st.reverse(args)
+	switch {
+	case len(st.unknown) > 0:
+		return nil, fmt.Errorf(
+			"no inverse for %q: use reversible(proc unproc)", st.unknown[0],
+		)
+	case st.indexes == 0:
+		return nil, errRestoreNoIndex
+	case st.indexes > 1:
+		return nil, errRestoreManyIndexes
+	case st.splits > 1:
+		return nil, errRestoreManySplits
+	}
+	if st.splits == 0 {
+		// single chunk seed
+		chain = append(chain, procs.NewJoin(w))
+	}
+	return append(procs.Chain{procs.IndexUnproc}, chain...), nil
+}
+
+func (st *revState) reverse(args []interface{}) (chain procs.Chain) {
+	for i := len(args) - 1; i >= 0; i-- {
+		switch n := args[i].(type) {
+		case revProc:
+			chain = append(chain, n.proc)
+		case revChain:
+			chain = append(chain, st.reverse(n)...)
+		case revBacklog:
+			bl := procs.NewBacklogSlots(n.slots, st.reverse(n.chain))
+			chain = append(chain, bl)
+		case revIndex:
+			st.indexes++
+		case revChecksum:
+			// the last one verifies final chunks, as listed by the index
+			if !st.checksum {
+				st.checksum = true
+				chain = append(chain, procs.ChecksumUnproc)
+			}
+		case revSplit:
+			st.splits++
+			chain = append(chain, procs.NewJoin(st.w))
+		case revUnknown:
+			st.unknown = append(st.unknown, n.name)
+		case revNone:
+		default:
+			panic(fmt.Errorf("unexpected restore node: %#v", n))
+		}
+	}
+	return
+}
+
+func (b builder) restoreArgProc(w io.Writer) ap.Parser {
+	var (
+		argRev   = make(ap.ArgOr, 2)
+		argStore = b.newArgStore()
+		argFwd   = b.argProc()
+	)
+	argChain := ap.ArgLambda{
+		Brackets: chainBrackets,
+		Args:     ap.ArgPiped{Arg: argRev, Nest: chainBrackets},
+		Run: func(args []interface{}) (interface{}, error) {
+			return revChain(args), nil
+		},
+	}
+	node := func(n interface{}) ap.RunFn {
+		return func([]interface{}) (interface{}, error) {
+			return n, nil
+		}
+	}
+	toRev := func(arg ap.Parser) ap.Parser {
+		return ap.ArgFilter{
+			Parser: arg,
+			Filter: func(val interface{}) (interface{}, error) {
+				return revProc{val.(procs.Proc)}, nil
+			},
+		}
+	}
+	argDynp := ap.ArgFn{}
+	for _, name := range []string{"stripe", "mincopies"} {
+		argDynp[name] = b.newArgRevStripe(name, argStore)
+	}
+
+	fns := ap.ArgFn{
+		"checksum": ap.ArgLambda{Run: node(revChecksum{})},
+		"index": ap.ArgLambda{
+			Args: ap.Args{ap.ArgStr},
+			Run:  node(revIndex{}),
+		},
+		"catalog": ap.ArgLambda{
+			Args: ap.Args{ap.ArgStr},
+			Run:  node(revNone{}),
+		},
+		"split": ap.ArgLambda{Run: node(revSplit{})},
+		"split2": ap.ArgLambda{
+			Args: ap.Args{ap.ArgBytes, ap.ArgBytes},
+			Run:  node(revSplit{}),
+		},
+		"backlog": ap.ArgLambda{
+			Args: ap.Args{ap.ArgInt, argRev},
+			Run: func(args []interface{}) (interface{}, error) {
+				var (
+					nslots = args[0].(int)
+					node   = args[1]
+				)
+				s := b.newSlots("backlog", nslots)
+				return revBacklog{s, revChain{node}}, nil
+			},
+		},
+		"concur": ap.ArgLambda{
+			Args: ap.Args{ap.ArgInt, argDynp},
+			Run: func(args []interface{}) (interface{}, error) {
+				var (
+					nslots = args[0].(int)
+					node   = args[1]
+				)
+				s := b.newSlots("concur", nslots)
+				return revBacklog{s, revChain{node}}, nil
+			},
+		},
+		"parity": ap.ArgLambda{
+			Args: ap.Args{ap.ArgInt, ap.ArgInt},
+			Run: func(args []interface{}) (interface{}, error) {
+				var (
+					ndata   = args[0].(int)
+					nparity = args[1].(int)
+				)
+				parity, err := procs.NewParity(ndata, nparity)
+				if err != nil {
+					return nil, err
+				}
+				group := procs.NewGroup(ndata + nparity)
+				return revProc{procs.Chain{group, parity.Unproc()}}, nil
+			},
+		},
+		"gzip":    toRev(b.newArgCompress(compress.Gzip, getUnproc, false)),
+		"zstd":    toRev(b.newArgCompress(compress.Zstd, getUnproc, false)),
+		"lz4":     toRev(b.newArgCompress(compress.Lz4, getUnproc, false)),
+		"xz":      toRev(b.newArgCompress(compress.Xz, getUnproc, false)),
+		"encrypt": toRev(newArgEncrypt(getUnproc)),
+		"group":   ap.ArgLambda{Args: ap.Args{ap.ArgInt}, Run: node(revNone{})},
+		"sort":    ap.ArgLambda{Run: node(revNone{})},
+		"reversible": ap.ArgLambda{
+			Args: ap.Args{argRev, argFwd},
+			Run: func(args []interface{}) (interface{}, error) {
+				return revProc{args[1].(procs.Proc)}, nil
+			},
+		},
+	}
+	for _, name := range []string{"cmd", "cmdin", "cmdout"} {
+		fns[name] = ap.ArgLambda{
+			Args: ap.Args{ap.ArgStr, ap.ArgVariadic{ap.ArgStr}},
+			Run:  node(revUnknown{name}),
+		}
+	}
+	for k, v := range argStore {
+		fns[k] = toRev(newArgStoreProc(v, getUnproc))
+	}
+	fns["retry"] = ap.ArgLambda{
+		Args: ap.Args{ap.ArgInt, ap.ArgDuration, argRev},
+		Run: func(args []interface{}) (interface{}, error) {
+			var (
+				n       = args[0].(int)
+				backoff = args[1].(time.Duration)
+				node    = args[2]
+			)
+			// only single procs retried, derived chains as is
+			if rp, ok := node.(revProc); ok {
+				node = revProc{newRetry(n, backoff, rp.proc)}
+			}
+			return node, nil
+		},
+	}
+	fns["adapt"] = ap.ArgLambda{
+		Args: ap.Args{ap.ArgInt, ap.ArgInt, argRev},
+		Run: func(args []interface{}) (interface{}, error) {
+			// only single procs limited, derived chains as is
+			rp, ok := args[2].(revProc)
+			if !ok {
+				return args[2], nil
+			}
+			s, err := b.newAdaptive(args[0].(int), args[1].(int))
+			if err != nil {
+				return nil, err
+			}
+			return revProc{procs.Adaptive{Proc: rp.proc, Slots: s}}, nil
+		},
+	}
+	argRev[0] = argChain
+	argRev[1] = fns
+	return argRev
+}
+
+// Returns a parser of stripe() or mincopies() args yielding a multireader of
+// their stores.
+func (b builder) newArgRevStripe(name string, argStore ap.Parser) ap.Parser {
+	argQuota := b.newArgQuota(b.newArgCopier(argStore, getUnproc, false))
+	argOpts := newArgStripeOpts()
+	args := ap.Args{argOpts, ap.ArgInt, ap.ArgInt, ap.ArgVariadic{argQuota}}
+	if name == "mincopies" {
+		args = ap.Args{argOpts, ap.ArgInt, ap.ArgVariadic{argQuota}}
+	}
+	return ap.ArgLambda{
+		Args: args,
+		Run: func(args []interface{}) (interface{}, error) {
+			iress := args[len(args)-1].([]interface{})
+			copiers := make([]stores.Copier, len(iress))
+			for i, ires := range iress {
+				copiers[i] = ires.(quotaRes).copier
+			}
+			mrd, err := stores.NewMultiReader(copiers)
+			return revProc{mrd}, err
+		},
+	}
+}
@@ -0,0 +1,76 @@
+package argproc_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pbtrung/scat"
+	ap "github.com/pbtrung/scat/argparse"
+	"github.com/pbtrung/scat/argproc"
+	"github.com/pbtrung/scat/procs"
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	for _, d := range []string{"a", "b", "c"} {
+		assert.NoError(t, os.Mkdir(filepath.Join(dir, d), 0755))
+	}
+	idxPath := filepath.Join(dir, "index")
+	data := make([]byte, 3*1024*1024)
+	rand.Read(data)
+
+	backup := fmt.Sprintf(`split | backlog 2 {
+		checksum
+		| index %[1]s/index
+		| gzip
+		| parity 2 1
+		| checksum
+		| reversible({cmd cat} {cmd cat})
+		| group 3
+		| concur 2 stripe(1 1
+			a=retry(2 10ms cp(%[1]s/a)) b=cp(%[1]s/b) c=cp(%[1]s/c)
+		)
+	}`, dir)
+	run := func(parser ap.Parser, str string, seed []byte) {
+		res, _, err := parser.Parse(str)
+		assert.NoError(t, err)
+		proc := res.(procs.Proc)
+		err = procs.Process(proc, scat.NewChunk(0, scat.BytesData(seed)))
+		assert.NoError(t, err)
+	}
+	run(argproc.New(nil, nil), backup, data)
+	idx, err := ioutil.ReadFile(idxPath)
+	assert.NoError(t, err)
+
+	out := &bytes.Buffer{}
+	run(argproc.NewRestore(nil, nil, out), backup, idx)
+	assert.Equal(t, data, out.Bytes())
+
+	// index left untouched
+	idx2, err := ioutil.ReadFile(idxPath)
+	assert.NoError(t, err)
+	assert.Equal(t, idx, idx2)
+}
+
+func TestRestoreInvalid(t *testing.T) {
+	parse := func(str string) error {
+		_, _, err := argproc.NewRestore(nil, nil, ioutil.Discard).Parse(str)
+		return err
+	}
+	assert.NoError(t, parse("checksum | index - | cp(/tmp)"))
+	assert.NoError(t, parse("checksum | index - | concur 2 stripe("+
+		"cost(a=1 b=2) 1 0 a=cp(/tmp) b=cp(/tmp))"))
+	assert.Error(t, parse("checksum | cp(/tmp)"))
+	assert.Error(t, parse("checksum | index - | index - | cp(/tmp)"))
+	assert.Error(t, parse("split | split | checksum | index - | cp(/tmp)"))
+	assert.Error(t, parse("checksum | index - | cmd cat | cp(/tmp)"))
+	assert.Error(t, parse("checksum | index - | ugzip"))
+}
@@ -0,0 +1,96 @@
+// Package catalog maps members of a tar stream to their byte range within
+// it, for listing the contents of a backup and restoring single members with
+// uindex ranges.
+package catalog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+type Entry struct {
+	Path    string
+	Mode    os.FileMode
+	ModTime time.Time
+	Size    int64
+
+	// Byte range of the member in the stream, from its first header block
+	// to the end of its padded data. Extracting it alone yields a valid tar
+	// stream holding that member.
+	Offset, Length int64
+}
+
+// Line format: offset length mode mtime size path. The path comes last and
+// quoted so that it may contain any character.
+const lineFmt = "%d %d %o %d %d %q\n"
+
+func Write(w io.Writer, e Entry) error {
+	_, err := fmt.Fprintf(w, lineFmt,
+		e.Offset, e.Length, uint32(e.Mode), e.ModTime.Unix(), e.Size, e.Path,
+	)
+	return err
+}
+
+func Read(r io.Reader) (entries []Entry, err error) {
+	scan := bufio.NewScanner(r)
+	for scan.Scan() {
+		var (
+			e     Entry
+			mode  uint32
+			mtime int64
+		)
+		_, err = fmt.Sscanf(scan.Text(), strings.TrimSuffix(lineFmt, "\n"),
+			&e.Offset, &e.Length, &mode, &mtime, &e.Size, &e.Path,
+		)
+		if err != nil {
+			err = fmt.Errorf("invalid catalog line %q: %v", scan.Text(), err)
+			return
+		}
+		e.Mode = os.FileMode(mode)
+		e.ModTime = time.Unix(mtime, 0)
+		entries = append(entries, e)
+	}
+	err = scan.Err()
+	return
+}
+
+// Find returns the entries whose path is the given one or under it when it's
+// a directory. Paths are compared cleaned and relative (ex: "./a/" is "a").
+func Find(entries []Entry, path string) (found []Entry) {
+	path = clean(path)
+	for _, e := range entries {
+		p := clean(e.Path)
+		if p == path || path == "" || strings.HasPrefix(p, path+"/") {
+			found = append(found, e)
+		}
+	}
+	return
+}
+
+func clean(p string) string {
+	return strings.TrimPrefix(path.Clean("/"+p), "/")
+}
+
+// Range returns the smallest byte range covering all the given entries.
+func Range(entries []Entry) (offset, length int64) {
+	if len(entries) == 0 {
+		return
+	}
+	offset = entries[0].Offset
+	end := offset
+	for _, e := range entries {
+		if e.Offset < offset {
+			offset = e.Offset
+		}
+		if e.Offset+e.Length > end {
+			end = e.Offset + e.Length
+		}
+	}
+	length = end - offset
+	return
+}
@@ -0,0 +1,117 @@
+package catalog_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pbtrung/scat/catalog"
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestWriteRead(t *testing.T) {
+	entries := []catalog.Entry{
+		{"a/b c", 0644, time.Unix(1486000000, 0), 3, 0, 1024},
+		{"new\nline", os.ModeDir | 0755, time.Unix(1, 0), 0, 1024, 512},
+	}
+	buf := &bytes.Buffer{}
+	for _, e := range entries {
+		assert.NoError(t, catalog.Write(buf, e))
+	}
+	res, err := catalog.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, len(entries), len(res))
+	for i, e := range entries {
+		assert.True(t, e.ModTime.Equal(res[i].ModTime))
+		res[i].ModTime = e.ModTime
+	}
+	assert.Equal(t, entries, res)
+
+	_, err = catalog.Read(bytes.NewBufferString("1 2 x\n"))
+	assert.Error(t, err)
+}
+
+func TestFindRange(t *testing.T) {
+	entries := []catalog.Entry{
+		{Path: "./foo/", Offset: 0, Length: 512},
+		{Path: "./foo/a", Offset: 512, Length: 1024},
+		{Path: "./foobar", Offset: 1536, Length: 1024},
+		{Path: "./foo/b", Offset: 2560, Length: 1024},
+	}
+	paths := func(entries []catalog.Entry) (res []string) {
+		for _, e := range entries {
+			res = append(res, e.Path)
+		}
+		return
+	}
+	found := catalog.Find(entries, "foo")
+	assert.Equal(t, []string{"./foo/", "./foo/a", "./foo/b"}, paths(found))
+	offset, length := catalog.Range(found)
+	assert.Equal(t, int64(0), offset)
+	assert.Equal(t, int64(3584), length)
+
+	found = catalog.Find(entries, "/foo/a")
+	assert.Equal(t, []string{"./foo/a"}, paths(found))
+	assert.Equal(t, 0, len(catalog.Find(entries, "fo")))
+	assert.Equal(t, 4, len(catalog.Find(entries, ".")))
+}
+
+func TestScanTar(t *testing.T) {
+	files := []struct {
+		name, data string
+	}{
+		{"a", "hello"},
+		{"b", string(bytes.Repeat([]byte("x"), 1000))},
+		{string(bytes.Repeat([]byte("long/"), 30)) + "c", ""},
+	}
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	mtime := time.Unix(1486000000, 0)
+	for _, f := range files {
+		err := tw.WriteHeader(&tar.Header{
+			Name:    f.name,
+			Mode:    0600,
+			Size:    int64(len(f.data)),
+			ModTime: mtime,
+		})
+		assert.NoError(t, err)
+		_, err = tw.Write([]byte(f.data))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tw.Close())
+	stream := buf.Bytes()
+
+	entries := []catalog.Entry{}
+	err := catalog.ScanTar(bytes.NewReader(stream), func(e catalog.Entry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, len(files), len(entries))
+	for i, f := range files {
+		e := entries[i]
+		assert.Equal(t, f.name, e.Path)
+		assert.Equal(t, int64(len(f.data)), e.Size)
+		assert.Equal(t, os.FileMode(0600), e.Mode)
+		assert.True(t, mtime.Equal(e.ModTime))
+
+		// the range alone is a valid archive of the member
+		tr := tar.NewReader(bytes.NewReader(stream[e.Offset:][:e.Length]))
+		hdr, err := tr.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, f.name, hdr.Name)
+		data, err := ioutil.ReadAll(tr)
+		assert.NoError(t, err)
+		assert.Equal(t, f.data, string(data))
+	}
+	assert.Equal(t, int64(0), entries[0].Offset)
+	assert.Equal(t, entries[1].Offset+entries[1].Length, entries[2].Offset)
+
+	err = catalog.ScanTar(bytes.NewBufferString("not a tar"),
+		func(catalog.Entry) error { return nil },
+	)
+	assert.Error(t, err)
+}
@@ -0,0 +1,58 @@
+package catalog
+
+import (
+	"archive/tar"
+	"io"
+)
+
+const tarBlockSize = 512
+
+// ScanTar reads the tar stream r, calling fn with the entry of each member in
+// order. Member data is skipped, not buffered.
+func ScanTar(r io.Reader, fn func(Entry) error) error {
+	cr := &countReader{r: r}
+	tr := tar.NewReader(cr)
+	start := int64(0)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// tar.Reader reads header blocks exactly, so the count is now the
+		// offset of the member data
+		end := cr.n + padded(hdr.Size)
+		err = fn(Entry{
+			Path:    hdr.Name,
+			Mode:    hdr.FileInfo().Mode(),
+			ModTime: hdr.ModTime,
+			Size:    hdr.Size,
+			Offset:  start,
+			Length:  end - start,
+		})
+		if err != nil {
+			return err
+		}
+		start = end
+	}
+}
+
+func padded(size int64) int64 {
+	if rem := size % tarBlockSize; rem != 0 {
+		size += tarBlockSize - rem
+	}
+	return size
+}
+
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
@@ -2,6 +2,7 @@ package checksum
 
 import (
 	"crypto/sha512"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -22,6 +23,19 @@ func (h *Hash) LoadSlice(s []byte) error {
 	return nil
 }
 
+// MarshalText encodes the hash in hex, for JSON and other text formats.
+func (h Hash) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(h[:])), nil
+}
+
+func (h *Hash) UnmarshalText(text []byte) error {
+	b, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	return h.LoadSlice(b)
+}
+
 func Sum(rd io.Reader) (cks Hash, err error) {
 	hash := sha512.New()
 	_, err = io.Copy(hash, rd)
@@ -33,3 +33,15 @@ func TestSum(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, hex, fmt.Sprintf("%x", h))
 }
+
+func TestHashText(t *testing.T) {
+	h := checksum.SumBytes([]byte("abc"))
+	text, err := h.MarshalText()
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%x", h), string(text))
+	var res checksum.Hash
+	assert.NoError(t, res.UnmarshalText(text))
+	assert.Equal(t, h, res)
+	assert.Error(t, res.UnmarshalText([]byte("abc")))
+	assert.Error(t, res.UnmarshalText([]byte("zz")))
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pbtrung/scat/control"
+)
+
+func controlCommand(name string, args []string) error {
+	fl := flag.NewFlagSet(name, flag.ExitOnError)
+	fl.Usage = func() {
+		w := fl.Output()
+		fmt.Fprintf(w, "usage: %s <socket> <command>\n", name)
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "Sends <command> to scat running with -control <socket>:\n")
+		fmt.Fprintf(w, "  ls              list slots: name, size, in use\n")
+		fmt.Fprintf(w, "  set <name> <n>  resize slots\n")
+	}
+	fl.Parse(args)
+	if fl.NArg() < 2 {
+		fl.Usage()
+		os.Exit(2)
+	}
+	cmd := strings.Join(fl.Args()[1:], " ")
+	return control.Send(fl.Arg(0), cmd, os.Stdout)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/pbtrung/scat/argproc"
+	"github.com/pbtrung/scat/stores"
+	"github.com/pbtrung/scat/stores/gc"
+	"github.com/pbtrung/scat/stores/lscache"
+	"github.com/pbtrung/scat/tmpdedup"
+)
+
+func gcCommand(name string, args []string) (err error) {
+	fl := flag.NewFlagSet(name, flag.ExitOnError)
+	dryRun := fl.Bool("dry-run", false, "only report what would be freed")
+	repoDir := fl.String("repo", "",
+		"snapshot repository whose snapshots and their indexes are kept")
+	lsCachePath := fl.String("lscache", os.Getenv(lsCacheEnv),
+		"cache file of store listings, dropping those of <stores>")
+	fl.Usage = func() {
+		w := fl.Output()
+		fmt.Fprintf(w, "usage: %s [options] <stores> [index...]\n", name)
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "Deletes chunks of <stores> referenced by none of the given\n")
+		fmt.Fprintf(w, "indexes, nor by snapshots of -repo.\n")
+		fmt.Fprintf(w, "<stores>: id=store pairs, as in multireader()\n")
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "options:\n")
+		fl.PrintDefaults()
+	}
+	fl.Parse(args)
+	if fl.NArg() < 1 || (fl.NArg() < 2 && *repoDir == "") {
+		fl.Usage()
+		os.Exit(2)
+	}
+
+	live := gc.NewLive()
+	for _, path := range fl.Args()[1:] {
+		err = addIndexFile(live, path)
+		if err != nil {
+			return
+		}
+	}
+
+	tmp, err := tmpdedup.TempDir("")
+	if err != nil {
+		return
+	}
+	defer tmp.Finish()
+
+	if *repoDir != "" {
+		repo, repoStrs, err := openSnapshotRepo(*repoDir, tmp)
+		if err != nil {
+			return err
+		}
+		err = repo.AddLive(live, repoStrs)
+		if err != nil {
+			return err
+		}
+	}
+
+	res, _, err := argproc.NewStores(tmp).Parse(fl.Arg(0))
+	if err != nil {
+		return
+	}
+	named := res.([]stores.Named)
+	strs := make([]gc.Store, len(named))
+	for i, n := range named {
+		del, ok := n.Store.(stores.Deleter)
+		if !ok {
+			return fmt.Errorf("store %v doesn't support deletion", n.Id())
+		}
+		strs[i] = gc.Store{n.Id(), n.Store, del}
+	}
+
+	if !*dryRun {
+		defer func() {
+			if e := removeLsCache(*lsCachePath, named); e != nil && err == nil {
+				err = e
+			}
+		}()
+	}
+	reports, err := gc.Collect(live, strs, *dryRun)
+	writeGcReports(os.Stdout, reports, *dryRun)
+	return
+}
+
+// Drops cached listings of stores changed by other means than procs, if
+// path is set.
+func removeLsCache(path string, strs []stores.Named) (err error) {
+	if path == "" {
+		return
+	}
+	cache, err := lscache.Open(path, 0)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if e := cache.Close(); e != nil && err == nil {
+			err = e
+		}
+	}()
+	for _, st := range strs {
+		err = cache.Remove(fmt.Sprint(st.Id()))
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func addIndexFile(live gc.Live, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return live.AddIndex(f)
+}
+
+func writeGcReports(w io.Writer, reports []gc.Report, dryRun bool) {
+	verb := "freed"
+	if dryRun {
+		verb = "would free"
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	defer tw.Flush()
+	for _, r := range reports {
+		fmt.Fprintf(tw, "%v\t%s %s\t(%d chunks)\n",
+			r.Id, verb, humanize.IBytes(uint64(r.Bytes)), r.Chunks,
+		)
+	}
+}
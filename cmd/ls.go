@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/pbtrung/scat/catalog"
+)
+
+func lsCommand(name string, args []string) (err error) {
+	fl := flag.NewFlagSet(name, flag.ExitOnError)
+	long := fl.Bool("l", false, "show mode, size, mtime and byte range")
+	printRange := fl.Bool("range", false,
+		"print the byte range covering the matched entries, as uindex args")
+	fl.Usage = func() {
+		w := fl.Output()
+		fmt.Fprintf(w, "usage: %s [options] <catalog> [path...]\n", name)
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "Lists entries of <catalog> under the given paths,\n")
+		fmt.Fprintf(w, "or all of them.\n")
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "options:\n")
+		fl.PrintDefaults()
+	}
+	fl.Parse(args)
+	if fl.NArg() < 1 {
+		fl.Usage()
+		os.Exit(2)
+	}
+
+	f, err := os.Open(fl.Arg(0))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	entries, err := catalog.Read(f)
+	if err != nil {
+		return
+	}
+	if paths := fl.Args()[1:]; len(paths) > 0 {
+		found := []catalog.Entry{}
+		for _, p := range paths {
+			matched := catalog.Find(entries, p)
+			if len(matched) == 0 {
+				err = fmt.Errorf("%s: not in catalog", p)
+				return
+			}
+			found = append(found, matched...)
+		}
+		entries = found
+	}
+
+	if *printRange {
+		offset, length := catalog.Range(entries)
+		fmt.Printf("%d %d\n", offset, length)
+		return
+	}
+	writeLs(os.Stdout, entries, *long)
+	return
+}
+
+func writeLs(w io.Writer, entries []catalog.Entry, long bool) {
+	if !long {
+		for _, e := range entries {
+			fmt.Fprintln(w, e.Path)
+		}
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', tabwriter.AlignRight)
+	defer tw.Flush()
+	for _, e := range entries {
+		fmt.Fprintf(tw, "%v\t%s\t%s\t%d\t%d\t %s\n",
+			e.Mode, humanize.IBytes(uint64(e.Size)),
+			e.ModTime.Local().Format(time.RFC3339),
+			e.Offset, e.Length, e.Path,
+		)
+	}
+}
@@ -1,21 +1,32 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"math/rand"
+	"net"
+	"net/http"
 	"os"
 	"os/exec"
 	"time"
 
+	humanize "github.com/dustin/go-humanize"
 	"github.com/pbtrung/scat"
 	"github.com/pbtrung/scat/ansirefresh"
 	"github.com/pbtrung/scat/argparse"
 	"github.com/pbtrung/scat/argproc"
+	"github.com/pbtrung/scat/config"
+	"github.com/pbtrung/scat/control"
+	"github.com/pbtrung/scat/index"
+	"github.com/pbtrung/scat/journal"
 	"github.com/pbtrung/scat/procs"
+	"github.com/pbtrung/scat/slots"
 	"github.com/pbtrung/scat/stats"
+	"github.com/pbtrung/scat/stores/lscache"
+	"github.com/pbtrung/scat/stripe"
 	"github.com/pbtrung/scat/tmpdedup"
 )
 
@@ -34,9 +45,27 @@ func main() {
 	}
 }
 
+type command func(name string, args []string) error
+
+var commands = map[string]command{
+	"control":   controlCommand,
+	"gc":        gcCommand,
+	"ls":        lsCommand,
+	"repair":    repairCommand,
+	"restore":   restoreCommand,
+	"snapshots": snapshotsCommand,
+	"verify":    verifyCommand,
+}
+
 func start() (err error) {
 	rand.Seed(time.Now().UnixNano())
 
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			return cmd(os.Args[0]+" "+os.Args[1], os.Args[2:])
+		}
+	}
+
 	args := cmdArgs{}
 	args.Parse(os.Args)
 
@@ -51,29 +80,262 @@ func start() (err error) {
 	}
 	defer tmp.Finish()
 
-	var statsd *stats.Statsd
-	if args.stats {
-		statsd = stats.New()
-		w := ansirefresh.NewWriter(os.Stderr)
-		t := ansirefresh.NewWriteTicker(w, statsd, 500*time.Millisecond)
-		defer t.Stop()
+	statsd, stopStats, err := args.startStats()
+	if err != nil {
+		return
 	}
+	defer stopStats()
 
-	argProc := argproc.New(tmp, statsd)
-	res, _, err := argProc.Parse(args.procStr)
+	procStr, err := expandProcStr(args.config, args.procStr)
+	if err != nil {
+		return
+	}
+	hdr := &index.Header{Created: time.Now(), ScatVersion: version}
+	var j *journal.Journal
+	if args.journal != "" {
+		j, err = journal.Open(args.journal)
+		if err != nil {
+			return
+		}
+		defer func() {
+			if e := j.Close(); e != nil && err == nil {
+				err = e
+			}
+		}()
+	}
+	opts := argproc.Options{Header: hdr, Journal: j, DryRun: args.dryRun}
+	err = args.run.open(&opts)
+	if err != nil {
+		return
+	}
+	defer args.run.close()
+	argProc := argproc.NewWithOptions(tmp, statsd, opts)
+	res, _, err := argProc.Parse(procStr)
 	if err != nil {
 		return
 	}
 	proc := res.(procs.Proc)
-	seed := scat.NewChunk(0, scat.NewReaderData(os.Stdin))
+	in := &countReader{r: os.Stdin}
+	seed := scat.NewChunk(0, scat.NewReaderData(in))
+
+	startTime := time.Now()
+	err = procs.Process(proc, seed)
+	if statsd != nil && args.reporting() {
+		rep := statsd.Report(startTime, uint64(in.n))
+		rep.DryRun = args.dryRun
+		rep.Short = err == stripe.ErrShort
+		if err != nil {
+			rep.Err = err.Error()
+		}
+		if e := args.writeReport(rep); e != nil && err == nil {
+			err = e
+		}
+	}
+	return
+}
+
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+const configEnv = "SCAT_CONFIG"
+
+// Expands references of procStr to the config file at path, if any.
+func expandProcStr(path, procStr string) (string, error) {
+	if path == "" {
+		return procStr, nil
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		return "", err
+	}
+	return cfg.Expand(procStr)
+}
+
+const lsCacheEnv = "SCAT_LSCACHE"
+
+// Flags of commands running procs.
+type runFlags struct {
+	lsCachePath string
+	lsCacheTTL  time.Duration
+	lsCache     *lscache.Cache
+	bwLimit     rateFlag
+	controlPath string
+	control     *control.Server
+}
+
+func (f *runFlags) register(fl *flag.FlagSet) {
+	fl.StringVar(&f.lsCachePath, "lscache", os.Getenv(lsCacheEnv),
+		"cache file of store listings")
+	fl.DurationVar(&f.lsCacheTTL, "lscache-ttl", 24*time.Hour,
+		"age of cached listings after which stores are listed again")
+	fl.Var(&f.bwLimit, "bwlimit",
+		"global limit of store transfers, in bytes per second (ex: 2mib/s)")
+	fl.StringVar(&f.controlPath, "control", "",
+		"unix socket to serve commands resizing concur, backlog and adapt on")
+}
+
+// Sets fields of opts given by flags. Must be followed by close().
+func (f *runFlags) open(opts *argproc.Options) (err error) {
+	opts.BwLimit = uint64(f.bwLimit)
+	if f.controlPath != "" {
+		reg := slots.NewRegistry()
+		f.control, err = control.Listen(f.controlPath, reg)
+		if err != nil {
+			return
+		}
+		opts.Slots = reg
+	}
+	if f.lsCachePath != "" {
+		f.lsCache, err = lscache.Open(f.lsCachePath, f.lsCacheTTL)
+		if err != nil {
+			f.close()
+			return
+		}
+		opts.LsCache = f.lsCache
+	}
+	return
+}
+
+func (f *runFlags) close() {
+	if f.control != nil {
+		if err := f.control.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "control: %v\n", err)
+		}
+	}
+	if f.lsCache != nil {
+		if err := f.lsCache.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "lscache: %v\n", err)
+		}
+	}
+}
+
+// Rate in bytes per second: see argparse.ArgRate.
+type rateFlag uint64
 
-	return procs.Process(proc, seed)
+func (f *rateFlag) String() string {
+	if *f == 0 {
+		return ""
+	}
+	return humanize.IBytes(uint64(*f)) + "/s"
+}
+
+func (f *rateFlag) Set(str string) error {
+	rate, n, err := argparse.ArgRate.Parse(str)
+	if err == nil && n != len(str) {
+		err = argparse.ErrInvalidSyntax
+	}
+	if err != nil {
+		return err
+	}
+	*f = rateFlag(rate.(uint64))
+	return nil
 }
 
 type cmdArgs struct {
 	procStr string
+	config  string
+	journal string
+	run     runFlags
 	stats   bool
 	version bool
+
+	statsFormat   string
+	statsInterval time.Duration
+	metricsListen string
+
+	report     bool
+	reportJSON string
+	dryRun     bool
+}
+
+const (
+	statsTable = "table"
+	statsJSON  = "json"
+)
+
+// Starts printing stats and serving metrics, as requested. Returns nil stats
+// if neither is, nor a report. stop must be called once done.
+func (a *cmdArgs) startStats() (st *stats.Statsd, stop func(), err error) {
+	var stops []func()
+	stop = func() {
+		for _, fn := range stops {
+			fn()
+		}
+	}
+	printStats := a.stats || a.statsFormat != statsTable
+	if !printStats && a.metricsListen == "" && !a.reporting() {
+		return
+	}
+	st = stats.New()
+	if a.metricsListen != "" {
+		l, err := net.Listen("tcp", a.metricsListen)
+		if err != nil {
+			return nil, stop, err
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", stats.Prometheus{st})
+		srv := &http.Server{Handler: mux}
+		go srv.Serve(l)
+		stops = append(stops, func() { srv.Close() })
+	}
+	if printStats {
+		var t ansirefresh.Ticker
+		switch a.statsFormat {
+		case statsJSON:
+			t = ansirefresh.NewTicker(func() {
+				if _, err := (stats.JSON{st}).WriteTo(os.Stderr); err != nil {
+					fmt.Fprintf(os.Stderr, "stats: %v\n", err)
+				}
+			}, a.interval(10*time.Second))
+		default:
+			w := ansirefresh.NewWriter(os.Stderr)
+			t = ansirefresh.NewWriteTicker(w, st, a.interval(500*time.Millisecond))
+		}
+		stops = append(stops, t.Stop)
+	}
+	return
+}
+
+func (a *cmdArgs) reporting() bool {
+	return a.report || a.reportJSON != "" || a.dryRun
+}
+
+// Writes rep to stderr and/or to the JSON file, as requested.
+func (a *cmdArgs) writeReport(rep stats.Report) (err error) {
+	if a.report || a.dryRun {
+		if _, err = rep.WriteTo(os.Stderr); err != nil {
+			return
+		}
+	}
+	if a.reportJSON == "" {
+		return
+	}
+	f, err := os.Create(a.reportJSON)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if e := f.Close(); e != nil && err == nil {
+			err = e
+		}
+	}()
+	_, err = stats.ReportJSON{rep}.WriteTo(f)
+	return
+}
+
+func (a *cmdArgs) interval(def time.Duration) time.Duration {
+	if a.statsInterval > 0 {
+		return a.statsInterval
+	}
+	return def
 }
 
 func (a *cmdArgs) Parse(args []string) {
@@ -83,10 +345,35 @@ func (a *cmdArgs) Parse(args []string) {
 	}
 	fl := flag.NewFlagSet(name, flag.ContinueOnError)
 	fl.BoolVar(&a.stats, "stats", false, "print stats: rates, quotas, etc.")
+	fl.StringVar(&a.statsFormat, "stats-format", statsTable,
+		"format of stats, implying -stats: table or json (lines)")
+	fl.DurationVar(&a.statsInterval, "stats-interval", 0,
+		"interval of stats, default: 500ms for table, 10s for json")
+	fl.StringVar(&a.metricsListen, "metrics-listen", "",
+		"address to serve Prometheus metrics on at /metrics (ex: :9100)")
+	fl.BoolVar(&a.report, "report", false,
+		"print a summary of the backup to stderr once done")
+	fl.StringVar(&a.reportJSON, "report-json", "",
+		"file to write a summary of the backup to as JSON once done")
+	fl.BoolVar(&a.dryRun, "dry-run", false,
+		"write nothing to stores, index or catalog, only report what would be,"+
+			" implying -report")
 	fl.BoolVar(&a.version, "version", false, "show version")
+	fl.StringVar(&a.config, "config", os.Getenv(configEnv),
+		"config file of stores, chains and vars referenced as @name")
+	fl.StringVar(&a.journal, "journal", "",
+		"journal file to resume an interrupted backup from")
+	a.run.register(fl)
 	fl.SetOutput(ioutil.Discard)
 	usage := func(w io.Writer) {
 		fmt.Fprintf(w, "usage: %s [options] <proc>\n", name)
+		fmt.Fprintf(w, "       %s gc [options] <stores> <index>...\n", name)
+		fmt.Fprintf(w, "       %s verify [options] <stores> <index>\n", name)
+		fmt.Fprintf(w, "       %s repair [options] <stores> <index>\n", name)
+		fmt.Fprintf(w, "       %s restore [options] <proc> [index]\n", name)
+		fmt.Fprintf(w, "       %s ls [options] <catalog> [path...]\n", name)
+		fmt.Fprintf(w, "       %s snapshots <command> [options] <repo> ...\n", name)
+		fmt.Fprintf(w, "       %s control <socket> <command>\n", name)
 		fmt.Fprintln(w)
 		fmt.Fprintf(w, "\t<proc>\tproc string\n")
 		fmt.Fprintf(w, "\t\tsee %s\n", url)
@@ -99,6 +386,14 @@ func (a *cmdArgs) Parse(args []string) {
 		fmt.Fprintf(w, "see %s\n", url)
 	}
 	err := fl.Parse(args)
+	if err == nil && a.statsFormat != statsTable && a.statsFormat != statsJSON {
+		err = fmt.Errorf("invalid stats format: %q", a.statsFormat)
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+	}
+	if err == nil && a.dryRun && a.journal != "" {
+		err = errors.New("-dry-run and -journal are mutually exclusive")
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+	}
 	if err != nil || (fl.NArg() != 1 && !a.version) {
 		w, code := os.Stderr, 2
 		if err == flag.ErrHelp {
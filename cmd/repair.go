@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/pbtrung/scat/argproc"
+	"github.com/pbtrung/scat/checksum"
+	"github.com/pbtrung/scat/index"
+	"github.com/pbtrung/scat/procs"
+	"github.com/pbtrung/scat/stores"
+	"github.com/pbtrung/scat/stores/repair"
+	"github.com/pbtrung/scat/stripe"
+	"github.com/pbtrung/scat/tmpdedup"
+)
+
+func repairCommand(name string, args []string) (err error) {
+	fl := flag.NewFlagSet(name, flag.ExitOnError)
+	min := fl.Int("min", 1, "minimum number of copies of each chunk")
+	excl := fl.Int("excl", 0,
+		"minimum number of chunks per group on distinct stores")
+	parity := fl.String("parity", "",
+		`parity geometry "ndata nparity" of the backup, to rebuild lost shards`)
+	unprocStr := fl.String("unproc", "",
+		"proc string applied to downloaded chunks before verification")
+	lsCachePath := fl.String("lscache", os.Getenv(lsCacheEnv),
+		"cache file of store listings, dropping those of <stores>")
+	fl.Usage = func() {
+		w := fl.Output()
+		fmt.Fprintf(w, "usage: %s [options] <stores> <index>\n", name)
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "Copies chunks of <index> until meeting the requirements\n")
+		fmt.Fprintf(w, "of stripe(<min> <excl>) across <stores>.\n")
+		fmt.Fprintf(w, "<stores>: id=store pairs, as in multireader()\n")
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "options:\n")
+		fl.PrintDefaults()
+	}
+	fl.Parse(args)
+	if fl.NArg() != 2 {
+		fl.Usage()
+		os.Exit(2)
+	}
+
+	r := repair.Repairer{
+		Striper: stripe.Config{Min: *min, Excl: *excl},
+	}
+	if *parity != "" {
+		_, err = fmt.Sscanf(*parity, "%d %d", &r.NData, &r.NParity)
+		if err != nil {
+			return fmt.Errorf("invalid -parity %q: %v", *parity, err)
+		}
+	}
+
+	hashes, err := readIndexFile(fl.Arg(1))
+	if err != nil {
+		return
+	}
+
+	tmp, err := tmpdedup.TempDir("")
+	if err != nil {
+		return
+	}
+	defer tmp.Finish()
+
+	if *unprocStr != "" {
+		res, _, err := argproc.New(tmp, nil).Parse(*unprocStr)
+		if err != nil {
+			return err
+		}
+		r.Unproc = res.(procs.Proc)
+	}
+
+	res, _, err := argproc.NewStores(tmp).Parse(fl.Arg(0))
+	if err != nil {
+		return
+	}
+	r.Stores = res.([]stores.Named)
+	defer func() {
+		if e := removeLsCache(*lsCachePath, r.Stores); e != nil && err == nil {
+			err = e
+		}
+	}()
+
+	rep, err := r.Repair(hashes)
+	writeRepairReport(os.Stdout, rep)
+	if err == nil && (rep.Lost > 0 || len(rep.Failures) > 0) {
+		err = fmt.Errorf("repair incomplete: %d chunks lost, %d failures",
+			rep.Lost, len(rep.Failures))
+	}
+	return
+}
+
+func readIndexFile(path string) (hashes []checksum.Hash, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	it := index.NewScanner(0, f)
+	for it.Next() {
+		hashes = append(hashes, it.Chunk().Hash())
+	}
+	err = it.Err()
+	return
+}
+
+func writeRepairReport(w io.Writer, rep repair.Report) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	defer tw.Flush()
+	ids := make([]string, 0, len(rep.Copied))
+	for id := range rep.Copied {
+		ids = append(ids, fmt.Sprint(id))
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		sr := rep.Copied[id]
+		fmt.Fprintf(tw, "%s\tcopied %s\t(%d chunks)\n",
+			id, humanize.IBytes(uint64(sr.Bytes)), sr.Chunks,
+		)
+	}
+	fmt.Fprintf(tw, "\ngroups: %d, rebuilt: %d, lost: %d\n",
+		rep.Groups, rep.Rebuilt, rep.Lost,
+	)
+	for _, err := range rep.Failures {
+		fmt.Fprintf(tw, "error: %v\n", err)
+	}
+}
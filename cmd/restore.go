@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/pbtrung/scat"
+	"github.com/pbtrung/scat/argproc"
+	"github.com/pbtrung/scat/procs"
+	"github.com/pbtrung/scat/tmpdedup"
+)
+
+func restoreCommand(name string, args []string) (err error) {
+	fl := flag.NewFlagSet(name, flag.ExitOnError)
+	cfgPath := fl.String("config", os.Getenv(configEnv),
+		"config file of stores, chains and vars referenced as @name")
+	runFl := runFlags{}
+	runFl.register(fl)
+	fl.Usage = func() {
+		w := fl.Output()
+		fmt.Fprintf(w, "usage: %s [options] <proc> [index]\n", name)
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "Restores to stdout the backup made with proc string\n")
+		fmt.Fprintf(w, "<proc> from its index (default: stdin), deriving the\n")
+		fmt.Fprintf(w, "restore chain from <proc>.\n")
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "options:\n")
+		fl.PrintDefaults()
+	}
+	fl.Parse(args)
+	if fl.NArg() < 1 || fl.NArg() > 2 {
+		fl.Usage()
+		os.Exit(2)
+	}
+	procStr, err := expandProcStr(*cfgPath, fl.Arg(0))
+	if err != nil {
+		return
+	}
+
+	var r io.Reader = os.Stdin
+	if fl.NArg() == 2 {
+		f, err := os.Open(fl.Arg(1))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	idx, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+
+	tmp, err := tmpdedup.TempDir("")
+	if err != nil {
+		return
+	}
+	defer tmp.Finish()
+	opts := argproc.Options{}
+	err = runFl.open(&opts)
+	if err != nil {
+		return
+	}
+	defer runFl.close()
+	return restore(tmp, procStr, idx, opts)
+}
+
+// Runs the restore chain derived from backup proc string procStr over idx,
+// writing the restored stream to stdout.
+func restore(tmp *tmpdedup.Dir, procStr string, idx []byte,
+	opts argproc.Options,
+) error {
+	argRestore := argproc.NewRestoreWithOptions(tmp, nil, os.Stdout, opts)
+	res, _, err := argRestore.Parse(procStr)
+	if err != nil {
+		return err
+	}
+	seed := scat.NewChunk(0, scat.BytesData(idx))
+	return procs.Process(res.(procs.Proc), seed)
+}
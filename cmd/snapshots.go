@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pbtrung/scat"
+	"github.com/pbtrung/scat/argproc"
+	"github.com/pbtrung/scat/procs"
+	"github.com/pbtrung/scat/stores"
+	"github.com/pbtrung/scat/stores/snapshot"
+	"github.com/pbtrung/scat/tmpdedup"
+)
+
+var snapshotsCommands = map[string]command{
+	"init":    snapshotsInit,
+	"save":    snapshotsSave,
+	"list":    snapshotsList,
+	"show":    snapshotsShow,
+	"cat":     snapshotsCat,
+	"forget":  snapshotsForget,
+	"restore": snapshotsRestore,
+}
+
+func snapshotsCommand(name string, args []string) error {
+	if len(args) > 0 {
+		if cmd, ok := snapshotsCommands[args[0]]; ok {
+			return cmd(name+" "+args[0], args[1:])
+		}
+	}
+	names := make([]string, 0, len(snapshotsCommands))
+	for n := range snapshotsCommands {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(os.Stderr, "usage: %s <command> [options] <repo> ...\n", name)
+	fmt.Fprintf(os.Stderr, "commands: %s\n", strings.Join(names, ", "))
+	os.Exit(2)
+	return nil
+}
+
+func snapshotsFlags(name, argsUsage, desc string) *flag.FlagSet {
+	fl := flag.NewFlagSet(name, flag.ExitOnError)
+	fl.Usage = func() {
+		w := fl.Output()
+		fmt.Fprintf(w, "usage: %s [options] %s\n", name, argsUsage)
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, desc)
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "options:\n")
+		fl.PrintDefaults()
+	}
+	return fl
+}
+
+func parseNArgs(fl *flag.FlagSet, args []string, min, max int) {
+	fl.Parse(args)
+	if fl.NArg() < min || (max >= 0 && fl.NArg() > max) {
+		fl.Usage()
+		os.Exit(2)
+	}
+}
+
+type tagsFlag []string
+
+func (t *tagsFlag) String() string {
+	return strings.Join(*t, ",")
+}
+
+func (t *tagsFlag) Set(val string) error {
+	*t = append(*t, val)
+	return nil
+}
+
+// Opens the repository at dir and parses its stores.
+func openSnapshotRepo(dir string, tmp *tmpdedup.Dir) (
+	repo snapshot.Repo, strs []stores.Named, err error,
+) {
+	repo, err = snapshot.Open(dir)
+	if err != nil {
+		return
+	}
+	res, _, err := argproc.NewStores(tmp).Parse(repo.Config.Stores)
+	if err != nil {
+		return
+	}
+	strs = res.([]stores.Named)
+	return
+}
+
+func snapshotsInit(name string, args []string) (err error) {
+	fl := snapshotsFlags(name, "<repo> <stores>",
+		"Creates a snapshot repository in directory <repo>, writing indexes\n"+
+			"to <stores>: id=store pairs, as in multireader()")
+	parseNArgs(fl, args, 2, 2)
+
+	tmp, err := tmpdedup.TempDir("")
+	if err != nil {
+		return
+	}
+	defer tmp.Finish()
+	_, _, err = argproc.NewStores(tmp).Parse(fl.Arg(1))
+	if err != nil {
+		return
+	}
+	_, err = snapshot.Init(fl.Arg(0), snapshot.Config{Stores: fl.Arg(1)})
+	return
+}
+
+func snapshotsSave(name string, args []string) (err error) {
+	fl := snapshotsFlags(name, "<repo> <proc> <index>",
+		"Stores <index> (- for stdin) in <repo> as a snapshot of a backup\n"+
+			"made with proc string <proc>.")
+	tags := tagsFlag{}
+	fl.Var(&tags, "tag", "tag of the snapshot, may be repeated")
+	unproc := fl.String("unproc", "", "restore proc string")
+	parseNArgs(fl, args, 3, 3)
+
+	var r io.Reader = os.Stdin
+	if path := fl.Arg(2); path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	tmp, err := tmpdedup.TempDir("")
+	if err != nil {
+		return
+	}
+	defer tmp.Finish()
+	repo, strs, err := openSnapshotRepo(fl.Arg(0), tmp)
+	if err != nil {
+		return
+	}
+	hashes, err := snapshot.PutIndex(r, strs)
+	if err != nil {
+		return
+	}
+	snap := snapshot.Snapshot{
+		Time:   time.Now(),
+		Tags:   tags,
+		Proc:   fl.Arg(1),
+		Unproc: *unproc,
+		Index:  hashes,
+	}
+	err = repo.Save(&snap)
+	if err != nil {
+		return
+	}
+	fmt.Println(snap.Id)
+	return
+}
+
+func snapshotsList(name string, args []string) (err error) {
+	fl := snapshotsFlags(name, "<repo>", "Lists snapshots, oldest first.")
+	tag := fl.String("tag", "", "only list snapshots having this tag")
+	parseNArgs(fl, args, 1, 1)
+
+	repo, err := snapshot.Open(fl.Arg(0))
+	if err != nil {
+		return
+	}
+	snaps, err := repo.List()
+	if err != nil {
+		return
+	}
+	writeSnapshots(os.Stdout, filterTag(snaps, *tag))
+	return
+}
+
+func filterTag(snaps []snapshot.Snapshot, tag string) []snapshot.Snapshot {
+	if tag == "" {
+		return snaps
+	}
+	res := []snapshot.Snapshot{}
+	for _, s := range snaps {
+		if s.HasTag(tag) {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+func writeSnapshots(w io.Writer, snaps []snapshot.Snapshot) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	defer tw.Flush()
+	fmt.Fprintf(tw, "id\ttime\ttags\n")
+	for _, s := range snaps {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n",
+			s.Id, s.Time.Local().Format(time.RFC3339), strings.Join(s.Tags, ","),
+		)
+	}
+}
+
+func snapshotsShow(name string, args []string) (err error) {
+	fl := snapshotsFlags(name, "<repo> <id>",
+		"Shows details of a snapshot. <id> may be a unique prefix.")
+	parseNArgs(fl, args, 2, 2)
+
+	repo, err := snapshot.Open(fl.Arg(0))
+	if err != nil {
+		return
+	}
+	s, err := repo.Get(fl.Arg(1))
+	if err != nil {
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	defer tw.Flush()
+	fmt.Fprintf(tw, "id:\t%s\n", s.Id)
+	fmt.Fprintf(tw, "time:\t%s\n", s.Time.Local().Format(time.RFC3339))
+	fmt.Fprintf(tw, "tags:\t%s\n", strings.Join(s.Tags, ","))
+	fmt.Fprintf(tw, "index chunks:\t%d\n", len(s.Index))
+	fmt.Fprintf(tw, "proc:\t%s\n", s.Proc)
+	if s.Unproc != "" {
+		fmt.Fprintf(tw, "unproc:\t%s\n", s.Unproc)
+	}
+	return
+}
+
+// Reads the index of the snapshot with the given id from the stores of the
+// repository at dir.
+func getSnapshotIndex(dir, id string, tmp *tmpdedup.Dir, w io.Writer) (
+	snap snapshot.Snapshot, err error,
+) {
+	repo, strs, err := openSnapshotRepo(dir, tmp)
+	if err != nil {
+		return
+	}
+	snap, err = repo.Get(id)
+	if err != nil {
+		return
+	}
+	err = snapshot.GetIndex(snap.Index, strs, w)
+	return
+}
+
+func snapshotsCat(name string, args []string) (err error) {
+	fl := snapshotsFlags(name, "<repo> <id>",
+		"Writes the index of a snapshot to stdout.")
+	parseNArgs(fl, args, 2, 2)
+
+	tmp, err := tmpdedup.TempDir("")
+	if err != nil {
+		return
+	}
+	defer tmp.Finish()
+	_, err = getSnapshotIndex(fl.Arg(0), fl.Arg(1), tmp, os.Stdout)
+	return
+}
+
+func snapshotsForget(name string, args []string) (err error) {
+	fl := snapshotsFlags(name, "<repo> [id...]",
+		"Removes the given snapshots, or those not kept by -keep-* options.\n"+
+			"Chunks are left on stores: see gc -repo.")
+	pol := snapshot.Policy{}
+	fl.IntVar(&pol.Last, "keep-last", 0, "keep the last `n` snapshots")
+	fl.IntVar(&pol.Daily, "keep-daily", 0,
+		"keep the last snapshot of each of the last `n` days")
+	fl.IntVar(&pol.Weekly, "keep-weekly", 0,
+		"keep the last snapshot of each of the last `n` weeks")
+	fl.IntVar(&pol.Monthly, "keep-monthly", 0,
+		"keep the last snapshot of each of the last `n` months")
+	tag := fl.String("tag", "", "only consider snapshots having this tag")
+	dryRun := fl.Bool("dry-run", false, "only list what would be removed")
+	parseNArgs(fl, args, 1, -1)
+
+	repo, err := snapshot.Open(fl.Arg(0))
+	if err != nil {
+		return
+	}
+	var forget []snapshot.Snapshot
+	if ids := fl.Args()[1:]; len(ids) > 0 {
+		if !pol.IsZero() {
+			return fmt.Errorf("snapshot ids and -keep-* options are exclusive")
+		}
+		for _, id := range ids {
+			s, err := repo.Get(id)
+			if err != nil {
+				return fmt.Errorf("%s: %v", id, err)
+			}
+			forget = append(forget, s)
+		}
+	} else {
+		if pol.IsZero() {
+			return fmt.Errorf("no snapshot ids nor -keep-* options")
+		}
+		snaps, err := repo.List()
+		if err != nil {
+			return err
+		}
+		_, forget = pol.Apply(filterTag(snaps, *tag))
+	}
+	for _, s := range forget {
+		if !*dryRun {
+			err = repo.Remove(s.Id)
+			if err != nil {
+				return
+			}
+		}
+		fmt.Println(s.Id)
+	}
+	return
+}
+
+func snapshotsRestore(name string, args []string) (err error) {
+	fl := snapshotsFlags(name, "<repo> <id>",
+		"Restores a snapshot with its restore proc string or, if it has\n"+
+			"none, the restore chain derived from its backup proc string.")
+	runFl := runFlags{}
+	runFl.register(fl)
+	parseNArgs(fl, args, 2, 2)
+
+	tmp, err := tmpdedup.TempDir("")
+	if err != nil {
+		return
+	}
+	defer tmp.Finish()
+	idx := &bytes.Buffer{}
+	snap, err := getSnapshotIndex(fl.Arg(0), fl.Arg(1), tmp, idx)
+	if err != nil {
+		return
+	}
+	opts := argproc.Options{}
+	err = runFl.open(&opts)
+	if err != nil {
+		return
+	}
+	defer runFl.close()
+	if snap.Unproc == "" {
+		return restore(tmp, snap.Proc, idx.Bytes(), opts)
+	}
+	res, _, err := argproc.NewWithOptions(tmp, nil, opts).Parse(snap.Unproc)
+	if err != nil {
+		return
+	}
+	seed := scat.NewChunk(0, scat.BytesData(idx.Bytes()))
+	return procs.Process(res.(procs.Proc), seed)
+}
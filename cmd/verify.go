@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/pbtrung/scat/argproc"
+	"github.com/pbtrung/scat/checksum"
+	"github.com/pbtrung/scat/procs"
+	"github.com/pbtrung/scat/stores"
+	"github.com/pbtrung/scat/stores/verify"
+	"github.com/pbtrung/scat/tmpdedup"
+)
+
+func verifyCommand(name string, args []string) (err error) {
+	fl := flag.NewFlagSet(name, flag.ExitOnError)
+	lsOnly := fl.Bool("ls", false,
+		"only check presence and size in listings, don't download")
+	unprocStr := fl.String("unproc", "",
+		"proc string applied to downloaded chunks before verification")
+	fl.Usage = func() {
+		w := fl.Output()
+		fmt.Fprintf(w, "usage: %s [options] <stores> <index>\n", name)
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "Checks the integrity of chunks of <index> on every\n")
+		fmt.Fprintf(w, "store listing them.\n")
+		fmt.Fprintf(w, "<stores>: id=store pairs, as in multireader()\n")
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "options:\n")
+		fl.PrintDefaults()
+	}
+	fl.Parse(args)
+	if fl.NArg() != 2 {
+		fl.Usage()
+		os.Exit(2)
+	}
+
+	hashes, err := func() (_ []checksum.Hash, err error) {
+		f, err := os.Open(fl.Arg(1))
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		return verify.ReadIndex(f)
+	}()
+	if err != nil {
+		return
+	}
+
+	tmp, err := tmpdedup.TempDir("")
+	if err != nil {
+		return
+	}
+	defer tmp.Finish()
+
+	v := verify.Verifier{LsOnly: *lsOnly}
+	if *unprocStr != "" {
+		res, _, err := argproc.New(tmp, nil).Parse(*unprocStr)
+		if err != nil {
+			return err
+		}
+		v.Unproc = res.(procs.Proc)
+		defer v.Unproc.Finish()
+	}
+	res, _, err := argproc.NewStores(tmp).Parse(fl.Arg(0))
+	if err != nil {
+		return
+	}
+	for _, n := range res.([]stores.Named) {
+		v.Stores = append(v.Stores, verify.Store{n.Id(), n.Store, n.Unproc()})
+	}
+
+	result, err := v.Verify(hashes)
+	if err != nil {
+		return
+	}
+	writeVerifyResult(os.Stdout, result)
+	if result.Lost > 0 {
+		err = fmt.Errorf("%d chunks not found on any store", result.Lost)
+		return
+	}
+	for _, r := range result.Stores {
+		if r.Corrupt > 0 || r.Missing > 0 {
+			err = fmt.Errorf("verification failed")
+			return
+		}
+	}
+	return
+}
+
+func writeVerifyResult(w io.Writer, res verify.Result) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	defer tw.Flush()
+	fmt.Fprintf(tw, "store\tok\tcorrupt\tmissing\n")
+	for _, r := range res.Stores {
+		fmt.Fprintf(tw, "%v\t%d\t%d\t%d\n", r.Id, r.Ok, r.Corrupt, r.Missing)
+	}
+	fmt.Fprintf(tw, "\nchunks: %d, lost: %d\n", res.Chunks, res.Lost)
+}
@@ -0,0 +1,330 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4"
+	"github.com/ulikunitz/xz"
+)
+
+// Compressed data is framed with a one-byte header identifying the codec that
+// wrote it, so that Decompress() can restore any chunk regardless of the codec
+// used at the time. Codec IDs never collide with the first byte of the gzip
+// magic number so that raw gzip data, as written by NewGzipRaw(), can still be
+// told apart.
+type Codec byte
+
+const (
+	None Codec = iota
+	Gzip
+	Zstd
+	Lz4
+	Xz
+)
+
+const DefaultLevel = -1
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+
+	ErrUnknownCodec = errors.New("unknown compression codec")
+	ErrEmptyFrame   = errors.New("missing compression frame header")
+)
+
+var codecNames = map[Codec]string{
+	None: "none",
+	Gzip: "gzip",
+	Zstd: "zstd",
+	Lz4:  "lz4",
+	Xz:   "xz",
+}
+
+func (c Codec) String() string {
+	if name, ok := codecNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("codec(%d)", byte(c))
+}
+
+func ParseCodec(name string) (Codec, error) {
+	for c, n := range codecNames {
+		if n == name {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("%v: %q", ErrUnknownCodec, name)
+}
+
+type Compressor interface {
+	Codec() Codec
+	Compress([]byte) ([]byte, error)
+}
+
+// Returns a compressor for the given codec. Level semantics are those of the
+// underlying codec; DefaultLevel picks the codec's default.
+func New(codec Codec, level int) (Compressor, error) {
+	switch codec {
+	case None:
+		return noneComp{}, nil
+	case Gzip:
+		if level == DefaultLevel {
+			level = gzip.DefaultCompression
+		}
+		if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+			return nil, fmt.Errorf("invalid gzip level: %d", level)
+		}
+		return gzipComp{level}, nil
+	case Zstd:
+		zlevel := zstd.SpeedDefault
+		if level != DefaultLevel {
+			if level < 1 || level > 22 {
+				return nil, fmt.Errorf("invalid zstd level: %d", level)
+			}
+			zlevel = zstd.EncoderLevelFromZstd(level)
+		}
+		enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zlevel))
+		if err != nil {
+			return nil, err
+		}
+		return zstdComp{enc}, nil
+	case Lz4:
+		if level == DefaultLevel {
+			level = 0
+		}
+		if level < 0 || level > 16 {
+			return nil, fmt.Errorf("invalid lz4 level: %d", level)
+		}
+		return lz4Comp{level}, nil
+	case Xz:
+		if level == DefaultLevel {
+			level = 6
+		}
+		if level < 0 || level > 9 {
+			return nil, fmt.Errorf("invalid xz level: %d", level)
+		}
+		return xzComp{xzDictCaps[level]}, nil
+	}
+	return nil, ErrUnknownCodec
+}
+
+// Dictionary sizes of xz(1) presets -0 through -9
+var xzDictCaps = [...]int{
+	256 << 10, 1 << 20, 2 << 20, 4 << 20, 4 << 20,
+	8 << 20, 8 << 20, 16 << 20, 32 << 20, 64 << 20,
+}
+
+// Compressed output must be at most this fraction of the input size to be worth
+// keeping over the original.
+const DefaultMaxRatio = 0.95
+
+// Size of the leading sample compressed first when input is large enough, to
+// avoid compressing whole chunks of already-compressed media for nothing.
+const sampleSize = 64 * 1024
+
+type skipComp struct {
+	Compressor
+	maxRatio float64
+}
+
+// Wraps a compressor so as to store data as-is (codec None) when compression
+// doesn't shrink it to at most maxRatio of its original size.
+func SkipIncompressible(c Compressor, maxRatio float64) Compressor {
+	return skipComp{c, maxRatio}
+}
+
+func (c skipComp) Compress(b []byte) ([]byte, error) {
+	if len(b) >= 2*sampleSize {
+		sample, err := c.Compressor.Compress(b[:sampleSize])
+		if err != nil {
+			return nil, err
+		}
+		if !c.worth(sample, sampleSize) {
+			return frame(None, b), nil
+		}
+	}
+	out, err := c.Compressor.Compress(b)
+	if err != nil {
+		return nil, err
+	}
+	if !c.worth(out, len(b)) {
+		return frame(None, b), nil
+	}
+	return out, nil
+}
+
+func (c skipComp) worth(out []byte, inLen int) bool {
+	return float64(len(out)) <= float64(inLen)*c.maxRatio
+}
+
+func frame(codec Codec, payload []byte) []byte {
+	out := make([]byte, 1+len(payload))
+	out[0] = byte(codec)
+	copy(out[1:], payload)
+	return out
+}
+
+func Decompress(data []byte) ([]byte, error) {
+	if bytes.HasPrefix(data, gzipMagic) {
+		return gunzip(data)
+	}
+	if len(data) < 1 {
+		return nil, ErrEmptyFrame
+	}
+	codec, payload := Codec(data[0]), data[1:]
+	switch codec {
+	case None:
+		return payload, nil
+	case Gzip:
+		return gunzip(payload)
+	case Zstd:
+		return zstdDec.DecodeAll(payload, nil)
+	case Lz4:
+		return ioutil.ReadAll(lz4.NewReader(bytes.NewReader(payload)))
+	case Xz:
+		r, err := xz.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.ReadAll(r)
+	}
+	return nil, fmt.Errorf("%v: %d", ErrUnknownCodec, byte(codec))
+}
+
+var zstdDec *zstd.Decoder
+
+func init() {
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		panic(err)
+	}
+	zstdDec = dec
+}
+
+func gunzip(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+type noneComp struct{}
+
+func (noneComp) Codec() Codec {
+	return None
+}
+
+func (noneComp) Compress(b []byte) ([]byte, error) {
+	return frame(None, b), nil
+}
+
+type gzipComp struct {
+	level int
+}
+
+func (gzipComp) Codec() Codec {
+	return Gzip
+}
+
+func (c gzipComp) Compress(b []byte) ([]byte, error) {
+	return compressWriter(Gzip, b, func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriterLevel(w, c.level)
+	})
+}
+
+// NewGzipRaw returns a gzip compressor writing unframed streams, as did the
+// gzip proc before framing, for chunks to keep their hashes across versions.
+// Decompress() tells them apart by the gzip magic number.
+func NewGzipRaw(level int) (Compressor, error) {
+	c, err := New(Gzip, level)
+	if err != nil {
+		return nil, err
+	}
+	return rawGzipComp{c.(gzipComp)}, nil
+}
+
+type rawGzipComp struct {
+	gzipComp
+}
+
+func (c rawGzipComp) Compress(b []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, len(b)/2))
+	err := writeCompressed(buf, b, func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriterLevel(w, c.level)
+	})
+	return buf.Bytes(), err
+}
+
+type zstdComp struct {
+	enc *zstd.Encoder
+}
+
+func (zstdComp) Codec() Codec {
+	return Zstd
+}
+
+func (c zstdComp) Compress(b []byte) ([]byte, error) {
+	dst := make([]byte, 1, 1+len(b)/2)
+	dst[0] = byte(Zstd)
+	return c.enc.EncodeAll(b, dst), nil
+}
+
+type lz4Comp struct {
+	level int
+}
+
+func (lz4Comp) Codec() Codec {
+	return Lz4
+}
+
+func (c lz4Comp) Compress(b []byte) ([]byte, error) {
+	return compressWriter(Lz4, b, func(w io.Writer) (io.WriteCloser, error) {
+		zw := lz4.NewWriter(w)
+		zw.Header.CompressionLevel = c.level
+		return zw, nil
+	})
+}
+
+type xzComp struct {
+	dictCap int
+}
+
+func (xzComp) Codec() Codec {
+	return Xz
+}
+
+func (c xzComp) Compress(b []byte) ([]byte, error) {
+	return compressWriter(Xz, b, func(w io.Writer) (io.WriteCloser, error) {
+		return xz.WriterConfig{DictCap: c.dictCap}.NewWriter(w)
+	})
+}
+
+type newWriterFn func(io.Writer) (io.WriteCloser, error)
+
+func compressWriter(codec Codec, b []byte, newWriter newWriterFn) (
+	[]byte, error,
+) {
+	buf := bytes.NewBuffer(make([]byte, 0, 1+len(b)/2))
+	buf.WriteByte(byte(codec))
+	err := writeCompressed(buf, b, newWriter)
+	return buf.Bytes(), err
+}
+
+func writeCompressed(buf *bytes.Buffer, b []byte, newWriter newWriterFn,
+) error {
+	w, err := newWriter(buf)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	if err != nil {
+		return err
+	}
+	return w.Close()
+}
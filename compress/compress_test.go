@@ -0,0 +1,132 @@
+package compress_test
+
+import (
+	"bytes"
+	gz "compress/gzip"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/pbtrung/scat/compress"
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestRoundTrip(t *testing.T) {
+	data := []byte(strings.Repeat("abcdefgh", 1024))
+	codecs := []compress.Codec{
+		compress.None, compress.Gzip, compress.Zstd, compress.Lz4, compress.Xz,
+	}
+	for _, codec := range codecs {
+		for _, level := range []int{compress.DefaultLevel, 1} {
+			comp, err := compress.New(codec, level)
+			assert.NoError(t, err)
+			assert.Equal(t, codec, comp.Codec())
+			out, err := comp.Compress(data)
+			assert.NoError(t, err)
+			assert.Equal(t, byte(codec), out[0])
+			if codec != compress.None {
+				assert.True(t, len(out) < len(data), codec.String())
+			}
+			res, err := compress.Decompress(out)
+			assert.NoError(t, err)
+			assert.Equal(t, data, res)
+		}
+	}
+}
+
+func TestInvalidLevel(t *testing.T) {
+	_, err := compress.New(compress.Gzip, 10)
+	assert.Error(t, err)
+	_, err = compress.New(compress.Zstd, 23)
+	assert.Error(t, err)
+	_, err = compress.New(compress.Xz, 10)
+	assert.Error(t, err)
+}
+
+func TestDecompressLegacyGzip(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := gz.NewWriter(buf)
+	_, err := w.Write([]byte("xxx"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	res, err := compress.Decompress(buf.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, "xxx", string(res))
+}
+
+func TestGzipRaw(t *testing.T) {
+	data := []byte(strings.Repeat("abcdefgh", 1024))
+	buf := &bytes.Buffer{}
+	w := gz.NewWriter(buf)
+	_, err := w.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+
+	// same bytes as written before framing
+	comp, err := compress.NewGzipRaw(compress.DefaultLevel)
+	assert.NoError(t, err)
+	assert.Equal(t, compress.Gzip, comp.Codec())
+	out, err := comp.Compress(data)
+	assert.NoError(t, err)
+	assert.Equal(t, buf.Bytes(), out)
+	res, err := compress.Decompress(out)
+	assert.NoError(t, err)
+	assert.Equal(t, data, res)
+
+	_, err = compress.NewGzipRaw(10)
+	assert.Error(t, err)
+}
+
+func TestDecompressErrors(t *testing.T) {
+	_, err := compress.Decompress(nil)
+	assert.Equal(t, compress.ErrEmptyFrame, err)
+	_, err = compress.Decompress([]byte{0xff, 'x'})
+	assert.Error(t, err)
+}
+
+func TestParseCodec(t *testing.T) {
+	codec, err := compress.ParseCodec("zstd")
+	assert.NoError(t, err)
+	assert.Equal(t, compress.Zstd, codec)
+	_, err = compress.ParseCodec("xxx")
+	assert.Error(t, err)
+}
+
+func TestSkipIncompressible(t *testing.T) {
+	gzip, err := compress.New(compress.Gzip, compress.DefaultLevel)
+	assert.NoError(t, err)
+	comp := compress.SkipIncompressible(gzip, compress.DefaultMaxRatio)
+	assert.Equal(t, compress.Gzip, comp.Codec())
+
+	test := func(data []byte, expected compress.Codec) {
+		out, err := comp.Compress(data)
+		assert.NoError(t, err)
+		assert.Equal(t, byte(expected), out[0])
+		if expected == compress.None {
+			assert.Equal(t, data, out[1:])
+		}
+		res, err := compress.Decompress(out)
+		assert.NoError(t, err)
+		assert.Equal(t, data, res)
+	}
+
+	random := make([]byte, 256*1024)
+	_, err = rand.New(rand.NewSource(0)).Read(random)
+	assert.NoError(t, err)
+	compressible := []byte(strings.Repeat("a", len(random)))
+
+	// small
+	test(random[:100], compress.None)
+	test(compressible[:100], compress.Gzip)
+
+	// large: sampled
+	test(random, compress.None)
+	test(compressible, compress.Gzip)
+
+	// large: compressible sample, incompressible rest
+	mixed := make([]byte, 64*1024, 64*1024+2*1024*1024)
+	mixed = append(mixed, make([]byte, 2*1024*1024)...)
+	_, err = rand.New(rand.NewSource(1)).Read(mixed[64*1024:])
+	assert.NoError(t, err)
+	test(mixed, compress.None)
+}
@@ -0,0 +1,154 @@
+// Package config loads named stores, store groups, chains and variables
+// referenced by proc strings as @name.
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Nested references deeper than this are assumed to be cycles.
+const maxDepth = 16
+
+// A reference starts a token: at the beginning of the string or after a
+// space, bracket, pipe or '=', so that @ in args (ex: user@host) isn't one.
+var refRe = regexp.MustCompile(`(^|[\s({|=])@([A-Za-z_][A-Za-z0-9_-]*)`)
+
+type Config struct {
+	Vars   map[string]string
+	Stores map[string]Store
+	Groups map[string][]string
+	Chains map[string]string
+}
+
+type Store struct {
+	Store string
+	Quota string // optional, as accepted by stripe() (ex: 7gib)
+}
+
+func Load(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := Parse(b)
+	if err != nil {
+		err = fmt.Errorf("%s: %v", path, err)
+	}
+	return cfg, err
+}
+
+func Parse(b []byte) (*Config, error) {
+	cfg := &Config{}
+	err := yaml.UnmarshalStrict(b, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, cfg.validate()
+}
+
+func (cfg *Config) validate() error {
+	seen := make(map[string]string)
+	add := func(kind, name string) error {
+		if prev, ok := seen[name]; ok {
+			return fmt.Errorf("%q defined as both %s and %s", name, prev, kind)
+		}
+		seen[name] = kind
+		return nil
+	}
+	for name := range cfg.Vars {
+		if err := add("var", name); err != nil {
+			return err
+		}
+	}
+	for name, st := range cfg.Stores {
+		if err := add("store", name); err != nil {
+			return err
+		}
+		if st.Store == "" {
+			return fmt.Errorf("store %q: missing store", name)
+		}
+	}
+	for name, members := range cfg.Groups {
+		if err := add("group", name); err != nil {
+			return err
+		}
+		for _, m := range members {
+			if _, ok := cfg.Stores[m]; !ok {
+				return fmt.Errorf("group %q: no such store: %q", name, m)
+			}
+		}
+	}
+	for name := range cfg.Chains {
+		if err := add("chain", name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Expand replaces references in str:
+//
+//	var    its value
+//	store  its id=store[=quota] pair, as in stripe() and multireader()
+//	group  the pairs of its stores
+//	chain  the chain, in braces
+//
+// References in values are expanded too.
+func (cfg *Config) Expand(str string) (string, error) {
+	return cfg.expand(str, 0)
+}
+
+func (cfg *Config) expand(str string, depth int) (res string, err error) {
+	if depth > maxDepth {
+		return "", fmt.Errorf("references nested too deep: %q", str)
+	}
+	res = refRe.ReplaceAllStringFunc(str, func(m string) string {
+		if err != nil {
+			return m
+		}
+		sub := refRe.FindStringSubmatch(m)
+		prefix, name := sub[1], sub[2]
+		val, ok := cfg.lookup(name)
+		if !ok {
+			err = fmt.Errorf("undefined reference: @%s", name)
+			return m
+		}
+		val, err = cfg.expand(val, depth+1)
+		return prefix + val
+	})
+	return
+}
+
+func (cfg *Config) lookup(name string) (string, bool) {
+	if v, ok := cfg.Vars[name]; ok {
+		return v, true
+	}
+	if _, ok := cfg.Stores[name]; ok {
+		return cfg.storePair(name), true
+	}
+	if members, ok := cfg.Groups[name]; ok {
+		pairs := make([]string, len(members))
+		for i, m := range members {
+			pairs[i] = cfg.storePair(m)
+		}
+		return strings.Join(pairs, " "), true
+	}
+	if c, ok := cfg.Chains[name]; ok {
+		return "{" + c + "}", true
+	}
+	return "", false
+}
+
+func (cfg *Config) storePair(name string) string {
+	st := cfg.Stores[name]
+	pair := name + "=" + st.Store
+	if st.Quota != "" {
+		pair += "=" + st.Quota
+	}
+	return pair
+}
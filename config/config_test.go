@@ -0,0 +1,83 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/pbtrung/scat/config"
+	assert "github.com/stretchr/testify/require"
+)
+
+const testConfig = `
+vars:
+  key: 00828C1D
+stores:
+  drive:
+    store: rclone(drive:tmp)
+    quota: 7gib
+  vps:
+    store: scp(me@bankmon tmp)
+groups:
+  offsite: [drive, vps]
+chains:
+  encrypt: cmd gpg --batch -e -r @key
+  upload: "@encrypt | concur 4 stripe(1 2 @offsite)"
+`
+
+func TestExpand(t *testing.T) {
+	cfg, err := config.Parse([]byte(testConfig))
+	assert.NoError(t, err)
+
+	res, err := cfg.Expand("checksum | @upload")
+	assert.NoError(t, err)
+	assert.Equal(t,
+		"checksum | {{cmd gpg --batch -e -r 00828C1D} | concur 4 stripe(1 2 "+
+			"drive=rclone(drive:tmp)=7gib vps=scp(me@bankmon tmp))}",
+		res,
+	)
+
+	res, err = cfg.Expand("multireader(@drive)")
+	assert.NoError(t, err)
+	assert.Equal(t, "multireader(drive=rclone(drive:tmp)=7gib)", res)
+
+	// not at the start of a token
+	res, err = cfg.Expand("scp(me@key tmp)")
+	assert.NoError(t, err)
+	assert.Equal(t, "scp(me@key tmp)", res)
+
+	_, err = cfg.Expand("@nope")
+	assert.Error(t, err)
+}
+
+func TestInvalid(t *testing.T) {
+	parse := func(str string) error {
+		_, err := config.Parse([]byte(str))
+		return err
+	}
+	assert.Error(t, parse("vars: {a: x}\nchains: {a: x}\n"))
+	assert.Error(t, parse("groups: {g: [nope]}\n"))
+	assert.Error(t, parse("stores: {s: {quota: 1gib}}\n"))
+	assert.Error(t, parse("unknown: 1\n"))
+
+	cfg, err := config.Parse([]byte("chains: {a: '@b', b: '@a'}\n"))
+	assert.NoError(t, err)
+	_, err = cfg.Expand("@a")
+	assert.Error(t, err)
+}
+
+func TestLoad(t *testing.T) {
+	f, err := ioutil.TempFile("", "")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(testConfig)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	cfg, err := config.Load(f.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, "00828C1D", cfg.Vars["key"])
+
+	_, err = config.Load(f.Name() + "-missing")
+	assert.Error(t, err)
+}
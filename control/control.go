@@ -0,0 +1,131 @@
+// Package control serves commands over a unix socket, to change concurrency
+// of a running process.
+//
+// Commands, one per line, each answered by lines of output:
+//
+//	ls             lists slots: name, size, slots in use
+//	set <name> <n> resizes the named slots to n
+//
+// Failed commands are answered by a line starting with "error: ".
+package control
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pbtrung/scat/slots"
+)
+
+const errPrefix = "error: "
+
+type Server struct {
+	l   net.Listener
+	reg *slots.Registry
+	wg  sync.WaitGroup
+}
+
+// Listen serves commands on a unix socket created at path, resizing slots of
+// reg. Any file left at path by a previous run is removed.
+func Listen(path string, reg *slots.Registry) (s *Server, err error) {
+	if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return
+	}
+	s = &Server{l: l, reg: reg}
+	s.wg.Add(1)
+	go s.serve()
+	return
+}
+
+// Close stops accepting connections and removes the socket.
+func (s *Server) Close() error {
+	err := s.l.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			s.handle(conn, conn)
+		}()
+	}
+}
+
+// Runs commands read from r until EOF, writing their output to w.
+func (s *Server) handle(r io.Reader, w io.Writer) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		args := strings.Fields(scanner.Text())
+		if len(args) == 0 {
+			continue
+		}
+		if err := s.run(args, w); err != nil {
+			fmt.Fprintf(w, "%s%v\n", errPrefix, err)
+		}
+	}
+}
+
+func (s *Server) run(args []string, w io.Writer) error {
+	switch cmd := args[0]; {
+	case cmd == "ls" && len(args) == 1:
+		for _, name := range s.reg.Names() {
+			sl := s.reg.Get(name)
+			fmt.Fprintf(w, "%s\t%d\t%d\n", name, sl.Cap(), sl.Used())
+		}
+		return nil
+	case cmd == "set" && len(args) == 3:
+		sl := s.reg.Get(args[1])
+		if sl == nil {
+			return fmt.Errorf("no such slots: %q", args[1])
+		}
+		n, err := strconv.Atoi(args[2])
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid size: %q", args[2])
+		}
+		sl.Resize(n)
+		fmt.Fprintln(w, "ok")
+		return nil
+	}
+	return fmt.Errorf("invalid command: %q", strings.Join(args, " "))
+}
+
+// Send runs cmd on the server listening at path, copying its output to w.
+func Send(path, cmd string, w io.Writer) error {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := fmt.Fprintln(conn, cmd); err != nil {
+		return err
+	}
+	if err := conn.(*net.UnixConn).CloseWrite(); err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, errPrefix) {
+			return errors.New(strings.TrimPrefix(line, errPrefix))
+		}
+		fmt.Fprintln(w, line)
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,58 @@
+package control_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pbtrung/scat/control"
+	"github.com/pbtrung/scat/slots"
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestControl(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ctl")
+
+	// stale socket file replaced
+	assert.NoError(t, ioutil.WriteFile(path, nil, 0644))
+
+	reg := slots.NewRegistry()
+	s := slots.New(2)
+	reg.Add("concur", s)
+	reg.Add("backlog", slots.New(4))
+	srv, err := control.Listen(path, reg)
+	assert.NoError(t, err)
+
+	send := func(cmd string) (string, error) {
+		buf := &bytes.Buffer{}
+		err := control.Send(path, cmd, buf)
+		return buf.String(), err
+	}
+
+	s.Take()
+	out, err := send("ls")
+	assert.NoError(t, err)
+	assert.Equal(t, "concur1\t2\t1\nbacklog1\t4\t0\n", out)
+
+	out, err = send("set concur1 8")
+	assert.NoError(t, err)
+	assert.Equal(t, "ok\n", out)
+	assert.Equal(t, 8, s.Cap())
+
+	_, err = send("set concur2 8")
+	assert.EqualError(t, err, `no such slots: "concur2"`)
+	_, err = send("set concur1 0")
+	assert.EqualError(t, err, `invalid size: "0"`)
+	_, err = send("resize concur1")
+	assert.EqualError(t, err, `invalid command: "resize concur1"`)
+
+	// socket removed
+	assert.NoError(t, srv.Close())
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,83 @@
+package index
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format versions. V1 indexes are bare entry lines. V2 ones start with
+// header lines prefixed with headerPrefix, and their entries carry the offset
+// and length of the tracked chunk in the original stream.
+const (
+	V1 = 1
+	V2 = 2
+)
+
+const headerPrefix = "#"
+
+// Header describes how a V2 index was produced. Zero values mean unknown or
+// not applicable (ex: NParity 0 when the chain doesn't parity-split).
+type Header struct {
+	Version     int
+	Created     time.Time
+	ScatVersion string
+	NData       int
+	NParity     int
+	SplitMin    uint
+	SplitMax    uint
+	Compress    string
+}
+
+func WriteHeader(w io.Writer, h Header) (err error) {
+	line := func(key string, val interface{}) {
+		if err != nil {
+			return
+		}
+		_, err = fmt.Fprintf(w, "%s%s %v\n", headerPrefix, key, val)
+	}
+	line("scat-index", V2)
+	line("created", h.Created.UTC().Format(time.RFC3339))
+	if h.ScatVersion != "" {
+		line("scat-version", h.ScatVersion)
+	}
+	if h.NParity > 0 {
+		line("parity", fmt.Sprintf("%d %d", h.NData, h.NParity))
+	}
+	if h.SplitMax > 0 {
+		line("split", fmt.Sprintf("%d %d", h.SplitMin, h.SplitMax))
+	}
+	if h.Compress != "" {
+		line("compress", h.Compress)
+	}
+	return
+}
+
+func (h *Header) parseLine(line string) (err error) {
+	line = strings.TrimPrefix(line, headerPrefix)
+	key, val := line, ""
+	if i := strings.IndexByte(line, ' '); i != -1 {
+		key, val = line[:i], line[i+1:]
+	}
+	switch key {
+	case "scat-index":
+		h.Version, err = strconv.Atoi(val)
+	case "created":
+		h.Created, err = time.Parse(time.RFC3339, val)
+	case "scat-version":
+		h.ScatVersion = val
+	case "parity":
+		_, err = fmt.Sscanf(val, "%d %d", &h.NData, &h.NParity)
+	case "split":
+		_, err = fmt.Sscanf(val, "%d %d", &h.SplitMin, &h.SplitMax)
+	case "compress":
+		h.Compress = val
+	}
+	// Unknown keys are ignored for forward compatibility
+	if err != nil {
+		err = fmt.Errorf("invalid index header %q: %v", key, err)
+	}
+	return
+}
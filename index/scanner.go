@@ -1,31 +1,42 @@
 package index
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
 	"io"
+	"strings"
 
 	"github.com/pbtrung/scat"
 	"github.com/pbtrung/scat/checksum"
 )
 
-type scanner struct {
-	r       io.Reader
+var errInvalidLine = errors.New("invalid index line")
+
+// Scanner reads entries of indexes of any version.
+type Scanner struct {
+	scan    *bufio.Scanner
 	hashBuf []byte
 	num     int
+	header  Header
+	entry   Entry
 	chunk   *scat.Chunk
 	err     error
 }
 
-func NewScanner(num int, r io.Reader) scat.ChunkIter {
-	return &scanner{
-		r:       r,
+var _ scat.ChunkIter = (*Scanner)(nil)
+
+func NewScanner(num int, r io.Reader) *Scanner {
+	return &Scanner{
+		scan:    bufio.NewScanner(r),
 		hashBuf: make([]byte, len(checksum.Hash{})),
 		num:     num,
+		header:  Header{Version: V1},
 	}
 }
 
-func (s *scanner) Next() bool {
-	err := s.scan()
+func (s *Scanner) Next() bool {
+	err := s.next()
 	if err != nil {
 		if err == io.EOF {
 			err = nil
@@ -36,32 +47,66 @@ func (s *scanner) Next() bool {
 	return true
 }
 
-func (s *scanner) scan() (err error) {
-	var size int
-	n, err := fmt.Fscanf(s.r, "%x %d\n", &s.hashBuf, &size)
+func (s *Scanner) next() error {
+	for s.scan.Scan() {
+		line := s.scan.Text()
+		if strings.HasPrefix(line, headerPrefix) {
+			err := s.header.parseLine(line)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		return s.parseEntry(line)
+	}
+	err := s.scan.Err()
+	if err == nil {
+		err = io.EOF
+	}
+	return err
+}
+
+func (s *Scanner) parseEntry(line string) (err error) {
+	var e Entry
+	fields := strings.Fields(line)
+	switch len(fields) {
+	case 2:
+		_, err = fmt.Sscanf(line, "%x %d", &s.hashBuf, &e.Size)
+	case 4:
+		_, err = fmt.Sscanf(line, "%x %d %d %d",
+			&s.hashBuf, &e.Size, &e.Offset, &e.Length)
+	default:
+		err = errInvalidLine
+	}
 	if err != nil {
 		return
 	}
-	if n != 2 {
-		return fmt.Errorf("invalid index line")
-	}
-	chunk := scat.NewChunk(s.num, nil)
-	chunk.SetTargetSize(size)
-	hash := checksum.Hash{}
-	err = hash.LoadSlice(s.hashBuf)
+	err = e.Hash.LoadSlice(s.hashBuf)
 	if err != nil {
 		return
 	}
-	chunk.SetHash(hash)
+	chunk := scat.NewChunk(s.num, nil)
+	chunk.SetTargetSize(e.Size)
+	chunk.SetHash(e.Hash)
+	s.entry = e
 	s.chunk = chunk
 	s.num++
 	return
 }
 
-func (s *scanner) Chunk() *scat.Chunk {
+func (s *Scanner) Chunk() *scat.Chunk {
 	return s.chunk
 }
 
-func (s *scanner) Err() error {
+func (s *Scanner) Entry() Entry {
+	return s.entry
+}
+
+// Header lines read so far. Complete once Next() has returned once.
+func (s *Scanner) Header() Header {
+	return s.header
+}
+
+func (s *Scanner) Err() error {
 	return s.err
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/pbtrung/scat/checksum"
 	"github.com/pbtrung/scat/index"
@@ -41,3 +42,66 @@ func TestScanner(t *testing.T) {
 	assert.False(t, scan.Next())
 	assert.NoError(t, scan.Err())
 }
+
+func TestScannerV2(t *testing.T) {
+	buf := &bytes.Buffer{}
+	created := time.Date(2017, 2, 1, 10, 17, 1, 0, time.UTC)
+	err := index.WriteHeader(buf, index.Header{
+		Created:     created,
+		ScatVersion: "4",
+		NData:       2,
+		NParity:     1,
+		SplitMin:    1024,
+		SplitMax:    4096,
+		Compress:    "zstd",
+	})
+	assert.NoError(t, err)
+	h1 := checksum.SumBytes([]byte("a"))
+	h2 := checksum.SumBytes([]byte("b"))
+	index.WriteEntry(buf, index.Entry{Hash: h1, Size: 10, Offset: 0, Length: 7})
+	index.WriteEntry(buf, index.Entry{Hash: h2, Size: 20, Offset: 7, Length: 3})
+	fmt.Fprintf(buf, "#unknown key\n")
+
+	scan := index.NewScanner(0, buf)
+	assert.True(t, scan.Next())
+	assert.Equal(t, index.Header{
+		Version:     index.V2,
+		Created:     created,
+		ScatVersion: "4",
+		NData:       2,
+		NParity:     1,
+		SplitMin:    1024,
+		SplitMax:    4096,
+		Compress:    "zstd",
+	}, scan.Header())
+	assert.Equal(t, index.Entry{Hash: h1, Size: 10, Length: 7}, scan.Entry())
+	assert.Equal(t, h1, scan.Chunk().Hash())
+	assert.Equal(t, 10, scan.Chunk().TargetSize())
+
+	assert.True(t, scan.Next())
+	assert.Equal(t, int64(7), scan.Entry().Offset)
+	assert.Equal(t, 3, scan.Entry().Length)
+	assert.Equal(t, 1, scan.Chunk().Num())
+
+	assert.False(t, scan.Next())
+	assert.NoError(t, scan.Err())
+}
+
+func TestScannerV1Header(t *testing.T) {
+	buf := &bytes.Buffer{}
+	index.Write(buf, checksum.SumBytes([]byte("a")), 1)
+	scan := index.NewScanner(0, buf)
+	assert.True(t, scan.Next())
+	assert.Equal(t, index.V1, scan.Header().Version)
+	assert.Equal(t, int64(0), scan.Entry().Offset)
+}
+
+func TestScannerInvalid(t *testing.T) {
+	scan := index.NewScanner(0, bytes.NewBufferString("abc\n"))
+	assert.False(t, scan.Next())
+	assert.Error(t, scan.Err())
+
+	scan = index.NewScanner(0, bytes.NewBufferString("#parity x\n"))
+	assert.False(t, scan.Next())
+	assert.Error(t, scan.Err())
+}
@@ -7,6 +7,22 @@ import (
 	"github.com/pbtrung/scat/checksum"
 )
 
+type Entry struct {
+	Hash checksum.Hash
+	Size int
+
+	// V2 only: position of the chunk tracked by index in the original stream.
+	// Entries of finals of the same tracked chunk share these.
+	Offset int64
+	Length int
+}
+
+// Writes a V1 entry
 func Write(w io.Writer, hash checksum.Hash, size int) (int, error) {
 	return fmt.Fprintf(w, "%x %d\n", hash, size)
 }
+
+// Writes a V2 entry, to follow a header written by WriteHeader()
+func WriteEntry(w io.Writer, e Entry) (int, error) {
+	return fmt.Fprintf(w, "%x %d %d %d\n", e.Hash, e.Size, e.Offset, e.Length)
+}
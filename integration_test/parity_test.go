@@ -7,6 +7,7 @@ import (
 
 	"github.com/pbtrung/scat"
 	"github.com/pbtrung/scat/checksum"
+	"github.com/pbtrung/scat/compress"
 	"github.com/pbtrung/scat/procs"
 	"github.com/pbtrung/scat/stores"
 	"github.com/klauspost/reedsolomon"
@@ -55,6 +56,8 @@ func testParity(t *testing.T, cor corruption) {
 
 	parity, err := procs.NewParity(ndata, nparity)
 	assert.NoError(t, err)
+	gzip, err := procs.NewCompress(compress.Gzip, compress.DefaultLevel)
+	assert.NoError(t, err)
 
 	indexBuf := &bytes.Buffer{}
 	store := stores.NewMem()
@@ -66,7 +69,7 @@ func testParity(t *testing.T, cor corruption) {
 		procs.ChecksumProc,
 		procs.NewIndexProc(indexBuf),
 		parity.Proc(),
-		procs.Gzip{}.Proc(),
+		gzip.Proc(),
 		procs.ChecksumProc,
 		store.Proc(),
 	}
@@ -120,7 +123,7 @@ func testParity(t *testing.T, cor corruption) {
 		procs.IndexUnproc,
 		storeUnproc,
 		procs.ChecksumUnproc,
-		procs.Gzip{}.Unproc(),
+		gzip.Unproc(),
 		procs.NewGroup(ndata + nparity),
 		parity.Unproc(),
 		procs.WriterTo{outBuf},
@@ -0,0 +1,237 @@
+// Package journal persists the progress of a backup, so that a resumed run
+// neither relists stores nor reprocesses chunks already fully written.
+//
+// A journal is an append-only text file of lines:
+//
+//	c <store id> <hash> <size>       chunk copy on a store
+//	l <store id>                     copies of the store fully listed
+//	d <hash> <final hash> <size>...  chunk fully processed, with its finals
+//
+// Lines are only written whole. An incomplete last line, left by a crash, is
+// dropped on Open.
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pbtrung/scat/checksum"
+)
+
+type Entry struct {
+	Hash checksum.Hash
+	Size int64
+}
+
+// Final is a chunk output by the processing of another one, as recorded by
+// index.
+type Final struct {
+	Hash       checksum.Hash
+	TargetSize int
+}
+
+type Journal struct {
+	f      *os.File
+	mu     sync.Mutex
+	copies map[string]map[checksum.Hash]int64
+	listed map[string]bool
+	done   map[checksum.Hash][]Final
+}
+
+func Open(path string) (j *Journal, err error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return
+	}
+	j = &Journal{
+		f:      f,
+		copies: make(map[string]map[checksum.Hash]int64),
+		listed: make(map[string]bool),
+		done:   make(map[checksum.Hash][]Final),
+	}
+	err = j.load()
+	if err != nil {
+		f.Close()
+		j = nil
+		err = fmt.Errorf("journal %s: %v", path, err)
+	}
+	return
+}
+
+func (j *Journal) load() error {
+	rd := bufio.NewReader(j.f)
+	size := int64(0)
+	for lineno := 1; ; lineno++ {
+		line, err := rd.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		err = j.parseLine(strings.TrimSuffix(line, "\n"))
+		if err != nil {
+			return fmt.Errorf("line %d: %v", lineno, err)
+		}
+		size += int64(len(line))
+	}
+	// drop any incomplete last line
+	err := j.f.Truncate(size)
+	if err != nil {
+		return err
+	}
+	_, err = j.f.Seek(size, io.SeekStart)
+	return err
+}
+
+func (j *Journal) parseLine(line string) (err error) {
+	var (
+		id   string
+		hash []byte
+		h    checksum.Hash
+	)
+	switch {
+	case strings.HasPrefix(line, "c "):
+		var size int64
+		_, err = fmt.Sscanf(line, "c %q %x %d", &id, &hash, &size)
+		if err == nil {
+			err = h.LoadSlice(hash)
+		}
+		if err == nil {
+			j.addCopy(id, Entry{h, size})
+		}
+	case strings.HasPrefix(line, "l "):
+		_, err = fmt.Sscanf(line, "l %q", &id)
+		if err == nil {
+			j.listed[id] = true
+		}
+	case strings.HasPrefix(line, "d "):
+		fields := strings.Fields(line[2:])
+		if len(fields)%2 != 1 {
+			return fmt.Errorf("invalid line: %q", line)
+		}
+		finals := make([]Final, len(fields)/2)
+		for i := range finals {
+			var f Final
+			f.Hash, err = parseHash(fields[1+i*2])
+			if err != nil {
+				return
+			}
+			f.TargetSize, err = strconv.Atoi(fields[2+i*2])
+			if err != nil {
+				return
+			}
+			finals[i] = f
+		}
+		h, err = parseHash(fields[0])
+		if err == nil {
+			j.done[h] = finals
+		}
+	default:
+		err = fmt.Errorf("invalid line: %q", line)
+	}
+	return
+}
+
+func parseHash(str string) (h checksum.Hash, err error) {
+	b, err := hex.DecodeString(str)
+	if err != nil {
+		return
+	}
+	err = h.LoadSlice(b)
+	return
+}
+
+func (j *Journal) addCopy(id string, e Entry) {
+	m, ok := j.copies[id]
+	if !ok {
+		m = make(map[checksum.Hash]int64)
+		j.copies[id] = m
+	}
+	m[e.Hash] = e.Size
+}
+
+func (j *Journal) write(b []byte) error {
+	_, err := j.f.Write(b)
+	return err
+}
+
+// Listed returns the copies on the store with the given id, if it was fully
+// listed: those listed and those added since.
+func (j *Journal) Listed(id string) (entries []Entry, ok bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if !j.listed[id] {
+		return
+	}
+	ok = true
+	entries = make([]Entry, 0, len(j.copies[id]))
+	for h, sz := range j.copies[id] {
+		entries = append(entries, Entry{h, sz})
+	}
+	return
+}
+
+// AddListing records the full listing of a store.
+func (j *Journal) AddListing(id string, entries []Entry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	buf := &bytes.Buffer{}
+	flush := func() error {
+		err := j.write(buf.Bytes())
+		buf.Reset()
+		return err
+	}
+	for _, e := range entries {
+		j.addCopy(id, e)
+		fmt.Fprintf(buf, "c %q %x %d\n", id, e.Hash, e.Size)
+		if buf.Len() >= 64*1024 {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	fmt.Fprintf(buf, "l %q\n", id)
+	j.listed[id] = true
+	return flush()
+}
+
+func (j *Journal) AddCopy(id string, e Entry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.addCopy(id, e)
+	return j.write([]byte(fmt.Sprintf("c %q %x %d\n", id, e.Hash, e.Size)))
+}
+
+// Done returns the finals of the chunk with the given hash if it was fully
+// processed.
+func (j *Journal) Done(h checksum.Hash) (finals []Final, ok bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	finals, ok = j.done[h]
+	return
+}
+
+func (j *Journal) AddDone(h checksum.Hash, finals []Final) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.done[h] = finals
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "d %x", h)
+	for _, f := range finals {
+		fmt.Fprintf(buf, " %x %d", f.Hash, f.TargetSize)
+	}
+	buf.WriteByte('\n')
+	return j.write(buf.Bytes())
+}
+
+func (j *Journal) Close() error {
+	return j.f.Close()
+}
@@ -0,0 +1,97 @@
+package journal_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pbtrung/scat/checksum"
+	"github.com/pbtrung/scat/journal"
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal")
+	ha := checksum.SumBytes([]byte("a"))
+	hb := checksum.SumBytes([]byte("b"))
+	hc := checksum.SumBytes([]byte("c"))
+
+	j, err := journal.Open(path)
+	assert.NoError(t, err)
+	_, ok := j.Listed("s1")
+	assert.False(t, ok)
+
+	// copies before the listing don't make a store listed
+	assert.NoError(t, j.AddCopy("s1", journal.Entry{hc, 3}))
+	_, ok = j.Listed("s1")
+	assert.False(t, ok)
+	assert.NoError(t, j.AddListing("s1", []journal.Entry{{ha, 1}}))
+	assert.NoError(t, j.AddCopy("s1", journal.Entry{hb, 2}))
+	assert.NoError(t, j.AddDone(ha, []journal.Final{{hb, 1}, {hc, 1}}))
+	assert.NoError(t, j.Close())
+
+	// reopen
+	j, err = journal.Open(path)
+	assert.NoError(t, err)
+	entries, ok := j.Listed("s1")
+	assert.True(t, ok)
+	assert.ElementsMatch(t, []journal.Entry{{ha, 1}, {hb, 2}, {hc, 3}},
+		entries)
+	_, ok = j.Listed("s2")
+	assert.False(t, ok)
+	finals, ok := j.Done(ha)
+	assert.True(t, ok)
+	assert.Equal(t, []journal.Final{{hb, 1}, {hc, 1}}, finals)
+	_, ok = j.Done(hb)
+	assert.False(t, ok)
+	assert.NoError(t, j.Close())
+}
+
+func TestJournalIncompleteLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal")
+	h := checksum.SumBytes([]byte("a"))
+
+	j, err := journal.Open(path)
+	assert.NoError(t, err)
+	assert.NoError(t, j.AddListing("s1", nil))
+	assert.NoError(t, j.Close())
+
+	// crash while writing
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	assert.NoError(t, err)
+	_, err = f.WriteString(`l "s2`)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	j, err = journal.Open(path)
+	assert.NoError(t, err)
+	_, ok := j.Listed("s2")
+	assert.False(t, ok)
+	assert.NoError(t, j.AddCopy("s1", journal.Entry{h, 1}))
+	assert.NoError(t, j.Close())
+
+	j, err = journal.Open(path)
+	assert.NoError(t, err)
+	entries, ok := j.Listed("s1")
+	assert.True(t, ok)
+	assert.Equal(t, []journal.Entry{{h, 1}}, entries)
+	assert.NoError(t, j.Close())
+}
+
+func TestJournalInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal")
+	err = ioutil.WriteFile(path, []byte("x\n"), 0644)
+	assert.NoError(t, err)
+	_, err = journal.Open(path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,46 @@
+package procs
+
+import (
+	"github.com/pbtrung/scat"
+	"github.com/pbtrung/scat/slots"
+)
+
+// Adaptive limits concurrency of Proc to adaptive slots, reporting the size
+// of output data and errors of each processed chunk.
+type Adaptive struct {
+	Proc
+	Slots *slots.Adaptive
+}
+
+var _ WrapperProc = Adaptive{}
+
+func (a Adaptive) Underlying() Proc {
+	return a.Proc
+}
+
+func (a Adaptive) Process(c *scat.Chunk) <-chan Res {
+	a.Slots.Take()
+	ch := a.Proc.Process(c)
+	out := make(chan Res)
+	go func() {
+		defer a.Slots.Release()
+		defer close(out)
+		var (
+			n   uint64
+			err error
+		)
+		for res := range ch {
+			if res.Err != nil && err == nil {
+				err = res.Err
+			}
+			if c := res.Chunk; c != nil {
+				if sz, ok := c.Data().(scat.Sizer); ok && sz.Size() > 0 {
+					n += uint64(sz.Size())
+				}
+			}
+			out <- res
+		}
+		a.Slots.Done(n, err)
+	}()
+	return out
+}
@@ -0,0 +1,51 @@
+package procs_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pbtrung/scat"
+	"github.com/pbtrung/scat/procs"
+	"github.com/pbtrung/scat/slots"
+	"github.com/pbtrung/scat/testutil"
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestAdaptive(t *testing.T) {
+	const window = 10 * time.Millisecond
+	s := slots.NewAdaptive(2, 4, window)
+	used := 0
+	someErr := errors.New("some err")
+	var err error
+	proc := procs.Adaptive{
+		Proc: procs.InplaceFunc(func(*scat.Chunk) error {
+			used = s.Used()
+			return err
+		}),
+		Slots: s,
+	}
+	process := func() error {
+		c := scat.NewChunk(0, scat.BytesData("abc"))
+		_, err := testutil.ReadChunks(proc.Process(c))
+		return err
+	}
+
+	// slot taken while processing
+	assert.NoError(t, process())
+	assert.Equal(t, 1, used)
+	assert.Equal(t, 0, s.Used())
+
+	// throughput reported: grown
+	time.Sleep(window)
+	assert.NoError(t, process())
+	assert.Equal(t, 3, s.Cap())
+
+	// errors reported: halved
+	err = someErr
+	assert.Equal(t, someErr, process())
+	time.Sleep(window)
+	err = nil
+	assert.NoError(t, process())
+	assert.Equal(t, 2, s.Cap())
+}
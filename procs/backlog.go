@@ -7,13 +7,18 @@ import (
 
 type backlog struct {
 	proc  Proc
-	slots slots.Slots
+	slots *slots.Slots
 }
 
 func NewBacklog(nslots int, proc Proc) Proc {
+	return NewBacklogSlots(slots.New(nslots), proc)
+}
+
+// Like NewBacklog() with slots that may be resized while running.
+func NewBacklogSlots(s *slots.Slots, proc Proc) Proc {
 	return backlog{
 		proc:  proc,
-		slots: slots.New(nslots),
+		slots: s,
 	}
 }
 
@@ -36,7 +41,7 @@ func (bl backlog) Finish() (err error) {
 	if err != nil {
 		return
 	}
-	if len(bl.slots) < cap(bl.slots) {
+	if bl.slots.Used() > 0 {
 		return ErrUnreturnedSlots
 	}
 	return
@@ -0,0 +1,87 @@
+package procs
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/pbtrung/scat"
+	"github.com/pbtrung/scat/catalog"
+)
+
+var (
+	errCatalogMultiple   = errors.New("catalog: only a single stream is supported")
+	errCatalogIncomplete = errors.New("catalog: stream not fully read")
+)
+
+type catalogProc struct {
+	w       io.Writer
+	mu      sync.Mutex
+	started bool
+	pw      *io.PipeWriter
+	done    chan error
+}
+
+// NewCatalog returns a proc writing to w the catalog of the tar stream in the
+// data of the chunk it processes, as that data gets read downstream (ex: by
+// split). Offsets are relative to the start of the stream, like those of V2
+// indexes.
+func NewCatalog(w io.Writer) Proc {
+	return &catalogProc{w: w, done: make(chan error, 1)}
+}
+
+func (cp *catalogProc) Process(c *scat.Chunk) <-chan Res {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.started {
+		return SingleRes(c, errCatalogMultiple)
+	}
+	cp.started = true
+	pr, pw := io.Pipe()
+	cp.pw = pw
+	go func() {
+		err := catalog.ScanTar(pr, func(e catalog.Entry) error {
+			return catalog.Write(cp.w, e)
+		})
+		if err == nil {
+			// trailing blocks
+			_, err = io.Copy(ioutil.Discard, pr)
+		}
+		// don't hold up the stream on error
+		pr.CloseWithError(err)
+		cp.done <- err
+	}()
+	tap := &tapReader{r: c.Data().Reader(), pw: pw}
+	return SingleRes(c.WithData(scat.NewReaderData(tap)), nil)
+}
+
+func (cp *catalogProc) Finish() error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.pw == nil {
+		return nil
+	}
+	// no-op if the stream was read to its end
+	cp.pw.CloseWithError(errCatalogIncomplete)
+	cp.pw = nil
+	return <-cp.done
+}
+
+// Copies data read from r to pw, ignoring write errors: those are reported
+// by Finish.
+type tapReader struct {
+	r  io.Reader
+	pw *io.PipeWriter
+}
+
+func (t *tapReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if n > 0 {
+		t.pw.Write(p[:n])
+	}
+	if err == io.EOF {
+		t.pw.Close()
+	}
+	return n, err
+}
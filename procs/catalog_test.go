@@ -0,0 +1,58 @@
+package procs_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"testing"
+
+	"github.com/pbtrung/scat"
+	"github.com/pbtrung/scat/catalog"
+	"github.com/pbtrung/scat/procs"
+	"github.com/pbtrung/scat/testutil"
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestCatalog(t *testing.T) {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, name := range []string{"a", "b"} {
+		err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: 3})
+		assert.NoError(t, err)
+		_, err = tw.Write([]byte(name + name + name))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tw.Close())
+	stream := buf.Bytes()
+
+	cat := &bytes.Buffer{}
+	out := &bytes.Buffer{}
+	proc := procs.Chain{
+		procs.NewCatalog(cat),
+		procs.Split,
+		procs.NewJoin(out),
+	}
+	seed := scat.NewChunk(0, scat.NewReaderData(bytes.NewReader(stream)))
+	_, err := testutil.ReadChunks(proc.Process(seed))
+	assert.NoError(t, err)
+	assert.NoError(t, proc.Finish())
+	assert.Equal(t, stream, out.Bytes())
+
+	entries, err := catalog.Read(cat)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, "b", entries[1].Path)
+	assert.Equal(t, int64(1024), entries[1].Offset)
+}
+
+func TestCatalogNotTar(t *testing.T) {
+	proc := procs.Chain{
+		procs.NewCatalog(&bytes.Buffer{}),
+		procs.NewJoin(&bytes.Buffer{}),
+	}
+	seed := scat.NewChunk(0, scat.NewReaderData(
+		bytes.NewReader(bytes.Repeat([]byte("x"), 2000)),
+	))
+	_, err := testutil.ReadChunks(proc.Process(seed))
+	assert.NoError(t, err)
+	assert.Error(t, proc.Finish())
+}
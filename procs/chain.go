@@ -49,12 +49,14 @@ func (procs Chain) Finish() error {
 func process(out chan<- Res, in <-chan Res, proc Proc) {
 	defer close(out)
 	wg := sync.WaitGroup{}
+	failed := false
 	for res := range in {
 		var ch <-chan Res
 		if res.Err != nil {
 			if errp, ok := underlying(proc).(ErrProc); ok && res.Chunk != nil {
 				ch = errp.ProcessErr(res.Chunk, res.Err)
 			} else {
+				failed = true
 				out <- res
 				continue
 			}
@@ -70,7 +72,8 @@ func process(out chan<- Res, in <-chan Res, proc Proc) {
 		}()
 	}
 	wg.Wait()
-	if ecp, ok := proc.(endCallProc); ok {
+	// a chunk isn't fully processed if some of its finals failed
+	if ecp, ok := proc.(endCallProc); ok && !failed {
 		err := ecp.processEnd()
 		if err != nil {
 			out <- Res{Err: err}
@@ -87,6 +87,26 @@ func TestChainEndProc(t *testing.T) {
 	assert.Equal(t, []int{22, 33}, ends[chunk])
 }
 
+func TestChainEndProcErr(t *testing.T) {
+	someErr := errors.New("some err")
+	ended := false
+	a := enderProc{
+		proc:    procs.Nop,
+		onFinal: func(c, final *scat.Chunk) error { return nil },
+		onEnd: func(c *scat.Chunk) error {
+			ended = true
+			return nil
+		},
+	}
+	errp := procs.InplaceFunc(func(*scat.Chunk) error {
+		return someErr
+	})
+	chain := procs.Chain{a, errp}
+	err := getErr(t, chain.Process(scat.NewChunk(0, nil)))
+	assert.Equal(t, someErr, err)
+	assert.False(t, ended)
+}
+
 func TestChainErrRecovery(t *testing.T) {
 	someErr := errors.New("some err")
 	okCount := 0
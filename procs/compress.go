@@ -0,0 +1,60 @@
+package procs
+
+import (
+	"github.com/pbtrung/scat"
+	"github.com/pbtrung/scat/compress"
+)
+
+type comp struct {
+	comp compress.Compressor
+}
+
+// Chunks that don't compress well are stored as-is, marked as such in the
+// frame header for Unproc() to tell them apart. Gzip output is unframed and
+// never skipped, as before framing, for chunks of existing backups to dedup.
+func NewCompress(codec compress.Codec, level int) (ProcUnprocer, error) {
+	if codec == compress.Gzip {
+		c, err := compress.NewGzipRaw(level)
+		if err != nil {
+			return nil, err
+		}
+		return comp{c}, nil
+	}
+	c, err := compress.New(codec, level)
+	if err != nil {
+		return nil, err
+	}
+	c = compress.SkipIncompressible(c, compress.DefaultMaxRatio)
+	return comp{c}, nil
+}
+
+func (c comp) Proc() Proc {
+	return ChunkFunc(c.process)
+}
+
+// Unproc decompresses data written by any codec.
+func (comp) Unproc() Proc {
+	return Decompress
+}
+
+func (c comp) process(chunk *scat.Chunk) (new *scat.Chunk, err error) {
+	b, err := chunk.Data().Bytes()
+	if err != nil {
+		return
+	}
+	out, err := c.comp.Compress(b)
+	new = chunk.WithData(scat.BytesData(out))
+	return
+}
+
+var Decompress Proc = ChunkFunc(decompress)
+
+func decompress(c *scat.Chunk) (new *scat.Chunk, err error) {
+	b, err := c.Data().Bytes()
+	if err != nil {
+		return
+	}
+	out, err := compress.Decompress(b)
+	new = c.WithData(scat.BytesData(out))
+	return
+}
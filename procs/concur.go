@@ -9,13 +9,18 @@ import (
 
 type concurProc struct {
 	dynp  DynProcer
-	slots slots.Slots
+	slots *slots.Slots
 }
 
 func NewConcur(max int, dynp DynProcer) Proc {
+	return NewConcurSlots(slots.New(max), dynp)
+}
+
+// Like NewConcur() with slots that may be resized while running.
+func NewConcurSlots(s *slots.Slots, dynp DynProcer) Proc {
 	return concurProc{
 		dynp:  dynp,
-		slots: slots.New(max),
+		slots: s,
 	}
 }
 
@@ -53,7 +58,7 @@ func (concp concurProc) Finish() (err error) {
 	if err != nil {
 		return
 	}
-	if len(concp.slots) < cap(concp.slots) {
+	if concp.slots.Used() > 0 {
 		return ErrUnreturnedSlots
 	}
 	return
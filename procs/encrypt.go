@@ -0,0 +1,142 @@
+package procs
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/lhecker/argon2"
+	"github.com/pbtrung/scat"
+)
+
+const (
+	EncryptKeySize = 32
+	encryptVersion = 1
+)
+
+var (
+	encryptPassSalt = []byte("scat encrypt passphrase")
+	encryptLabelEnc = []byte("scat encrypt enc")
+	encryptLabelIv  = []byte("scat encrypt nonce")
+)
+
+var (
+	ErrEncryptVersion = errors.New("unsupported encryption format version")
+	ErrEncryptShort   = errors.New("encrypted data too short")
+)
+
+type encrypt struct {
+	aead  cipher.AEAD
+	ivKey []byte
+}
+
+// NewEncrypt returns an AES-256-GCM proc/unproc pair. Nonces are derived from
+// an HMAC of the plaintext (convergent encryption) so that encrypting the same
+// chunk twice yields identical bytes and thus identical final hashes, keeping
+// de-duplication effective after encryption.
+//
+// Output layout: version (1 byte) | nonce | ciphertext+tag
+func NewEncrypt(key []byte) (p ProcUnprocer, err error) {
+	if len(key) != EncryptKeySize {
+		err = fmt.Errorf("key must be %d bytes", EncryptKeySize)
+		return
+	}
+	block, err := aes.NewCipher(subkey(key, encryptLabelEnc))
+	if err != nil {
+		return
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return
+	}
+	p = encrypt{
+		aead:  aead,
+		ivKey: subkey(key, encryptLabelIv),
+	}
+	return
+}
+
+func subkey(key, label []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(label)
+	return mac.Sum(nil)
+}
+
+// Derives an encryption key from a passphrase using Argon2 with a fixed salt:
+// the same passphrase must always give the same key for convergence.
+func EncryptPassKey(pass []byte) (key []byte, err error) {
+	cfg := argon2.DefaultConfig()
+	cfg.HashLength = EncryptKeySize
+	cfg.TimeCost = 4
+	cfg.MemoryCost = 1 << 16
+	cfg.Parallelism = 2
+	raw, err := cfg.Hash(pass, encryptPassSalt)
+	if err != nil {
+		return
+	}
+	key = raw.Hash
+	return
+}
+
+// Derives an encryption key from the contents of a key file.
+func EncryptFileKey(contents []byte) []byte {
+	sum := sha256.Sum256(contents)
+	return sum[:]
+}
+
+func (e encrypt) Proc() Proc {
+	return ChunkFunc(e.process)
+}
+
+func (e encrypt) Unproc() Proc {
+	return ChunkFunc(e.unprocess)
+}
+
+func (e encrypt) process(c *scat.Chunk) (new *scat.Chunk, err error) {
+	plain, err := c.Data().Bytes()
+	if err != nil {
+		return
+	}
+	nonce := e.nonce(plain)
+	out := make([]byte, 1, 1+len(nonce)+len(plain)+e.aead.Overhead())
+	out[0] = encryptVersion
+	out = append(out, nonce...)
+	out = e.aead.Seal(out, nonce, plain, nil)
+	new = c.WithData(scat.BytesData(out))
+	return
+}
+
+func (e encrypt) nonce(plain []byte) []byte {
+	mac := hmac.New(sha256.New, e.ivKey)
+	mac.Write(plain)
+	return mac.Sum(nil)[:e.aead.NonceSize()]
+}
+
+func (e encrypt) unprocess(c *scat.Chunk) (new *scat.Chunk, err error) {
+	data, err := c.Data().Bytes()
+	if err != nil {
+		return
+	}
+	nsize := e.aead.NonceSize()
+	if len(data) < 1+nsize+e.aead.Overhead() {
+		err = ErrEncryptShort
+		return
+	}
+	if data[0] != encryptVersion {
+		err = ErrEncryptVersion
+		return
+	}
+	nonce, sealed := data[1:1+nsize], data[1+nsize:]
+	plain, err := e.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		// Authentication failure: corrupted or tampered with, recoverable by
+		// parity like any other integrity check failure.
+		err = ErrIntegrityCheckFailed
+		return
+	}
+	new = c.WithData(scat.BytesData(plain))
+	return
+}
@@ -0,0 +1,78 @@
+package procs_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pbtrung/scat"
+	"github.com/pbtrung/scat/procs"
+	"github.com/pbtrung/scat/testutil"
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestEncrypt(t *testing.T) {
+	const data = "some data"
+	key := procs.EncryptFileKey([]byte("some key"))
+	enc, err := procs.NewEncrypt(key)
+	assert.NoError(t, err)
+
+	process := func(proc procs.Proc, b []byte) ([]byte, error) {
+		c := scat.NewChunk(0, scat.BytesData(b))
+		chunks, err := testutil.ReadChunks(proc.Process(c))
+		assert.Equal(t, 1, len(chunks))
+		if err != nil {
+			return nil, err
+		}
+		return chunks[0].Data().Bytes()
+	}
+
+	encrypted, err := process(enc.Proc(), []byte(data))
+	assert.NoError(t, err)
+	assert.False(t, bytes.Contains(encrypted, []byte(data)))
+
+	// convergence
+	encrypted2, err := process(enc.Proc(), []byte(data))
+	assert.NoError(t, err)
+	assert.Equal(t, encrypted, encrypted2)
+	other, err := process(enc.Proc(), []byte(data+"x"))
+	assert.NoError(t, err)
+	assert.NotEqual(t, encrypted, other)
+
+	// decrypt
+	decrypted, err := process(enc.Unproc(), encrypted)
+	assert.NoError(t, err)
+	assert.Equal(t, data, string(decrypted))
+
+	// tampered
+	tampered := append([]byte{}, encrypted...)
+	tampered[len(tampered)-1] ^= 1
+	_, err = process(enc.Unproc(), tampered)
+	assert.Equal(t, procs.ErrIntegrityCheckFailed, err)
+
+	// wrong key
+	enc2, err := procs.NewEncrypt(procs.EncryptFileKey([]byte("other key")))
+	assert.NoError(t, err)
+	_, err = process(enc2.Unproc(), encrypted)
+	assert.Equal(t, procs.ErrIntegrityCheckFailed, err)
+
+	// short
+	_, err = process(enc.Unproc(), encrypted[:5])
+	assert.Equal(t, procs.ErrEncryptShort, err)
+}
+
+func TestEncryptKeySize(t *testing.T) {
+	_, err := procs.NewEncrypt([]byte("short"))
+	assert.Error(t, err)
+}
+
+func TestEncryptPassKey(t *testing.T) {
+	k1, err := procs.EncryptPassKey([]byte("pass"))
+	assert.NoError(t, err)
+	assert.Equal(t, procs.EncryptKeySize, len(k1))
+	k2, err := procs.EncryptPassKey([]byte("pass"))
+	assert.NoError(t, err)
+	assert.Equal(t, k1, k2)
+	k3, err := procs.EncryptPassKey([]byte("other"))
+	assert.NoError(t, err)
+	assert.NotEqual(t, k1, k3)
+}
@@ -25,6 +25,7 @@ type metaKey int
 const (
 	metaGroup metaKey = iota
 	metaGroupErr
+	metaTrim
 )
 
 func NewGroup(size int) Group {
@@ -52,6 +53,9 @@ func (g *group) Process(c *scat.Chunk) <-chan Res {
 	} else if ok {
 		agg := scat.NewChunk(head, nil)
 		agg.SetTargetSize(grouped[0].TargetSize())
+		if t := grouped[0].Meta().Get(metaTrim); t != nil {
+			agg.Meta().Set(metaTrim, t)
+		}
 		agg.Meta().Set(metaGroup, grouped)
 		ch <- Res{Chunk: agg}
 	}
@@ -9,6 +9,7 @@ import (
 	"github.com/pbtrung/scat"
 	"github.com/pbtrung/scat/checksum"
 	"github.com/pbtrung/scat/index"
+	"github.com/pbtrung/scat/journal"
 	"github.com/pbtrung/scat/seriessort"
 )
 
@@ -19,6 +20,10 @@ type IndexProc interface {
 
 type indexProc struct {
 	w        io.Writer
+	header   *index.Header
+	journal  *journal.Journal
+	v2       bool
+	offset   int64
 	order    seriessort.Series
 	orderMu  sync.Mutex
 	finals   map[checksum.Hash]*finals
@@ -44,11 +49,34 @@ var (
 	ErrIndexDup              = errors.New("won't process dup chunk")
 )
 
+type indexOrder struct {
+	hash   checksum.Hash
+	length int
+}
+
+// Writes V1 indexes
 func NewIndexProc(w io.Writer) IndexProc {
+	return NewIndexProcHeader(w, nil)
+}
+
+// Writes V2 indexes, starting with hdr, unless nil. The header is only written
+// along with the first entries, or on Finish(), so that it may be completed
+// while building the rest of the chain.
+func NewIndexProcHeader(w io.Writer, hdr *index.Header) IndexProc {
+	return NewIndexProcJournal(w, hdr, nil)
+}
+
+// Like NewIndexProcHeader(), also recording fully processed chunks to j,
+// unless nil. Chunks it already has are indexed with their recorded finals
+// instead of being passed on for processing again.
+func NewIndexProcJournal(w io.Writer, hdr *index.Header, j *journal.Journal,
+) IndexProc {
 	return &indexProc{
-		w:      w,
-		order:  seriessort.Series{},
-		finals: make(map[checksum.Hash]*finals),
+		w:       w,
+		header:  hdr,
+		journal: j,
+		order:   seriessort.Series{},
+		finals:  make(map[checksum.Hash]*finals),
 	}
 }
 
@@ -56,16 +84,59 @@ func (idx *indexProc) Process(c *scat.Chunk) <-chan Res {
 	idx.setOrder(c)
 	ch := make(chan Res, 1)
 	defer close(ch)
+	journaled, ok := idx.addFinals(c)
+	switch {
+	case journaled:
+		// no ProcessEnd() to come
+		if err := idx.flush(); err != nil {
+			ch <- Res{Chunk: c, Err: err}
+		}
+	case ok:
+		ch <- Res{Chunk: c}
+	}
+	return ch
+}
+
+// Returns false if c is a dup, and whether its finals were recorded by the
+// journal.
+func (idx *indexProc) addFinals(c *scat.Chunk) (journaled, ok bool) {
 	idx.finalsMu.Lock()
 	defer idx.finalsMu.Unlock()
-	if _, ok := idx.finals[c.Hash()]; !ok {
-		idx.finals[c.Hash()] = &finals{
+	if _, dup := idx.finals[c.Hash()]; dup {
+		return
+	}
+	f, journaled := idx.journalFinals(c)
+	if !journaled {
+		f = &finals{
 			num:     c.Num(),
 			entries: make([]indexEntry, 0, 1),
 		}
-		ch <- Res{Chunk: c}
 	}
-	return ch
+	idx.finals[c.Hash()] = f
+	return journaled, true
+}
+
+func (idx *indexProc) journalFinals(c *scat.Chunk) (f *finals, ok bool) {
+	if idx.journal == nil {
+		return
+	}
+	jfinals, ok := idx.journal.Done(c.Hash())
+	if !ok {
+		return
+	}
+	f = &finals{
+		num:      c.Num(),
+		entries:  make([]indexEntry, len(jfinals)),
+		complete: true,
+	}
+	for i, jf := range jfinals {
+		f.entries[i] = indexEntry{
+			num:        i,
+			hash:       jf.Hash,
+			targetSize: jf.TargetSize,
+		}
+	}
+	return
 }
 
 func (idx *indexProc) ProcessFinal(c, final *scat.Chunk) error {
@@ -112,21 +183,45 @@ func (idx *indexProc) setFinalsComplete(c *scat.Chunk) error {
 	}
 	finals.mu.Lock()
 	defer finals.mu.Unlock()
-	if finals.num != c.Num() {
+	if finals.num != c.Num() || finals.complete {
 		return nil
 	}
 	finals.complete = true
-	return nil
+	if idx.journal == nil {
+		return nil
+	}
+	entries := append([]indexEntry{}, finals.entries...)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].num < entries[j].num
+	})
+	jfinals := make([]journal.Final, len(entries))
+	for i, e := range entries {
+		jfinals[i] = journal.Final{Hash: e.hash, TargetSize: e.targetSize}
+	}
+	return idx.journal.AddDone(c.Hash(), jfinals)
 }
 
 func (idx *indexProc) Finish() error {
 	idx.orderMu.Lock()
-	len := idx.order.Len()
-	idx.orderMu.Unlock()
-	if len > 0 {
+	defer idx.orderMu.Unlock()
+	if idx.order.Len() > 0 {
 		return ErrShort
 	}
-	return nil
+	return idx.writeHeader()
+}
+
+// Must be called with orderMu held
+func (idx *indexProc) writeHeader() (err error) {
+	if idx.header == nil {
+		return
+	}
+	err = index.WriteHeader(idx.w, *idx.header)
+	if err != nil {
+		return
+	}
+	idx.header = nil
+	idx.v2 = true
+	return
 }
 
 func (idx *indexProc) flush() (err error) {
@@ -138,11 +233,15 @@ func (idx *indexProc) flush() (err error) {
 		idx.order.Drop(i)
 	}()
 	for n := len(sorted); i < n; i++ {
-		hash := sorted[i].(checksum.Hash)
-		finals, ok := idx.completeFinals(hash)
+		ord := sorted[i].(indexOrder)
+		finals, ok := idx.completeFinals(ord.hash)
 		if !ok {
 			return
 		}
+		err = idx.writeHeader()
+		if err != nil {
+			return
+		}
 		entries := finals.entries
 		num := func(i int) int {
 			return entries[i].num
@@ -150,10 +249,11 @@ func (idx *indexProc) flush() (err error) {
 		sort.Slice(entries, func(i, j int) bool {
 			return num(i) < num(j)
 		})
-		err = writeEntries(idx.w, entries)
+		err = idx.writeEntries(entries, ord.length)
 		if err != nil {
 			return
 		}
+		idx.offset += int64(ord.length)
 	}
 	return
 }
@@ -172,12 +272,30 @@ func (idx *indexProc) completeFinals(hash checksum.Hash) (f *finals, ok bool) {
 func (idx *indexProc) setOrder(c *scat.Chunk) {
 	idx.orderMu.Lock()
 	defer idx.orderMu.Unlock()
-	idx.order.Add(c.Num(), c.Hash())
+	idx.order.Add(c.Num(), indexOrder{c.Hash(), dataLength(c)})
+}
+
+func dataLength(c *scat.Chunk) int {
+	if sz, ok := c.Data().(scat.Sizer); ok {
+		return sz.Size()
+	}
+	return c.TargetSize()
 }
 
-func writeEntries(w io.Writer, entries []indexEntry) (err error) {
+func (idx *indexProc) writeEntries(entries []indexEntry, length int) (
+	err error,
+) {
 	for _, entry := range entries {
-		_, err = index.Write(w, entry.hash, entry.targetSize)
+		if idx.v2 {
+			_, err = index.WriteEntry(idx.w, index.Entry{
+				Hash:   entry.hash,
+				Size:   entry.targetSize,
+				Offset: idx.offset,
+				Length: length,
+			})
+		} else {
+			_, err = index.Write(idx.w, entry.hash, entry.targetSize)
+		}
 		if err != nil {
 			return
 		}
@@ -190,3 +308,67 @@ var IndexUnproc Proc = ChunkIterFunc(indexUnprocess)
 func indexUnprocess(c *scat.Chunk) scat.ChunkIter {
 	return index.NewScanner(c.Num(), c.Data().Reader())
 }
+
+// Like IndexUnproc but only yields chunks overlapping the given byte range of
+// the original stream, for join to trim them to the exact range. Offsets of V1
+// indexes are deduced from the cumulative size of entries, which only holds
+// for chains not altering sizes after index (ex: no compress nor parity).
+func NewIndexUnprocRange(offset, length int64) Proc {
+	return ChunkIterFunc(func(c *scat.Chunk) scat.ChunkIter {
+		return &indexRangeIter{
+			scan:  index.NewScanner(c.Num(), c.Data().Reader()),
+			num:   c.Num(),
+			start: offset,
+			end:   offset + length,
+		}
+	})
+}
+
+type indexRangeIter struct {
+	scan       *index.Scanner
+	num        int
+	start, end int64
+	v1Offset   int64
+	chunk      *scat.Chunk
+}
+
+func (it *indexRangeIter) Next() bool {
+	for it.scan.Next() {
+		e := it.scan.Entry()
+		if it.scan.Header().Version == index.V1 {
+			e.Offset, e.Length = it.v1Offset, e.Size
+			it.v1Offset += int64(e.Size)
+		}
+		if e.Offset+int64(e.Length) <= it.start {
+			continue
+		}
+		if e.Offset >= it.end {
+			return false
+		}
+		c := scat.NewChunk(it.num, nil)
+		c.SetHash(e.Hash)
+		c.SetTargetSize(e.Size)
+		it.num++
+		t := trim{0, e.Length}
+		if e.Offset < it.start {
+			t.start = int(it.start - e.Offset)
+		}
+		if end := e.Offset + int64(e.Length); end > it.end {
+			t.end -= int(end - it.end)
+		}
+		if t != (trim{0, e.Length}) {
+			c.Meta().Set(metaTrim, t)
+		}
+		it.chunk = c
+		return true
+	}
+	return false
+}
+
+func (it *indexRangeIter) Chunk() *scat.Chunk {
+	return it.chunk
+}
+
+func (it *indexRangeIter) Err() error {
+	return it.scan.Err()
+}
@@ -4,12 +4,17 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	assert "github.com/stretchr/testify/require"
 	"github.com/pbtrung/scat"
 	"github.com/pbtrung/scat/checksum"
+	"github.com/pbtrung/scat/index"
+	"github.com/pbtrung/scat/journal"
 	"github.com/pbtrung/scat/procs"
 	"github.com/pbtrung/scat/testutil"
 )
@@ -73,6 +78,145 @@ func TestIndex(t *testing.T) {
 	assert.Equal(t, 4, nlines())
 }
 
+func TestIndexV2(t *testing.T) {
+	buf := &bytes.Buffer{}
+	hdr := &index.Header{}
+	idx := procs.NewIndexProcHeader(buf, hdr)
+	hdr.NData, hdr.NParity = 2, 1 // completed after creating the proc
+	end := func(num int, data string, finals ...string) {
+		c := scat.NewChunk(num, scat.BytesData(data))
+		c.SetHash(sum(data))
+		_, err := testutil.ReadChunks(idx.Process(c))
+		assert.NoError(t, err)
+		for _, f := range finals {
+			final := c.WithData(nil)
+			final.SetHash(sum(f))
+			final.SetTargetSize(len(data))
+			assert.NoError(t, idx.ProcessFinal(c, final))
+		}
+		assert.NoError(t, idx.ProcessEnd(c))
+	}
+	end(0, "abc", "a1", "a2")
+	end(1, "de", "d1")
+	end(2, "abc")
+	assert.NoError(t, idx.Finish())
+
+	scan := index.NewScanner(0, buf)
+	type entry struct {
+		hash           checksum.Hash
+		offset, length int
+	}
+	entries := []entry{}
+	for scan.Next() {
+		e := scan.Entry()
+		entries = append(entries, entry{e.Hash, int(e.Offset), e.Length})
+	}
+	assert.NoError(t, scan.Err())
+	assert.Equal(t, index.V2, scan.Header().Version)
+	assert.Equal(t, 2, scan.Header().NData)
+	assert.Equal(t, 1, scan.Header().NParity)
+	assert.Equal(t, []entry{
+		{sum("a1"), 0, 3},
+		{sum("a2"), 0, 3},
+		{sum("d1"), 3, 2},
+		{sum("a1"), 5, 3},
+		{sum("a2"), 5, 3},
+	}, entries)
+}
+
+func TestIndexV2Empty(t *testing.T) {
+	buf := &bytes.Buffer{}
+	idx := procs.NewIndexProcHeader(buf, &index.Header{})
+	assert.NoError(t, idx.Finish())
+	scan := index.NewScanner(0, buf)
+	assert.False(t, scan.Next())
+	assert.NoError(t, scan.Err())
+	assert.Equal(t, index.V2, scan.Header().Version)
+}
+
+func TestIndexUnprocRange(t *testing.T) {
+	parts := []string{"abc", "de", "fghi"}
+	data := make(map[checksum.Hash]string)
+	v1, v2 := &bytes.Buffer{}, &bytes.Buffer{}
+	assert.NoError(t, index.WriteHeader(v2, index.Header{}))
+	offset := int64(0)
+	for _, p := range parts {
+		h := sum(p)
+		data[h] = p
+		_, err := index.Write(v1, h, len(p))
+		assert.NoError(t, err)
+		_, err = index.WriteEntry(v2, index.Entry{h, len(p), offset, len(p)})
+		assert.NoError(t, err)
+		offset += int64(len(p))
+	}
+	get := procs.ChunkFunc(func(c *scat.Chunk) (*scat.Chunk, error) {
+		return c.WithData(scat.BytesData(data[c.Hash()])), nil
+	})
+	read := func(idx []byte, offset, length int64) string {
+		out := &bytes.Buffer{}
+		proc := procs.Chain{
+			procs.NewIndexUnprocRange(offset, length),
+			get,
+			procs.NewJoin(out),
+		}
+		_, err := testutil.ReadChunks(proc.Process(
+			scat.NewChunk(0, scat.BytesData(idx)),
+		))
+		assert.NoError(t, err)
+		assert.NoError(t, proc.Finish())
+		return out.String()
+	}
+	for _, idx := range [][]byte{v1.Bytes(), v2.Bytes()} {
+		assert.Equal(t, "abcdefghi", read(idx, 0, 9))
+		assert.Equal(t, "abcdefghi", read(idx, 0, 100))
+		assert.Equal(t, "cdef", read(idx, 2, 4))
+		assert.Equal(t, "de", read(idx, 3, 2))
+		assert.Equal(t, "g", read(idx, 6, 1))
+		assert.Equal(t, "", read(idx, 9, 5))
+	}
+}
+
+func TestIndexUnprocRangeOrder(t *testing.T) {
+	const n = 50
+	data := make(map[checksum.Hash]string)
+	idx := &bytes.Buffer{}
+	assert.NoError(t, index.WriteHeader(idx, index.Header{}))
+	all := ""
+	for i := 0; i < n; i++ {
+		p := fmt.Sprintf("%03d", i)
+		h := sum(p)
+		data[h] = p
+		_, err := index.WriteEntry(idx, index.Entry{h, len(p), int64(len(all)),
+			len(p)})
+		assert.NoError(t, err)
+		all += p
+	}
+
+	// later chunks got first
+	get := procs.ChunkFunc(func(c *scat.Chunk) (*scat.Chunk, error) {
+		time.Sleep(time.Duration(n-c.Num()) * 100 * time.Microsecond)
+		return c.WithData(scat.BytesData(data[c.Hash()])), nil
+	})
+	read := func(offset, length int64) string {
+		out := &bytes.Buffer{}
+		proc := procs.Chain{
+			procs.NewIndexUnprocRange(offset, length),
+			get,
+			procs.NewJoin(out),
+		}
+		_, err := testutil.ReadChunks(proc.Process(
+			scat.NewChunk(0, scat.BytesData(idx.Bytes())),
+		))
+		assert.NoError(t, err)
+		assert.NoError(t, proc.Finish())
+		return out.String()
+	}
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, all, read(0, int64(len(all))))
+		assert.Equal(t, all[4:len(all)-4], read(4, int64(len(all)-8)))
+	}
+}
+
 func TestIndexSameChunkNewData(t *testing.T) {
 	buf := &bytes.Buffer{}
 	idx := procs.NewIndexProc(buf)
@@ -198,3 +342,68 @@ func testIndexChunk(num, targetSize int, hash checksum.Hash) (c *scat.Chunk) {
 	c.SetHash(hash)
 	return
 }
+
+func TestIndexJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	j, err := journal.Open(filepath.Join(dir, "journal"))
+	assert.NoError(t, err)
+	defer j.Close()
+
+	run := func(failB bool) (string, []string, error) {
+		buf := &bytes.Buffer{}
+		idx := procs.NewIndexProcJournal(buf, &index.Header{}, j)
+		processed := []string{}
+		for i, data := range []string{"a", "b"} {
+			c := scat.NewChunk(i, scat.BytesData(data))
+			c.SetHash(sum(data))
+			chunks, err := testutil.ReadChunks(idx.Process(c))
+			assert.NoError(t, err)
+			if len(chunks) == 0 {
+				continue
+			}
+			processed = append(processed, data)
+			if data == "b" && failB {
+				continue
+			}
+			final := c.WithData(nil)
+			final.SetHash(sum(data + "1"))
+			final.SetTargetSize(1)
+			assert.NoError(t, idx.ProcessFinal(c, final))
+			assert.NoError(t, idx.ProcessEnd(c))
+		}
+		err := idx.Finish()
+		return buf.String(), processed, err
+	}
+
+	// interrupted
+	_, processed, err := run(true)
+	assert.Error(t, err)
+	assert.Equal(t, []string{"a", "b"}, processed)
+
+	// resumed
+	out, processed, err := run(false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b"}, processed)
+
+	// same index as a full run
+	_, processed, err = run(false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{}, processed)
+	expected := &bytes.Buffer{}
+	idx := procs.NewIndexProcHeader(expected, &index.Header{})
+	for i, data := range []string{"a", "b"} {
+		c := scat.NewChunk(i, scat.BytesData(data))
+		c.SetHash(sum(data))
+		_, err := testutil.ReadChunks(idx.Process(c))
+		assert.NoError(t, err)
+		final := c.WithData(nil)
+		final.SetHash(sum(data + "1"))
+		final.SetTargetSize(1)
+		assert.NoError(t, idx.ProcessFinal(c, final))
+		assert.NoError(t, idx.ProcessEnd(c))
+	}
+	assert.NoError(t, idx.Finish())
+	assert.Equal(t, expected.String(), out)
+}
@@ -1,9 +1,48 @@
 package procs
 
 import (
+	"errors"
 	"io"
+
+	"github.com/pbtrung/scat"
 )
 
+var errTrimShort = errors.New("chunk shorter than its indexed length")
+
 func NewJoin(w io.Writer) Proc {
-	return NewBacklog(1, Chain{&Sort{}, WriterTo{w}})
+	return NewBacklog(1, Chain{&Sort{}, trimWriterTo{WriterTo{w}}})
+}
+
+// Like WriterTo, trimming chunks first. Synchronous, keeping the order of
+// chunks released by Sort.
+type trimWriterTo struct {
+	WriterTo
+}
+
+func (wt trimWriterTo) Process(c *scat.Chunk) <-chan Res {
+	trimmed, err := trimChunk(c)
+	if err != nil {
+		return SingleRes(c, err)
+	}
+	return wt.WriterTo.Process(trimmed)
+}
+
+// Bounds of the data of a chunk to keep, as marked by range index unprocs
+type trim struct {
+	start, end int
+}
+
+func trimChunk(c *scat.Chunk) (*scat.Chunk, error) {
+	t, ok := c.Meta().Get(metaTrim).(trim)
+	if !ok {
+		return c, nil
+	}
+	b, err := c.Data().Bytes()
+	if err != nil {
+		return nil, err
+	}
+	if t.end > len(b) {
+		return nil, errTrimShort
+	}
+	return c.WithData(scat.BytesData(b[t.start:t.end])), nil
 }
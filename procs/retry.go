@@ -0,0 +1,53 @@
+package procs
+
+import (
+	"time"
+
+	"github.com/pbtrung/scat"
+)
+
+// Retry processes chunks with Proc, processing them again on error up to N
+// more times. It waits Backoff before the first retry, doubling the wait for
+// each next one. Only results of the last attempt are output.
+type Retry struct {
+	Proc
+	N       int
+	Backoff time.Duration
+
+	// Reports whether to retry after err. Nil retries after any error.
+	Retryable func(err error) bool
+}
+
+var _ Proc = Retry{}
+
+func (r Retry) Process(c *scat.Chunk) <-chan Res {
+	out := make(chan Res)
+	go func() {
+		defer close(out)
+		backoff := r.Backoff
+		buf := []Res{}
+		for i := 0; ; i++ {
+			buf = buf[:0]
+			var err error
+			for res := range r.Proc.Process(c) {
+				buf = append(buf, res)
+				if res.Err != nil && err == nil {
+					err = res.Err
+				}
+			}
+			if err == nil || i >= r.N || !r.retryable(err) {
+				break
+			}
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		for _, res := range buf {
+			out <- res
+		}
+	}()
+	return out
+}
+
+func (r Retry) retryable(err error) bool {
+	return r.Retryable == nil || r.Retryable(err)
+}
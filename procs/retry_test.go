@@ -0,0 +1,61 @@
+package procs_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pbtrung/scat"
+	"github.com/pbtrung/scat/procs"
+	"github.com/pbtrung/scat/testutil"
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestRetry(t *testing.T) {
+	someErr := errors.New("some err")
+	otherErr := errors.New("other err")
+	calls := 0
+	failing := func(errs ...error) procs.Proc {
+		calls = 0
+		return procs.InplaceFunc(func(*scat.Chunk) error {
+			calls++
+			if calls > len(errs) {
+				return nil
+			}
+			return errs[calls-1]
+		})
+	}
+	c := scat.NewChunk(0, nil)
+
+	// success after retries
+	retry := procs.Retry{
+		Proc:    failing(someErr, someErr),
+		N:       2,
+		Backoff: time.Millisecond,
+	}
+	chunks, err := testutil.ReadChunks(retry.Process(c))
+	assert.NoError(t, err)
+	assert.Equal(t, []*scat.Chunk{c}, chunks)
+	assert.Equal(t, 3, calls)
+
+	// too many errors
+	retry.Proc = failing(someErr, someErr, someErr)
+	_, err = testutil.ReadChunks(retry.Process(c))
+	assert.Equal(t, someErr, err)
+	assert.Equal(t, 3, calls)
+
+	// not retryable
+	retry.Proc = failing(someErr, otherErr)
+	retry.Retryable = func(err error) bool {
+		return err == someErr
+	}
+	_, err = testutil.ReadChunks(retry.Process(c))
+	assert.Equal(t, otherErr, err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestRetryFinish(t *testing.T) {
+	testutil.TestFinishErrForward(t, func(proc procs.Proc) testutil.Finisher {
+		return procs.Retry{Proc: proc}
+	})
+}
@@ -0,0 +1,176 @@
+// Package ratelimit limits throughput of data streams with token buckets.
+package ratelimit
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pbtrung/scat"
+	"github.com/pbtrung/scat/procs"
+)
+
+// Max bytes read at once by limited readers, smoothing out streams.
+const readSize = 32 * 1024
+
+// Limiter is a token bucket letting through rate bytes per second, with bursts
+// of up to a second worth of bytes.
+type Limiter struct {
+	rate   float64
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func New(rate uint64) *Limiter {
+	return &Limiter{
+		rate:   float64(rate),
+		tokens: float64(rate),
+		last:   time.Now(),
+	}
+}
+
+func (l *Limiter) Rate() uint64 {
+	return uint64(l.rate)
+}
+
+// Wait blocks until n bytes may pass. Bytes in excess of available tokens are
+// taken on credit, delaying next waits.
+func (l *Limiter) Wait(n int) {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	wait := time.Duration(0)
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	time.Sleep(wait)
+}
+
+// Limiters all apply: ex: per store and global.
+type Limiters []*Limiter
+
+// Wait blocks until n bytes may pass all limiters. Large n are waited for in
+// steps, letting concurrent waits interleave instead of a whole chunk taking
+// tokens on credit at once.
+func (ls Limiters) Wait(n int) {
+	step := ls.step()
+	for n > 0 {
+		sz := n
+		if sz > step {
+			sz = step
+		}
+		for _, l := range ls {
+			l.Wait(sz)
+		}
+		n -= sz
+	}
+}
+
+// step is readSize, or a tenth of a second worth of bytes of the slowest
+// limiter.
+func (ls Limiters) step() int {
+	step := readSize
+	for _, l := range ls {
+		if sz := int(l.rate / 10); sz < step {
+			step = sz
+		}
+	}
+	if step < 1 {
+		step = 1
+	}
+	return step
+}
+
+func Reader(r io.Reader, ls Limiters) io.Reader {
+	return reader{r, ls}
+}
+
+type reader struct {
+	r  io.Reader
+	ls Limiters
+}
+
+func (r reader) Read(p []byte) (n int, err error) {
+	if len(p) > readSize {
+		p = p[:readSize]
+	}
+	n, err = r.r.Read(p)
+	r.ls.Wait(n)
+	return
+}
+
+// Data limits reading of Data.
+type Data struct {
+	scat.Data
+	Limiters Limiters
+}
+
+var _ scat.Sizer = Data{}
+
+func (d Data) Reader() io.Reader {
+	return Reader(d.Data.Reader(), d.Limiters)
+}
+
+// Bytes waits for the size of the data in steps, as Reader would.
+func (d Data) Bytes() (b []byte, err error) {
+	b, err = d.Data.Bytes()
+	d.Limiters.Wait(len(b))
+	return
+}
+
+// Size returns -1 if the size of Data is unknown.
+func (d Data) Size() int {
+	if sz, ok := d.Data.(scat.Sizer); ok {
+		return sz.Size()
+	}
+	return -1
+}
+
+// Proc limits throughput of Proc, as in uploads by stores: reading of data of
+// processed chunks. As in downloads, output chunks with new data are held
+// until their size has passed.
+type Proc struct {
+	procs.Proc
+	Limiters Limiters
+}
+
+var _ procs.WrapperProc = Proc{}
+
+func (p Proc) Underlying() procs.Proc {
+	return p.Proc
+}
+
+func (p Proc) Process(c *scat.Chunk) <-chan procs.Res {
+	in := c
+	if sz, ok := c.Data().(scat.Sizer); !ok || sz.Size() > 0 {
+		in = c.WithData(Data{c.Data(), p.Limiters})
+	}
+	ch := p.Proc.Process(in)
+	out := make(chan procs.Res)
+	go func() {
+		defer close(out)
+		for res := range ch {
+			if oc := res.Chunk; oc != nil && oc != in && oc != c {
+				p.waitNew(oc.Data())
+			}
+			out <- res
+		}
+	}()
+	return out
+}
+
+func (p Proc) waitNew(d scat.Data) {
+	if _, ok := d.(Data); ok {
+		return
+	}
+	if sz, ok := d.(scat.Sizer); ok && sz.Size() > 0 {
+		p.Limiters.Wait(sz.Size())
+	}
+}
@@ -0,0 +1,121 @@
+package ratelimit_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/pbtrung/scat"
+	"github.com/pbtrung/scat/procs"
+	"github.com/pbtrung/scat/ratelimit"
+	"github.com/pbtrung/scat/testutil"
+	assert "github.com/stretchr/testify/require"
+)
+
+// Rate low enough for waits to be measurable but short.
+const rate = 10000
+
+func elapsed(fn func()) time.Duration {
+	start := time.Now()
+	fn()
+	return time.Since(start)
+}
+
+func TestWait(t *testing.T) {
+	l := ratelimit.New(rate)
+	assert.Equal(t, uint64(rate), l.Rate())
+
+	// burst of a second
+	d := elapsed(func() { l.Wait(rate) })
+	assert.True(t, d < 50*time.Millisecond, "%v", d)
+
+	// then rate
+	d = elapsed(func() { l.Wait(rate / 5) })
+	assert.True(t, d >= 150*time.Millisecond, "%v", d)
+}
+
+func TestReader(t *testing.T) {
+	ls := ratelimit.Limiters{ratelimit.New(rate), ratelimit.New(rate * 2)}
+	ls.Wait(rate * 2) // drain bursts
+	in := bytes.Repeat([]byte("a"), rate/5)
+	var out []byte
+	d := elapsed(func() {
+		var err error
+		out, err = ioutil.ReadAll(ratelimit.Reader(bytes.NewReader(in), ls))
+		assert.NoError(t, err)
+	})
+	assert.Equal(t, in, out)
+	assert.True(t, d >= 150*time.Millisecond, "%v", d)
+}
+
+func TestData(t *testing.T) {
+	ls := ratelimit.Limiters{ratelimit.New(rate)}
+	ls.Wait(rate)
+	d := ratelimit.Data{Data: scat.BytesData("abc"), Limiters: ls}
+	assert.Equal(t, 3, d.Size())
+	b, err := d.Bytes()
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", string(b))
+	b, err = ioutil.ReadAll(d.Reader())
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", string(b))
+}
+
+func TestProc(t *testing.T) {
+	ls := ratelimit.Limiters{ratelimit.New(rate)}
+	ls.Wait(rate)
+
+	// new output data, as in downloads: waited on
+	proc := ratelimit.Proc{
+		Proc: procs.ProcFunc(func(c *scat.Chunk) <-chan procs.Res {
+			data := scat.BytesData(bytes.Repeat([]byte("a"), rate/5))
+			return procs.Nop.Process(c.WithData(data))
+		}),
+		Limiters: ls,
+	}
+	var chunks []*scat.Chunk
+	d := elapsed(func() {
+		var err error
+		chunks, err = testutil.ReadChunks(proc.Process(scat.NewChunk(0, nil)))
+		assert.NoError(t, err)
+	})
+	assert.Equal(t, 1, len(chunks))
+	assert.True(t, d >= 150*time.Millisecond, "%v", d)
+
+	// input data: wrapped for reading
+	var got scat.Data
+	proc = ratelimit.Proc{
+		Proc: procs.InplaceFunc(func(c *scat.Chunk) error {
+			got = c.Data()
+			return nil
+		}),
+		Limiters: ls,
+	}
+	_, err := testutil.ReadChunks(
+		proc.Process(scat.NewChunk(0, scat.BytesData("abc"))),
+	)
+	assert.NoError(t, err)
+	assert.IsType(t, ratelimit.Data{}, got)
+}
+
+func TestDataSteps(t *testing.T) {
+	ls := ratelimit.Limiters{ratelimit.New(rate)}
+	ls.Wait(rate)
+	d := ratelimit.Data{
+		Data:     scat.BytesData(bytes.Repeat([]byte("a"), rate/2)),
+		Limiters: ls,
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := d.Bytes()
+		assert.NoError(t, err)
+	}()
+
+	// concurrent small wait not held behind the whole chunk
+	time.Sleep(50 * time.Millisecond)
+	dur := elapsed(func() { ls.Wait(rate / 100) })
+	assert.True(t, dur < 300*time.Millisecond, "%v", dur)
+	<-done
+}
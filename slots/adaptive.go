@@ -0,0 +1,81 @@
+package slots
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pbtrung/scat/slidecnt"
+)
+
+// Adaptive is a number of slots between Min and Max, adjusted after each
+// Window from throughput and errors of the transfers reported by Done():
+// halved on errors, else grown while throughput grows, or shrunk back if
+// throughput dropped since it last grew. Throughput is averaged over the last
+// two windows, smoothing out transfers ending around adjustments.
+type Adaptive struct {
+	*Slots
+	Min, Max int
+	Window   time.Duration
+
+	mu       sync.Mutex
+	out      *slidecnt.Counter
+	errs     int // since adjusted
+	adjusted time.Time
+	rate     uint64 // at the previous adjustment, in bytes per second
+	grew     bool
+}
+
+// Starts with min slots.
+func NewAdaptive(min, max int, window time.Duration) *Adaptive {
+	a := &Adaptive{
+		Slots:    New(min),
+		Min:      min,
+		Max:      max,
+		Window:   window,
+		out:      &slidecnt.Counter{Window: 2 * window},
+		adjusted: time.Now(),
+	}
+	a.out.Add(0) // start of the first window
+	return a
+}
+
+// Done reports a transfer of n bytes, failed if err isn't nil.
+func (a *Adaptive) Done(n uint64, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err != nil {
+		a.errs++
+	}
+	a.out.Add(n)
+	if time.Since(a.adjusted) >= a.Window {
+		a.adjust(a.out.AvgRate(time.Second))
+	}
+}
+
+// Throughput is compared with some tolerance, to ignore noise.
+const dropRatio = 0.9
+
+func (a *Adaptive) adjust(rate uint64) {
+	cur := a.Cap()
+	n := cur
+	switch {
+	case a.errs > 0:
+		n = cur / 2
+	case a.grew && float64(rate) < float64(a.rate)*dropRatio:
+		n = cur - 1
+	case rate >= a.rate:
+		n = cur + 1
+	}
+	if n < a.Min {
+		n = a.Min
+	}
+	if n > a.Max {
+		n = a.Max
+	}
+	a.Resize(n)
+	a.grew = n > cur
+	a.rate = rate
+	a.errs = 0
+	a.adjusted = time.Now()
+	a.out.Add(0) // start of the next window, had it no transfers
+}
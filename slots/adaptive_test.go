@@ -0,0 +1,50 @@
+package slots_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pbtrung/scat/slots"
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestAdaptive(t *testing.T) {
+	const window = 10 * time.Millisecond
+	a := slots.NewAdaptive(2, 4, window)
+	assert.Equal(t, 2, a.Cap())
+	next := func() {
+		time.Sleep(window + window/2)
+	}
+
+	// not adjusted within the window
+	a.Done(1000, nil)
+	assert.Equal(t, 2, a.Cap())
+
+	// throughput: grown
+	next()
+	a.Done(1000, nil)
+	assert.Equal(t, 3, a.Cap())
+
+	// throughput dropped since grown: shrunk back
+	next()
+	a.Done(0, nil)
+	assert.Equal(t, 2, a.Cap())
+
+	// growing up to max
+	for i := uint64(1); i <= 3; i++ {
+		next()
+		a.Done(i*1e9, nil)
+	}
+	assert.Equal(t, 4, a.Cap())
+
+	// errors: halved, down to min
+	a.Done(0, errors.New("some err"))
+	next()
+	a.Done(0, nil)
+	assert.Equal(t, 2, a.Cap())
+	a.Done(0, errors.New("some err"))
+	next()
+	a.Done(0, nil)
+	assert.Equal(t, 2, a.Cap())
+}
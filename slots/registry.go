@@ -0,0 +1,48 @@
+package slots
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Registry names slots, so that they can be looked up and resized while
+// running.
+type Registry struct {
+	mu    sync.Mutex
+	names []string
+	slots map[string]*Slots
+	count map[string]int
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		slots: make(map[string]*Slots),
+		count: make(map[string]int),
+	}
+}
+
+// Add registers s under kind followed by the count of slots of that kind
+// registered so far, ex: concur1, concur2. Returns the name.
+func (r *Registry) Add(kind string, s *Slots) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.count[kind]++
+	name := fmt.Sprintf("%s%d", kind, r.count[kind])
+	r.names = append(r.names, name)
+	r.slots[name] = s
+	return name
+}
+
+// Get returns nil if no slots are registered under name.
+func (r *Registry) Get(name string) *Slots {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.slots[name]
+}
+
+// Names returns registered names, in order of registration.
+func (r *Registry) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.names...)
+}
@@ -1,20 +1,57 @@
+// Package slots limits concurrency, to a number of slots resizable while
+// running.
 package slots
 
-type Slots chan slot
-type slot struct{}
+import "sync"
 
-func New(n int) Slots {
-	slots := make(Slots, n)
-	for i, n := 0, cap(slots); i < n; i++ {
-		slots <- slot{}
+type Slots struct {
+	mu   sync.Mutex
+	cond sync.Cond
+	n    int
+	used int
+}
+
+func New(n int) *Slots {
+	s := &Slots{n: n}
+	s.cond.L = &s.mu
+	return s
+}
+
+// Take blocks until a slot is free.
+func (s *Slots) Take() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.used >= s.n {
+		s.cond.Wait()
 	}
-	return slots
+	s.used++
+}
+
+func (s *Slots) Release() {
+	s.mu.Lock()
+	s.used--
+	s.mu.Unlock()
+	s.cond.Signal()
+}
+
+// Resize sets the number of slots to n. When shrinking, slots in use are
+// left to be released.
+func (s *Slots) Resize(n int) {
+	s.mu.Lock()
+	s.n = n
+	s.mu.Unlock()
+	s.cond.Broadcast()
 }
 
-func (s Slots) Take() {
-	<-s
+func (s *Slots) Cap() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.n
 }
 
-func (s Slots) Release() {
-	s <- slot{}
+// Used returns the number of slots taken and not released yet.
+func (s *Slots) Used() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.used
 }
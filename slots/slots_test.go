@@ -0,0 +1,61 @@
+package slots_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pbtrung/scat/slots"
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestSlots(t *testing.T) {
+	s := slots.New(1)
+	s.Take()
+	assert.Equal(t, 1, s.Used())
+
+	taken := make(chan struct{})
+	go func() {
+		s.Take()
+		close(taken)
+	}()
+	assert.False(t, isDone(taken))
+
+	// grown: waiting take unblocked
+	s.Resize(2)
+	assert.True(t, isDone(taken))
+	assert.Equal(t, 2, s.Cap())
+	assert.Equal(t, 2, s.Used())
+
+	// shrunk: slots in use left to be released
+	s.Resize(1)
+	s.Release()
+	taken = make(chan struct{})
+	go func() {
+		s.Take()
+		close(taken)
+	}()
+	assert.False(t, isDone(taken))
+	s.Release()
+	assert.True(t, isDone(taken))
+	assert.Equal(t, 1, s.Used())
+}
+
+func isDone(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	case <-time.After(20 * time.Millisecond):
+		return false
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	reg := slots.NewRegistry()
+	a, b, c := slots.New(1), slots.New(2), slots.New(3)
+	assert.Equal(t, "concur1", reg.Add("concur", a))
+	assert.Equal(t, "backlog1", reg.Add("backlog", b))
+	assert.Equal(t, "concur2", reg.Add("concur", c))
+	assert.Equal(t, []string{"concur1", "backlog1", "concur2"}, reg.Names())
+	assert.True(t, reg.Get("concur2") == c)
+	assert.Nil(t, reg.Get("concur3"))
+}
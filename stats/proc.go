@@ -22,15 +22,15 @@ func (p Proc) Process(c *scat.Chunk) <-chan procs.Res {
 	out := make(chan procs.Res)
 	cnt := p.D.Counter(p.Id)
 	cnt.addInst(1)
+	cnt.addIn(size(c.Data()))
 	go func() {
 		defer cnt.addInst(-1)
 		defer close(out)
 		for res := range ch {
 			if c := res.Chunk; c != nil {
-				if sizer, ok := c.Data().(scat.Sizer); ok {
-					if sz := sizer.Size(); sz >= 0 {
-						cnt.addOut(uint64(sz))
-					}
+				cnt.addOutChunk()
+				if sz := size(c.Data()); sz >= 0 {
+					cnt.addOut(uint64(sz))
 				}
 			}
 			out <- res
@@ -38,3 +38,11 @@ func (p Proc) Process(c *scat.Chunk) <-chan procs.Res {
 	}()
 	return out
 }
+
+// Returns -1 if unknown.
+func size(data scat.Data) int {
+	if sz, ok := data.(scat.Sizer); ok {
+		return sz.Size()
+	}
+	return -1
+}
@@ -1,11 +1,15 @@
 package stats_test
 
 import (
+	"io/ioutil"
+	"sync"
 	"testing"
 
+	"github.com/pbtrung/scat"
 	"github.com/pbtrung/scat/procs"
 	"github.com/pbtrung/scat/stats"
 	"github.com/pbtrung/scat/testutil"
+	assert "github.com/stretchr/testify/require"
 )
 
 func TestProcFinish(t *testing.T) {
@@ -14,3 +18,27 @@ func TestProcFinish(t *testing.T) {
 		return stats.Proc{statsd, nil, proc}
 	})
 }
+
+// Run with -race: instances counted while being reported.
+func TestProcConcurrentReport(t *testing.T) {
+	statsd := stats.New()
+	proc := stats.Proc{statsd, "nop", procs.Nop}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := testutil.ReadChunks(proc.Process(scat.NewChunk(j, nil)))
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		_, err := statsd.WriteTo(ioutil.Discard)
+		assert.NoError(t, err)
+		statsd.Snapshot()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(0), statsd.Snapshot().Procs[0].Inst)
+}
@@ -0,0 +1,133 @@
+package stats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Prometheus writes snapshots of D in the Prometheus text exposition format.
+// Served over HTTP, it's a metrics endpoint.
+type Prometheus struct {
+	D *Statsd
+}
+
+var (
+	_ io.WriterTo  = Prometheus{}
+	_ http.Handler = Prometheus{}
+)
+
+type metric struct {
+	name, typ, help string
+	value           func(ProcSnapshot) (float64, bool)
+}
+
+var procMetrics = []metric{
+	{"scat_proc_instances", "gauge", "Running instances of the proc.",
+		func(p ProcSnapshot) (float64, bool) { return float64(p.Inst), true }},
+	{"scat_proc_rate_bytes", "gauge", "Output bytes per second.",
+		func(p ProcSnapshot) (float64, bool) { return float64(p.Rate), true }},
+	{"scat_proc_limit_bytes", "gauge", "Rate limit in bytes per second.",
+		func(p ProcSnapshot) (float64, bool) {
+			return float64(p.Limit), p.Limit > 0
+		}},
+	{"scat_proc_in_bytes_total", "counter", "Input bytes.",
+		func(p ProcSnapshot) (float64, bool) { return float64(p.InBytes), true }},
+	{"scat_proc_out_bytes_total", "counter", "Output bytes.",
+		func(p ProcSnapshot) (float64, bool) { return float64(p.OutBytes), true }},
+	{"scat_proc_in_chunks_total", "counter", "Input chunks.",
+		func(p ProcSnapshot) (float64, bool) { return float64(p.InChunks), true }},
+	{"scat_proc_out_chunks_total", "counter", "Output chunks.",
+		func(p ProcSnapshot) (float64, bool) {
+			return float64(p.OutChunks), true
+		}},
+	{"scat_store_quota_use_bytes", "gauge", "Bytes used on the store.",
+		func(p ProcSnapshot) (float64, bool) {
+			if p.Quota == nil {
+				return 0, false
+			}
+			return float64(p.Quota.Use), true
+		}},
+	{"scat_store_new_bytes_total", "counter", "Bytes written to the store.",
+		func(p ProcSnapshot) (float64, bool) {
+			return float64(p.NewBytes), p.Quota != nil
+		}},
+	{"scat_store_present_bytes_total", "counter",
+		"Bytes of chunks found on the store already.",
+		func(p ProcSnapshot) (float64, bool) {
+			return float64(p.PresentBytes), p.Quota != nil
+		}},
+	{"scat_store_quota_max_bytes", "gauge", "Quota of the store.",
+		func(p ProcSnapshot) (float64, bool) {
+			if p.Quota == nil || p.Quota.Max == 0 {
+				return 0, false
+			}
+			return float64(p.Quota.Max), true
+		}},
+}
+
+func (p Prometheus) WriteTo(w io.Writer) (int64, error) {
+	cw := &countWriter{w: bufio.NewWriter(w)}
+	snap := p.D.Snapshot()
+	for _, m := range procMetrics {
+		header := false
+		for _, ps := range snap.Procs {
+			val, ok := m.value(ps)
+			if !ok {
+				continue
+			}
+			if !header {
+				writeHeader(cw, m.name, m.typ, m.help)
+				header = true
+			}
+			fmt.Fprintf(cw, "%s{proc=\"%s\"} %v\n", m.name, escape(ps.Id), val)
+		}
+	}
+	writeHeader(cw, "scat_dedup_bytes_total", "counter",
+		"Bytes of chunks not written for being stored already.")
+	fmt.Fprintf(cw, "scat_dedup_bytes_total %d\n", snap.DedupBytes)
+	if snap.Limit > 0 {
+		writeHeader(cw, "scat_limit_bytes", "gauge",
+			"Global rate limit of store transfers in bytes per second.")
+		fmt.Fprintf(cw, "scat_limit_bytes %d\n", snap.Limit)
+	}
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, cw.w.Flush()
+}
+
+func (p Prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	p.WriteTo(w)
+}
+
+func writeHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(val string) string {
+	return labelEscaper.Replace(val)
+}
+
+// Keeps the count of bytes written and the first error, so that writes can
+// be chained without checking each.
+type countWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countWriter) Write(b []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(b)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
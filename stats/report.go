@@ -0,0 +1,181 @@
+package stats
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+)
+
+// Report summarizes a finished run.
+type Report struct {
+	Start, End time.Time
+	Duration   float64 // seconds
+	InBytes    uint64
+	Chunks     uint64 // indexed
+	Skipped    uint64 // chunks not processed by index: dups or journaled
+	DedupBytes uint64 // of chunks not written for being stored already
+
+	// compression input bytes per output byte, 0 if no compression
+	Compression float64 `json:",omitempty"`
+
+	// parity bytes per data byte, 0 if no parity
+	ParityOverhead float64 `json:",omitempty"`
+
+	Stores []StoreReport
+	Err    string `json:",omitempty"`
+
+	// nothing written: stores only planned to be
+	DryRun bool `json:",omitempty"`
+
+	// min and excl of stripe procs couldn't be met
+	Short bool `json:",omitempty"`
+}
+
+type StoreReport struct {
+	Id            string
+	NewBytes      uint64 // written
+	NewChunks     uint64
+	PresentBytes  uint64 // found on the store already
+	PresentChunks uint64
+	Rate          uint64 // new bytes per second over the run
+	QuotaUse      uint64 `json:",omitempty"` // once done
+	QuotaMax      uint64 `json:",omitempty"` // 0 if unlimited
+}
+
+const (
+	indexId  = "index"
+	parityId = "parity"
+)
+
+var compressIds = []string{"gzip", "zstd", "lz4", "xz"}
+
+// Report summarizes counters of a run started at start, with inBytes read.
+func (st *Statsd) Report(start time.Time, inBytes uint64) Report {
+	snap := st.Snapshot()
+	rep := Report{
+		Start:      start,
+		End:        snap.Time,
+		Duration:   snap.Time.Sub(start).Seconds(),
+		InBytes:    inBytes,
+		DedupBytes: snap.DedupBytes,
+		Stores:     []StoreReport{},
+	}
+	var compIn, compOut uint64
+	for _, p := range snap.Procs {
+		switch {
+		case p.Id == indexId:
+			rep.Chunks = p.InChunks
+			rep.Skipped = p.InChunks - p.OutChunks
+		case p.Id == parityId && p.InBytes > 0:
+			rep.ParityOverhead =
+				float64(p.OutBytes)/float64(p.InBytes) - 1
+		case isCompress(p.Id):
+			compIn += p.InBytes
+			compOut += p.OutBytes
+		case p.Quota != nil || p.NewChunks+p.PresentChunks > 0:
+			sr := StoreReport{
+				Id:            p.Id,
+				NewBytes:      p.NewBytes,
+				NewChunks:     p.NewChunks,
+				PresentBytes:  p.PresentBytes,
+				PresentChunks: p.PresentChunks,
+			}
+			if q := p.Quota; q != nil {
+				sr.QuotaUse, sr.QuotaMax = q.Use, q.Max
+			}
+			if rep.Duration > 0 {
+				sr.Rate = uint64(float64(p.NewBytes) / rep.Duration)
+			}
+			rep.Stores = append(rep.Stores, sr)
+		}
+	}
+	if compOut > 0 {
+		rep.Compression = float64(compIn) / float64(compOut)
+	}
+	return rep
+}
+
+func isCompress(id string) bool {
+	for _, cid := range compressIds {
+		if id == cid {
+			return true
+		}
+	}
+	return false
+}
+
+var _ io.WriterTo = Report{}
+
+// WriteTo writes the report as text.
+func (rep Report) WriteTo(w io.Writer) (int64, error) {
+	cw := &countWriter{w: bufio.NewWriter(w)}
+	tw := tabwriter.NewWriter(cw, 0, 0, 2, ' ', 0)
+	dur := time.Duration(rep.Duration * float64(time.Second))
+	if rep.DryRun {
+		fmt.Fprintf(tw, "dry run:\tnothing written\n")
+	}
+	fmt.Fprintf(tw, "duration:\t%s\n", dur.Round(time.Millisecond))
+	fmt.Fprintf(tw, "input:\t%s\n", humanize.IBytes(rep.InBytes))
+	fmt.Fprintf(tw, "chunks:\t%d (%d skipped)\n", rep.Chunks, rep.Skipped)
+	fmt.Fprintf(tw, "dedup:\t%s\n", humanize.IBytes(rep.DedupBytes))
+	if rep.Compression > 0 {
+		fmt.Fprintf(tw, "compression:\t%.2fx\n", rep.Compression)
+	}
+	if rep.ParityOverhead > 0 {
+		fmt.Fprintf(tw, "parity:\t+%.1f%%\n", rep.ParityOverhead*100)
+	}
+	if rep.DryRun {
+		met := "met"
+		if rep.Short {
+			met = "not met"
+		}
+		fmt.Fprintf(tw, "constraints:\t%s\n", met)
+	}
+	if rep.Err != "" {
+		fmt.Fprintf(tw, "error:\t%s\n", rep.Err)
+	}
+	tw.Flush()
+	if len(rep.Stores) > 0 {
+		fmt.Fprintln(cw)
+		tw = tabwriter.NewWriter(cw, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw,
+			"STORE\tNEW\tCHUNKS\tPRESENT\tCHUNKS\tRATE\tUSE\tQUOTA\tFILL\n")
+		for _, s := range rep.Stores {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%d\t%s/s\t%s\t%s\t%s\n",
+				s.Id,
+				humanize.IBytes(s.NewBytes), s.NewChunks,
+				humanize.IBytes(s.PresentBytes), s.PresentChunks,
+				humanize.IBytes(s.Rate),
+				humanize.IBytes(s.QuotaUse),
+				formatQuota(s.QuotaMax, true),
+				formatQuotaFill(s.QuotaUse, s.QuotaMax),
+			)
+		}
+		tw.Flush()
+	}
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, cw.w.Flush()
+}
+
+// ReportJSON writes R as indented JSON.
+type ReportJSON struct {
+	R Report
+}
+
+var _ io.WriterTo = ReportJSON{}
+
+func (j ReportJSON) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.MarshalIndent(j.R, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(b, '\n'))
+	return int64(n), err
+}
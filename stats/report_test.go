@@ -0,0 +1,81 @@
+package stats_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pbtrung/scat"
+	"github.com/pbtrung/scat/procs"
+	"github.com/pbtrung/scat/stats"
+	"github.com/pbtrung/scat/testutil"
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestReport(t *testing.T) {
+	statsd := stats.New()
+	process := func(id string, proc procs.Proc, data string) {
+		p := stats.Proc{statsd, id, proc}
+		_, err := testutil.ReadChunks(
+			p.Process(scat.NewChunk(0, scat.BytesData(data))),
+		)
+		assert.NoError(t, err)
+	}
+	skip := procs.ProcFunc(func(c *scat.Chunk) <-chan procs.Res {
+		ch := make(chan procs.Res)
+		close(ch)
+		return ch
+	})
+	half := procs.ChunkFunc(func(c *scat.Chunk) (*scat.Chunk, error) {
+		return c.WithData(scat.BytesData("ab")), nil
+	})
+	process("index", procs.Nop, "abcd")
+	process("index", skip, "abcd")
+	process("gzip", half, "abcd")
+	process("parity", procs.ProcFunc(func(c *scat.Chunk) <-chan procs.Res {
+		ch := make(chan procs.Res, 3)
+		for i := 0; i < 3; i++ {
+			ch <- procs.Res{Chunk: c.WithData(scat.BytesData("ab"))}
+		}
+		close(ch)
+		return ch
+	}), "abcd")
+	statsd.AddCopy("a", 4)
+	statsd.AddPresent("a", 2)
+	statsd.AddPresent("b", 2)
+	statsd.AddDedup(2)
+
+	start := time.Now().Add(-2 * time.Second)
+	rep := statsd.Report(start, 8)
+	assert.True(t, rep.Duration >= 2)
+	assert.Equal(t, uint64(8), rep.InBytes)
+	assert.Equal(t, uint64(2), rep.Chunks)
+	assert.Equal(t, uint64(1), rep.Skipped)
+	assert.Equal(t, uint64(2), rep.DedupBytes)
+	assert.Equal(t, 2.0, rep.Compression)
+	assert.Equal(t, 0.5, rep.ParityOverhead)
+	assert.Equal(t, 2, len(rep.Stores))
+	a := rep.Stores[0]
+	assert.Equal(t, "a", a.Id)
+	assert.Equal(t, uint64(4), a.NewBytes)
+	assert.Equal(t, uint64(1), a.NewChunks)
+	assert.Equal(t, uint64(2), a.PresentBytes)
+	assert.Equal(t, uint64(1), a.PresentChunks)
+	assert.True(t, a.Rate > 0 && a.Rate <= 2)
+	assert.Equal(t, "b", rep.Stores[1].Id)
+	assert.Equal(t, uint64(0), rep.Stores[1].Rate)
+
+	buf := &bytes.Buffer{}
+	_, err := rep.WriteTo(buf)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "chunks:       2 (1 skipped)\n")
+	assert.Contains(t, buf.String(), "parity:       +50.0%\n")
+
+	buf.Reset()
+	_, err = stats.ReportJSON{rep}.WriteTo(buf)
+	assert.NoError(t, err)
+	var rep2 stats.Report
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &rep2))
+	assert.Equal(t, rep.Stores, rep2.Stores)
+}
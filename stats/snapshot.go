@@ -0,0 +1,97 @@
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// Snapshot is the state of counters at some point, for machine-readable
+// output.
+type Snapshot struct {
+	Time       time.Time
+	Procs      []ProcSnapshot
+	DedupBytes uint64 // of chunks not written for being stored already
+	Limit      uint64 `json:",omitempty"` // global rate limit
+}
+
+type ProcSnapshot struct {
+	Id        string
+	Inst      int32
+	Rate      uint64 // output bytes per second
+	Limit     uint64 `json:",omitempty"`
+	InBytes   uint64
+	OutBytes  uint64
+	InChunks  uint64
+	OutChunks uint64
+	Quota     *QuotaSnapshot `json:",omitempty"` // stores only
+
+	// chunks written to stores, or found on them already
+	NewBytes      uint64 `json:",omitempty"`
+	NewChunks     uint64 `json:",omitempty"`
+	PresentBytes  uint64 `json:",omitempty"`
+	PresentChunks uint64 `json:",omitempty"`
+}
+
+type QuotaSnapshot struct {
+	Use  uint64
+	Max  uint64  `json:",omitempty"` // none if unlimited
+	Fill float64 `json:",omitempty"` // Use/Max, none if unlimited
+}
+
+func (st *Statsd) Snapshot() Snapshot {
+	snap := Snapshot{
+		Time:       time.Now(),
+		DedupBytes: atomic.LoadUint64(&st.dedup),
+		Limit:      st.Limit,
+	}
+	scnts := st.sortedCounters()
+	snap.Procs = make([]ProcSnapshot, len(scnts))
+	for i, scnt := range scnts {
+		cnt := scnt.cnt
+		inst, _ := cnt.instLast()
+		ps := ProcSnapshot{
+			Id:        fmt.Sprint(scnt.id),
+			Inst:      inst,
+			Rate:      cnt.outAvgRate(time.Second),
+			Limit:     cnt.Limit,
+			InBytes:   atomic.LoadUint64(&cnt.inBytes),
+			OutBytes:  atomic.LoadUint64(&cnt.outBytes),
+			InChunks:  atomic.LoadUint64(&cnt.inChunks),
+			OutChunks: atomic.LoadUint64(&cnt.outChunks),
+
+			NewBytes:      atomic.LoadUint64(&cnt.newBytes),
+			NewChunks:     atomic.LoadUint64(&cnt.newChunks),
+			PresentBytes:  atomic.LoadUint64(&cnt.presentBytes),
+			PresentChunks: atomic.LoadUint64(&cnt.presentChunks),
+		}
+		if max := cnt.Quota.Max; max != 0 {
+			q := &QuotaSnapshot{Use: cnt.Quota.Use}
+			if max != unlimited {
+				q.Max = max
+				q.Fill = float64(q.Use) / float64(max)
+			}
+			ps.Quota = q
+		}
+		snap.Procs[i] = ps
+	}
+	return snap
+}
+
+// JSON writes snapshots of D as JSON lines.
+type JSON struct {
+	D *Statsd
+}
+
+var _ io.WriterTo = JSON{}
+
+func (j JSON) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.Marshal(j.D.Snapshot())
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(b, '\n'))
+	return int64(n), err
+}
@@ -0,0 +1,88 @@
+package stats_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pbtrung/scat"
+	"github.com/pbtrung/scat/procs"
+	"github.com/pbtrung/scat/stats"
+	"github.com/pbtrung/scat/testutil"
+	assert "github.com/stretchr/testify/require"
+)
+
+func newTestStatsd(t *testing.T) *stats.Statsd {
+	statsd := stats.New()
+	double := procs.ProcFunc(func(c *scat.Chunk) <-chan procs.Res {
+		ch := make(chan procs.Res, 2)
+		ch <- procs.Res{Chunk: c}
+		ch <- procs.Res{Chunk: c}
+		close(ch)
+		return ch
+	})
+	proc := stats.Proc{statsd, "double", double}
+	_, err := testutil.ReadChunks(
+		proc.Process(scat.NewChunk(0, scat.BytesData("abc"))),
+	)
+	assert.NoError(t, err)
+	cnt := statsd.Counter("store")
+	cnt.Quota.Use, cnt.Quota.Max = 1, 4
+	cnt.Limit = 1024
+	statsd.AddDedup(5)
+	return statsd
+}
+
+func TestSnapshot(t *testing.T) {
+	snap := newTestStatsd(t).Snapshot()
+	assert.Equal(t, uint64(5), snap.DedupBytes)
+	assert.Equal(t, 2, len(snap.Procs))
+
+	p := snap.Procs[0]
+	assert.Equal(t, "double", p.Id)
+	assert.Equal(t, int32(0), p.Inst)
+	assert.Equal(t, uint64(3), p.InBytes)
+	assert.Equal(t, uint64(6), p.OutBytes)
+	assert.Equal(t, uint64(1), p.InChunks)
+	assert.Equal(t, uint64(2), p.OutChunks)
+	assert.Nil(t, p.Quota)
+
+	p = snap.Procs[1]
+	assert.Equal(t, "store", p.Id)
+	assert.Equal(t, uint64(1024), p.Limit)
+	assert.Equal(t, &stats.QuotaSnapshot{Use: 1, Max: 4, Fill: 0.25}, p.Quota)
+}
+
+func TestJSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+	_, err := stats.JSON{newTestStatsd(t)}.WriteTo(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(buf.String(), "\n"))
+	var snap stats.Snapshot
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &snap))
+	assert.Equal(t, uint64(5), snap.DedupBytes)
+	assert.Equal(t, uint64(6), snap.Procs[0].OutBytes)
+}
+
+func TestPrometheus(t *testing.T) {
+	w := httptest.NewRecorder()
+	stats.Prometheus{newTestStatsd(t)}.ServeHTTP(w, nil)
+	assert.Equal(t, "text/plain; version=0.0.4", w.Header().Get("Content-Type"))
+	out := w.Body.String()
+	for _, line := range []string{
+		"# TYPE scat_proc_out_bytes_total counter",
+		`scat_proc_out_bytes_total{proc="double"} 6`,
+		`scat_proc_in_chunks_total{proc="double"} 1`,
+		`scat_proc_limit_bytes{proc="store"} 1024`,
+		`scat_store_quota_max_bytes{proc="store"} 4`,
+		"scat_dedup_bytes_total 5",
+	} {
+		assert.Contains(t, out, line+"\n")
+	}
+
+	// only set values
+	assert.NotContains(t, out, `scat_proc_limit_bytes{proc="double"}`)
+	assert.NotContains(t, out, "scat_limit_bytes")
+}
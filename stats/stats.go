@@ -19,9 +19,13 @@ const (
 )
 
 type Statsd struct {
+	dedup      uint64 // first for atomic alignment
 	counters   map[id]*Counter
 	countersMu sync.RWMutex
 	nextPos    uint32
+
+	// global rate limit in bytes per second, 0 for none
+	Limit uint64
 }
 
 type id interface{}
@@ -32,6 +36,26 @@ func New() *Statsd {
 	}
 }
 
+// AddDedup counts size bytes of chunks not written for being stored already.
+func (st *Statsd) AddDedup(size uint64) {
+	atomic.AddUint64(&st.dedup, size)
+}
+
+// AddCopy counts a chunk of size bytes written to the store with the given id.
+func (st *Statsd) AddCopy(id interface{}, size uint64) {
+	cnt := st.Counter(id)
+	atomic.AddUint64(&cnt.newChunks, 1)
+	atomic.AddUint64(&cnt.newBytes, size)
+}
+
+// AddPresent counts a chunk of size bytes found on the store with the given
+// id, thus not written to it.
+func (st *Statsd) AddPresent(id interface{}, size uint64) {
+	cnt := st.Counter(id)
+	atomic.AddUint64(&cnt.presentChunks, 1)
+	atomic.AddUint64(&cnt.presentBytes, size)
+}
+
 func (st *Statsd) Counter(id id) *Counter {
 	st.countersMu.Lock()
 	defer st.countersMu.Unlock()
@@ -78,8 +102,8 @@ func (st *Statsd) WriteTo(w io.Writer) (written int64, err error) {
 	}
 
 	// Headers
-	err = write(fmt.Sprintf("%15s\t%s\t%12s\t%11s\t%10s\t%7s\n",
-		"PROC", "INST", "RATE", "USE", "QUOTA", "FILL",
+	err = write(fmt.Sprintf("%15s\t%s\t%12s\t%12s\t%11s\t%10s\t%7s\n",
+		"PROC", "INST", "RATE", "LIMIT", "USE", "QUOTA", "FILL",
 	))
 	if err != nil {
 		return
@@ -89,8 +113,8 @@ func (st *Statsd) WriteTo(w io.Writer) (written int64, err error) {
 	now := time.Now()
 	for _, scnt := range st.sortedCounters() {
 		cnt := scnt.cnt
-		inst := cnt.inst
-		dead := inst == 0 && now.Sub(cnt.last) > aliveThreshold
+		inst, last := cnt.instLast()
+		dead := inst == 0 && now.Sub(last) > aliveThreshold
 		out := ""
 		if !dead {
 			out = humanize.IBytes(cnt.outAvgRate(time.Second)) + "/s"
@@ -101,10 +125,11 @@ func (st *Statsd) WriteTo(w io.Writer) (written int64, err error) {
 		} else {
 			quotaUse = formatQuota(cnt.Quota.Use, cnt.Quota.Max == 0)
 		}
-		line := fmt.Sprintf("%15s\tx%d\t%12s\t%11s\t%10s\t%7s\n",
+		line := fmt.Sprintf("%15s\tx%d\t%12s\t%12s\t%11s\t%10s\t%7s\n",
 			scnt.id,
 			inst,
 			out,
+			formatRate(cnt.Limit),
 			quotaUse,
 			formatQuota(cnt.Quota.Max, true),
 			formatQuotaFill(cnt.Quota.Use, cnt.Quota.Max),
@@ -118,6 +143,16 @@ func (st *Statsd) WriteTo(w io.Writer) (written int64, err error) {
 		}
 	}
 
+	// Global limit
+	if st.Limit > 0 {
+		err = write(fmt.Sprintf("%15s\t\t%12s\t%12s\n",
+			"(all)", "", formatRate(st.Limit),
+		))
+		if err != nil {
+			return
+		}
+	}
+
 	// Goroutines
 	err = write(fmt.Sprintf("%15s\tx%d\n",
 		"(goroutines)", runtime.NumGoroutine(),
@@ -137,6 +172,13 @@ func formatQuota(n uint64, blankZero bool) string {
 	return humanize.IBytes(n)
 }
 
+func formatRate(n uint64) string {
+	if n == 0 {
+		return ""
+	}
+	return humanize.IBytes(n) + "/s"
+}
+
 func formatQuotaFill(used, max uint64) string {
 	switch max {
 	case unlimited:
@@ -149,23 +191,53 @@ func formatQuotaFill(used, max uint64) string {
 }
 
 type Counter struct {
-	pos   uint32
-	last  time.Time
-	inst  int32
-	out   *slidecnt.Counter
-	outMu sync.Mutex
-	Quota struct {
+	// totals, first for atomic alignment
+	inBytes, outBytes        uint64
+	inChunks, outChunks      uint64
+	newBytes, presentBytes   uint64 // stores only
+	newChunks, presentChunks uint64
+
+	pos    uint32
+	inst   int32
+	last   time.Time // of inst change
+	instMu sync.Mutex
+	out    *slidecnt.Counter
+	outMu  sync.Mutex
+	Quota  struct {
 		Init     bool
 		Use, Max uint64
 	}
+
+	// rate limit in bytes per second, 0 for none
+	Limit uint64
 }
 
 func (cnt *Counter) addInst(delta int32) {
-	atomic.AddInt32(&cnt.inst, delta)
+	cnt.instMu.Lock()
+	defer cnt.instMu.Unlock()
+	cnt.inst += delta
 	cnt.last = time.Now()
 }
 
+func (cnt *Counter) instLast() (inst int32, last time.Time) {
+	cnt.instMu.Lock()
+	defer cnt.instMu.Unlock()
+	return cnt.inst, cnt.last
+}
+
+func (cnt *Counter) addIn(size int) {
+	atomic.AddUint64(&cnt.inChunks, 1)
+	if size > 0 {
+		atomic.AddUint64(&cnt.inBytes, uint64(size))
+	}
+}
+
+func (cnt *Counter) addOutChunk() {
+	atomic.AddUint64(&cnt.outChunks, 1)
+}
+
 func (cnt *Counter) addOut(delta uint64) {
+	atomic.AddUint64(&cnt.outBytes, delta)
 	cnt.outMu.Lock()
 	defer cnt.outMu.Unlock()
 	cnt.out.Add(delta)
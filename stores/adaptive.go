@@ -0,0 +1,45 @@
+package stores
+
+import (
+	"github.com/pbtrung/scat/checksum"
+	"github.com/pbtrung/scat/procs"
+	"github.com/pbtrung/scat/slots"
+)
+
+// Adaptive is a store limiting concurrent transfers of Store to adaptive
+// slots, shared by uploads and downloads.
+type Adaptive struct {
+	Store
+	Slots *slots.Adaptive
+}
+
+var (
+	_ Store   = Adaptive{}
+	_ Deleter = adaptiveDeleter{}
+)
+
+// NewAdaptive returns an Adaptive of s, also implementing Deleter if s does.
+// Deletes don't take slots.
+func NewAdaptive(s Store, slots *slots.Adaptive) Store {
+	a := Adaptive{Store: s, Slots: slots}
+	if _, ok := s.(Deleter); ok {
+		return adaptiveDeleter{a}
+	}
+	return a
+}
+
+type adaptiveDeleter struct {
+	Adaptive
+}
+
+func (a adaptiveDeleter) Delete(hash checksum.Hash) error {
+	return a.Store.(Deleter).Delete(hash)
+}
+
+func (a Adaptive) Proc() procs.Proc {
+	return procs.Adaptive{Proc: a.Store.Proc(), Slots: a.Slots}
+}
+
+func (a Adaptive) Unproc() procs.Proc {
+	return procs.Adaptive{Proc: a.Store.Unproc(), Slots: a.Slots}
+}
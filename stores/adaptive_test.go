@@ -0,0 +1,22 @@
+package stores_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pbtrung/scat/checksum"
+	"github.com/pbtrung/scat/slots"
+	"github.com/pbtrung/scat/stores"
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestAdaptiveDelete(t *testing.T) {
+	s := slots.NewAdaptive(1, 2, time.Second)
+	_, ok := stores.NewAdaptive(&flakyStore{}, s).(stores.Deleter)
+	assert.False(t, ok)
+
+	mem := stores.NewMem()
+	del, ok := stores.NewAdaptive(mem, s).(stores.Deleter)
+	assert.True(t, ok)
+	assert.NoError(t, del.Delete(checksum.Hash{}))
+}
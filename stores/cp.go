@@ -7,12 +7,16 @@ import (
 	"path/filepath"
 
 	"github.com/pbtrung/scat"
+	"github.com/pbtrung/scat/checksum"
 	"github.com/pbtrung/scat/procs"
 )
 
 type Cp Dir
 
-var _ Store = Cp{}
+var (
+	_ Store   = Cp{}
+	_ Deleter = Cp{}
+)
 
 func (cp Cp) Proc() procs.Proc {
 	return procs.InplaceFunc(cp.process)
@@ -53,6 +57,14 @@ func (cp Cp) unprocess(c *scat.Chunk) (new *scat.Chunk, err error) {
 	return
 }
 
+func (cp Cp) Delete(hash checksum.Hash) error {
+	err := os.Remove(Dir(cp).FullPath(hash))
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	return err
+}
+
 func (cp Cp) Ls() ([]LsEntry, error) {
 	return Dir(cp).Ls(localLister{})
 }
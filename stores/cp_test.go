@@ -30,6 +30,7 @@ func (test dirStoreTest) run(t *testing.T) {
 	test.testMissingData(t)
 	test.testLs(t)
 	test.testLsMissingDir(t)
+	test.testDelete(t)
 }
 
 func (test dirStoreTest) testReadWrite(t *testing.T) {
@@ -207,3 +208,26 @@ func (test dirStoreTest) testLsMissingDir(t *testing.T) {
 		assert.True(t, os.IsNotExist(err))
 	}
 }
+
+func (test dirStoreTest) testDelete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	hash := testutil.Hash1.Hash
+	store := test(stores.Dir{dir, stores.StrPart{2}})
+	del := store.(stores.Deleter)
+
+	c := scat.NewChunk(0, scat.BytesData("abc"))
+	c.SetHash(hash)
+	_, err = testutil.ReadChunks(store.Proc().Process(c))
+	assert.NoError(t, err)
+
+	assert.NoError(t, del.Delete(hash))
+	ls, err := store.Ls()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(ls))
+
+	// missing
+	assert.NoError(t, del.Delete(hash))
+}
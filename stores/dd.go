@@ -13,6 +13,7 @@ import (
 	"strings"
 
 	"github.com/pbtrung/scat"
+	"github.com/pbtrung/scat/checksum"
 	"github.com/pbtrung/scat/procs"
 )
 
@@ -36,7 +37,10 @@ type Dd struct {
 type commandFunc func(string, ...string) *exec.Cmd
 type strCommandFunc func(env, string) *exec.Cmd
 
-var _ Store = Dd{}
+var (
+	_ Store   = Dd{}
+	_ Deleter = Dd{}
+)
 
 func (s Dd) Proc() procs.Proc {
 	return procs.CmdInFunc(s.process)
@@ -110,6 +114,12 @@ func (s Dd) loadCmd(c *scat.Chunk) (*exec.Cmd, error) {
 	return s.command("dd", "if="+path, ddBsArg), nil
 }
 
+func (s Dd) Delete(hash checksum.Hash) error {
+	path := s.Dir.FullPath(hash)
+	_, err := s.command("rm", "-f", path).Output()
+	return err
+}
+
 func (s Dd) Ls() ([]LsEntry, error) {
 	return s.Dir.Ls(findDirLister(s.command))
 }
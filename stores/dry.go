@@ -0,0 +1,64 @@
+package stores
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/pbtrung/scat"
+	"github.com/pbtrung/scat/checksum"
+	"github.com/pbtrung/scat/procs"
+)
+
+// Dry stands in for stores in dry runs. Like Mem, it lists chunks it got,
+// keeping only their hash and size.
+type Dry struct {
+	sizes   map[checksum.Hash]int64
+	sizesMu sync.RWMutex
+}
+
+var _ Store = (*Dry)(nil)
+
+func NewDry() *Dry {
+	return &Dry{
+		sizes: make(map[checksum.Hash]int64),
+	}
+}
+
+func (s *Dry) Proc() procs.Proc {
+	return procs.InplaceFunc(s.process)
+}
+
+func (s *Dry) process(c *scat.Chunk) error {
+	var size int64
+	if sz, ok := c.Data().(scat.Sizer); ok {
+		size = int64(sz.Size())
+	} else {
+		b, err := c.Data().Bytes()
+		if err != nil {
+			return err
+		}
+		size = int64(len(b))
+	}
+	s.sizesMu.Lock()
+	defer s.sizesMu.Unlock()
+	s.sizes[c.Hash()] = size
+	return nil
+}
+
+func (s *Dry) Unproc() procs.Proc {
+	return procs.ChunkFunc(s.unprocess)
+}
+
+func (s *Dry) unprocess(c *scat.Chunk) (*scat.Chunk, error) {
+	return nil, procs.MissingDataError{errors.New("dry run, no stored data")}
+}
+
+func (s *Dry) Ls() ([]LsEntry, error) {
+	s.sizesMu.RLock()
+	defer s.sizesMu.RUnlock()
+	entries := make([]LsEntry, 0, len(s.sizes))
+	for hash, size := range s.sizes {
+		entries = append(entries, LsEntry{Hash: hash, Size: size})
+	}
+	return entries, nil
+}
@@ -0,0 +1,28 @@
+package stores_test
+
+import (
+	"testing"
+
+	"github.com/pbtrung/scat"
+	"github.com/pbtrung/scat/checksum"
+	"github.com/pbtrung/scat/procs"
+	"github.com/pbtrung/scat/stores"
+	"github.com/pbtrung/scat/testutil"
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestDry(t *testing.T) {
+	dry := stores.NewDry()
+	c := scat.NewChunk(0, scat.BytesData("abc"))
+	c.SetHash(checksum.SumBytes([]byte("abc")))
+	_, err := testutil.ReadChunks(dry.Proc().Process(c))
+	assert.NoError(t, err)
+
+	ls, err := dry.Ls()
+	assert.NoError(t, err)
+	assert.Equal(t, []stores.LsEntry{{Hash: c.Hash(), Size: 3}}, ls)
+
+	// no data kept
+	_, err = testutil.ReadChunks(dry.Unproc().Process(c))
+	assert.IsType(t, procs.MissingDataError{}, err)
+}
@@ -0,0 +1,177 @@
+package stores
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/pbtrung/scat/procs"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrKind classifies store errors, telling whether to retry a transfer, to
+// give up on the store or to look for the chunk elsewhere.
+type ErrKind int
+
+const (
+	// store unusable for the rest of the run
+	ErrPermanent ErrKind = iota
+
+	// might succeed if retried
+	ErrTransient
+
+	// store full
+	ErrQuota
+
+	// chunk not found on the store
+	ErrMissing
+)
+
+func (k ErrKind) String() string {
+	switch k {
+	case ErrTransient:
+		return "transient"
+	case ErrQuota:
+		return "quota"
+	case ErrMissing:
+		return "missing"
+	}
+	return "permanent"
+}
+
+// Error is an error of a known kind, for stores able to tell it apart.
+type Error struct {
+	Kind ErrKind
+	Err  error
+}
+
+func (e Error) Error() string {
+	return e.Err.Error()
+}
+
+// Implemented by errors of stores telling their kind themselves.
+type kinder interface {
+	Kind() ErrKind
+}
+
+// Kind classifies err. Commands exiting with an error (ex: rclone, ssh) and
+// lost connections are deemed transient, other unknown errors permanent.
+func Kind(err error) ErrKind {
+	for {
+		switch e := err.(type) {
+		case Error:
+			return e.Kind
+		case kinder:
+			return e.Kind()
+		case procs.MissingDataError:
+			return ErrMissing
+		case *exec.ExitError:
+			return ErrTransient
+		case *exec.Error:
+			return ErrPermanent
+		case *os.PathError:
+			err = e.Err
+		case *os.LinkError:
+			err = e.Err
+		case *os.SyscallError:
+			err = e.Err
+		case syscall.Errno:
+			return errnoKind(e)
+		case *sftp.StatusError:
+			return sftpStatusKind(e.Code)
+		case *ssh.OpenChannelError:
+			if e.Reason == ssh.ResourceShortage {
+				return ErrTransient
+			}
+			return ErrPermanent
+		case *url.Error:
+			err = e.Err
+		case *net.OpError:
+			if e.Timeout() {
+				return ErrTransient
+			}
+			err = e.Err
+		case *net.DNSError:
+			if e.IsTimeout || e.IsTemporary {
+				return ErrTransient
+			}
+			return ErrPermanent
+		case net.Error:
+			if e.Timeout() {
+				return ErrTransient
+			}
+			return ErrPermanent
+		default:
+			return sentinelKind(err)
+		}
+	}
+}
+
+func sentinelKind(err error) ErrKind {
+	switch {
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, sftp.ErrSSHFxConnectionLost),
+		errors.Is(err, sftp.ErrSSHFxNoConnection):
+		return ErrTransient
+	case errors.Is(err, os.ErrNotExist):
+		return ErrMissing
+	}
+	return ErrPermanent
+}
+
+func errnoKind(errno syscall.Errno) ErrKind {
+	switch errno {
+	case syscall.ENOENT:
+		return ErrMissing
+	case syscall.ENOSPC, syscall.EDQUOT:
+		return ErrQuota
+	case syscall.EAGAIN, syscall.EINTR, syscall.ETIMEDOUT,
+		syscall.ECONNRESET, syscall.ECONNREFUSED, syscall.EPIPE:
+		return ErrTransient
+	}
+	return ErrPermanent
+}
+
+// Classifies errors of HTTP-based stores by response status.
+func httpStatusKind(code int) ErrKind {
+	switch code {
+	case http.StatusNotFound:
+		return ErrMissing
+	case http.StatusInsufficientStorage:
+		return ErrQuota
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return ErrTransient
+	}
+	if code/100 == 5 {
+		return ErrTransient
+	}
+	return ErrPermanent
+}
+
+// Status codes of SSH_FXP_STATUS replies: see draft-ietf-secsh-filexfer-02.
+const (
+	sftpFxNoSuchFile     = 2
+	sftpFxNoConnection   = 6
+	sftpFxConnectionLost = 7
+)
+
+func sftpStatusKind(code uint32) ErrKind {
+	switch code {
+	case sftpFxNoSuchFile:
+		return ErrMissing
+	case sftpFxNoConnection, sftpFxConnectionLost:
+		return ErrTransient
+	}
+	return ErrPermanent
+}
+
+// IsTransient tells whether err is worth retrying.
+func IsTransient(err error) bool {
+	return Kind(err) == ErrTransient
+}
@@ -0,0 +1,208 @@
+package stores_test
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pbtrung/scat"
+	"github.com/pbtrung/scat/checksum"
+	"github.com/pbtrung/scat/procs"
+	"github.com/pbtrung/scat/stores"
+	"github.com/pbtrung/scat/testutil"
+	"github.com/pkg/sftp"
+	assert "github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestKind(t *testing.T) {
+	someErr := errors.New("some err")
+	exitErr := exec.Command("false").Run()
+	assert.IsType(t, &exec.ExitError{}, exitErr)
+	pathErr := func(errno syscall.Errno) error {
+		return &os.PathError{Op: "open", Path: "x", Err: errno}
+	}
+	tests := []struct {
+		err  error
+		kind stores.ErrKind
+	}{
+		{someErr, stores.ErrPermanent},
+		{exitErr, stores.ErrTransient},
+		{procs.MissingDataError{someErr}, stores.ErrMissing},
+		{stores.Error{stores.ErrQuota, someErr}, stores.ErrQuota},
+		{pathErr(syscall.ENOENT), stores.ErrMissing},
+		{pathErr(syscall.ENOSPC), stores.ErrQuota},
+		{pathErr(syscall.EACCES), stores.ErrPermanent},
+		{pathErr(syscall.ETIMEDOUT), stores.ErrTransient},
+		{exec.Command("scat-nonexistent").Run(), stores.ErrPermanent},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.kind, stores.Kind(test.err), "%v", test.err)
+	}
+	assert.True(t, stores.IsTransient(exitErr))
+	assert.False(t, stores.IsTransient(someErr))
+}
+
+func TestKindHTTP(t *testing.T) {
+	s3Err := func(status int, code string) error {
+		return stores.S3Error{StatusCode: status, Code: code}
+	}
+	davErr := func(status int) error {
+		return stores.WebdavError{Method: "PUT", Path: "/x", StatusCode: status}
+	}
+	tests := []struct {
+		err  error
+		kind stores.ErrKind
+	}{
+		{s3Err(503, "SlowDown"), stores.ErrTransient},
+		{s3Err(503, "ServiceUnavailable"), stores.ErrTransient},
+		{s3Err(500, "InternalError"), stores.ErrTransient},
+		{s3Err(200, "InternalError"), stores.ErrTransient},
+		{s3Err(429, "Too Many Requests"), stores.ErrTransient},
+		{s3Err(400, "RequestTimeout"), stores.ErrTransient},
+		{s3Err(403, "AccessDenied"), stores.ErrPermanent},
+		{s3Err(404, "NoSuchBucket"), stores.ErrPermanent},
+		{s3Err(404, "NoSuchKey"), stores.ErrMissing},
+		{davErr(500), stores.ErrTransient},
+		{davErr(502), stores.ErrTransient},
+		{davErr(503), stores.ErrTransient},
+		{davErr(429), stores.ErrTransient},
+		{davErr(507), stores.ErrQuota},
+		{davErr(404), stores.ErrMissing},
+		{davErr(401), stores.ErrPermanent},
+		{davErr(403), stores.ErrPermanent},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.kind, stores.Kind(test.err), "%v", test.err)
+	}
+}
+
+func TestKindNet(t *testing.T) {
+	opErr := func(errno syscall.Errno) error {
+		return &net.OpError{
+			Op: "read", Net: "tcp",
+			Err: &os.SyscallError{Syscall: "read", Err: errno},
+		}
+	}
+	urlErr := func(err error) error {
+		return &url.Error{Op: "Put", URL: "https://x", Err: err}
+	}
+	tests := []struct {
+		err  error
+		kind stores.ErrKind
+	}{
+		{urlErr(opErr(syscall.ECONNRESET)), stores.ErrTransient},
+		{urlErr(opErr(syscall.ECONNREFUSED)), stores.ErrTransient},
+		{urlErr(io.EOF), stores.ErrTransient},
+		{urlErr(io.ErrUnexpectedEOF), stores.ErrTransient},
+		{urlErr(errors.New("unsupported protocol scheme")),
+			stores.ErrPermanent},
+		{opErr(syscall.EPIPE), stores.ErrTransient},
+		{&net.DNSError{Err: "no such host", IsNotFound: true},
+			stores.ErrPermanent},
+		{&net.DNSError{Err: "timeout", IsTimeout: true}, stores.ErrTransient},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.kind, stores.Kind(test.err), "%v", test.err)
+	}
+}
+
+func TestKindSftp(t *testing.T) {
+	tests := []struct {
+		err  error
+		kind stores.ErrKind
+	}{
+		{sftp.ErrSSHFxConnectionLost, stores.ErrTransient},
+		{sftp.ErrSSHFxNoConnection, stores.ErrTransient},
+		{&sftp.StatusError{Code: 7}, stores.ErrTransient},
+		{&sftp.StatusError{Code: 2}, stores.ErrMissing},
+		{&sftp.StatusError{Code: 4}, stores.ErrPermanent},
+		{os.ErrNotExist, stores.ErrMissing},
+		{os.ErrPermission, stores.ErrPermanent},
+		{&ssh.OpenChannelError{Reason: ssh.ResourceShortage},
+			stores.ErrTransient},
+		{&ssh.OpenChannelError{Reason: ssh.Prohibited}, stores.ErrPermanent},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.kind, stores.Kind(test.err), "%v", test.err)
+	}
+}
+
+type flakyStore struct {
+	stores.Store
+	errs []error
+}
+
+func (s *flakyStore) Proc() procs.Proc {
+	return procs.InplaceFunc(func(c *scat.Chunk) error {
+		return s.pop()
+	})
+}
+
+func (s *flakyStore) Ls() ([]stores.LsEntry, error) {
+	return nil, s.pop()
+}
+
+type flakyDeleter struct {
+	*flakyStore
+}
+
+func (s flakyDeleter) Delete(checksum.Hash) error {
+	return s.pop()
+}
+
+func (s *flakyStore) pop() (err error) {
+	if len(s.errs) > 0 {
+		err, s.errs = s.errs[0], s.errs[1:]
+	}
+	return
+}
+
+func TestRetry(t *testing.T) {
+	transient := stores.Error{stores.ErrTransient, errors.New("transient")}
+	quota := stores.Error{stores.ErrQuota, errors.New("quota")}
+	s := &flakyStore{}
+	retry := stores.Retry{Store: s, N: 2, Backoff: time.Millisecond}
+	c := scat.NewChunk(0, nil)
+
+	// proc
+	s.errs = []error{transient, transient}
+	_, err := testutil.ReadChunks(retry.Proc().Process(c))
+	assert.NoError(t, err)
+	s.errs = []error{transient, quota, transient}
+	_, err = testutil.ReadChunks(retry.Proc().Process(c))
+	assert.Equal(t, quota, err)
+	assert.Equal(t, 1, len(s.errs))
+
+	// ls
+	s.errs = []error{transient, transient, transient}
+	_, err = retry.Ls()
+	assert.Equal(t, transient, err)
+	s.errs = []error{transient}
+	_, err = retry.Ls()
+	assert.NoError(t, err)
+}
+
+func TestRetryDelete(t *testing.T) {
+	retry := func(s stores.Store) stores.Store {
+		return stores.NewRetry(s, 2, time.Millisecond)
+	}
+	_, ok := retry(stores.Webdav{}).(stores.Deleter)
+	assert.True(t, ok)
+	_, ok = retry(&flakyStore{}).(stores.Deleter)
+	assert.False(t, ok)
+
+	transient := stores.Error{stores.ErrTransient, errors.New("transient")}
+	s := flakyDeleter{&flakyStore{}}
+	del := retry(s).(stores.Deleter)
+	s.errs = []error{transient, transient}
+	assert.NoError(t, del.Delete(checksum.Hash{}))
+	s.errs = []error{transient, transient, transient}
+	assert.Equal(t, transient, del.Delete(checksum.Hash{}))
+}
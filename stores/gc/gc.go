@@ -0,0 +1,99 @@
+package gc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/pbtrung/scat/checksum"
+	"github.com/pbtrung/scat/concur"
+	"github.com/pbtrung/scat/index"
+	"github.com/pbtrung/scat/stores"
+)
+
+var ErrNoIndex = errors.New("refusing to collect without any live index")
+
+// Live is the set of chunk hashes referenced by the indexes to keep.
+type Live map[checksum.Hash]struct{}
+
+func NewLive() Live {
+	return make(Live)
+}
+
+func (l Live) AddIndex(r io.Reader) error {
+	it := index.NewScanner(0, r)
+	for it.Next() {
+		l[it.Chunk().Hash()] = struct{}{}
+	}
+	return it.Err()
+}
+
+func (l Live) Has(hash checksum.Hash) bool {
+	_, ok := l[hash]
+	return ok
+}
+
+type Store struct {
+	Id interface{}
+	stores.Lister
+	stores.Deleter
+}
+
+// Report is what was, or with dry run would be, freed on a store.
+type Report struct {
+	Id     interface{}
+	Chunks int
+	Bytes  int64
+}
+
+type DeleteError struct {
+	Id   interface{}
+	Hash checksum.Hash
+	Err  error
+}
+
+func (e DeleteError) Error() string {
+	return fmt.Sprintf("gc: delete %x from %v: %v", e.Hash, e.Id, e.Err)
+}
+
+// Lists every store concurrently and deletes, unless dryRun, entries absent
+// from live. Reports are returned in the order of strs.
+func Collect(live Live, strs []Store, dryRun bool) ([]Report, error) {
+	if len(live) == 0 {
+		return nil, ErrNoIndex
+	}
+	reports := make([]Report, len(strs))
+	fns := make(concur.Funcs, len(strs))
+	for i := range strs {
+		i := i
+		fns[i] = func() (err error) {
+			reports[i], err = collect(live, strs[i], dryRun)
+			return
+		}
+	}
+	err := fns.FirstErr()
+	return reports, err
+}
+
+func collect(live Live, st Store, dryRun bool) (rep Report, err error) {
+	rep.Id = st.Id
+	ls, err := st.Ls()
+	if err != nil {
+		return
+	}
+	for _, e := range ls {
+		if live.Has(e.Hash) {
+			continue
+		}
+		if !dryRun {
+			err = st.Delete(e.Hash)
+			if err != nil {
+				err = DeleteError{st.Id, e.Hash, err}
+				return
+			}
+		}
+		rep.Chunks++
+		rep.Bytes += e.Size
+	}
+	return
+}
@@ -0,0 +1,90 @@
+package gc_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/pbtrung/scat/checksum"
+	"github.com/pbtrung/scat/index"
+	"github.com/pbtrung/scat/stores"
+	"github.com/pbtrung/scat/stores/gc"
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestCollect(t *testing.T) {
+	var (
+		h1 = checksum.SumBytes([]byte("a"))
+		h2 = checksum.SumBytes([]byte("b"))
+		h3 = checksum.SumBytes([]byte("c"))
+	)
+	idx1, idx2 := &bytes.Buffer{}, &bytes.Buffer{}
+	index.Write(idx1, h1, 1)
+	index.Write(idx2, h2, 1)
+
+	live := gc.NewLive()
+	assert.NoError(t, live.AddIndex(idx1))
+	assert.NoError(t, live.AddIndex(idx2))
+
+	mem1, mem2 := stores.NewMem(), stores.NewMem()
+	mem1.Set(h1, []byte("a"))
+	mem1.Set(h3, []byte("ccc"))
+	mem2.Set(h2, []byte("b"))
+	mem2.Set(h3, []byte("ccc"))
+	strs := []gc.Store{
+		{"m1", mem1, mem1},
+		{"m2", mem2, mem2},
+	}
+
+	// dry run
+	reports, err := gc.Collect(live, strs, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []gc.Report{
+		{Id: "m1", Chunks: 1, Bytes: 3},
+		{Id: "m2", Chunks: 1, Bytes: 3},
+	}, reports)
+	assert.Equal(t, 2, len(mem1.Hashes()))
+	assert.Equal(t, 2, len(mem2.Hashes()))
+
+	// delete
+	reports, err = gc.Collect(live, strs, false)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), reports[0].Bytes)
+	assert.Equal(t, []checksum.Hash{h1}, mem1.Hashes())
+	assert.Equal(t, []checksum.Hash{h2}, mem2.Hashes())
+
+	// nothing left
+	reports, err = gc.Collect(live, strs, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, reports[0].Chunks)
+	assert.Equal(t, 0, reports[1].Chunks)
+}
+
+func TestCollectNoIndex(t *testing.T) {
+	mem := stores.NewMem()
+	mem.Set(checksum.SumBytes([]byte("a")), []byte("a"))
+	_, err := gc.Collect(gc.NewLive(), []gc.Store{{"m", mem, mem}}, false)
+	assert.Equal(t, gc.ErrNoIndex, err)
+	assert.Equal(t, 1, len(mem.Hashes()))
+}
+
+func TestCollectDeleteErr(t *testing.T) {
+	h := checksum.SumBytes([]byte("a"))
+	live := gc.NewLive()
+	live[checksum.SumBytes([]byte("b"))] = struct{}{}
+	ls := stores.SliceLister{{Hash: h, Size: 1}}
+	someErr := errors.New("some err")
+	_, err := gc.Collect(live, []gc.Store{{"x", ls, failDeleter{someErr}}}, false)
+	delErr, ok := err.(gc.DeleteError)
+	assert.True(t, ok)
+	assert.Equal(t, h, delErr.Hash)
+	assert.Equal(t, someErr, delErr.Err)
+}
+
+type failDeleter struct {
+	err error
+}
+
+func (d failDeleter) Delete(checksum.Hash) error {
+	return d.err
+}
@@ -0,0 +1,35 @@
+package stores
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// HTTPClient is used by S3 and WebDAV stores not given a Client. Unlike
+// http.DefaultClient, it times out on stalled servers, failing transfers with
+// transient errors for retries to recover from, instead of hanging.
+var HTTPClient = &http.Client{
+	// whole transfers, bodies included: generous for large chunks on slow
+	// links
+	Timeout: 10 * time.Minute,
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: time.Minute,
+		ExpectContinueTimeout: time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConns:          100,
+	},
+}
+
+func httpClient(c *http.Client) *http.Client {
+	if c == nil {
+		return HTTPClient
+	}
+	return c
+}
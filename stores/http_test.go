@@ -0,0 +1,40 @@
+package stores_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pbtrung/scat/stores"
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestHTTPClientTimeout(t *testing.T) {
+	stalled := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			<-stalled
+		},
+	))
+	defer srv.Close()
+	defer close(stalled)
+
+	orig := stores.HTTPClient
+	defer func() {
+		stores.HTTPClient = orig
+	}()
+	assert.True(t, orig.Timeout > 0)
+	stores.HTTPClient = &http.Client{Timeout: 50 * time.Millisecond}
+
+	dav, err := stores.NewWebdav(srv.URL, stores.StrPart{2, 1})
+	assert.NoError(t, err)
+	for _, s := range []stores.Lister{
+		dav,
+		stores.NewS3(srv.URL, "bkt", ""),
+	} {
+		_, err := s.Ls()
+		assert.Error(t, err)
+		assert.Equal(t, stores.ErrTransient, stores.Kind(err), "%v", err)
+	}
+}
@@ -0,0 +1,254 @@
+// Package lscache caches listings of stores in a local bolt file, so that
+// copies and quota uses needn't be listed again on each run.
+//
+// Cached listings are kept up to date with copies written through Proc(), and
+// replaced by a full listing once older than the TTL. Commands deleting
+// chunks must Remove() listings of their stores.
+package lscache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pbtrung/scat"
+	"github.com/pbtrung/scat/procs"
+	"github.com/pbtrung/scat/stores"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	keyListed    = []byte("listed")
+	bucketHashes = []byte("hashes")
+)
+
+// Time allowed for another process to release the cache file.
+const lockTimeout = 5 * time.Second
+
+type Cache struct {
+	db  *bolt.DB
+	ttl time.Duration
+}
+
+// Opens the cache file at path, creating it if missing. Listings older than
+// ttl are ignored: with a zero ttl, stores are always listed again.
+func Open(path string, ttl time.Duration) (c *Cache, err error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: lockTimeout})
+	if err != nil {
+		err = fmt.Errorf("lscache %s: %v", path, err)
+		return
+	}
+	c = &Cache{db: db, ttl: ttl}
+	return
+}
+
+func (c *Cache) Close() error {
+	return c.db.Close()
+}
+
+// Store identifies a cached listing: by the id of a store and by its
+// definition, so that an id reused for another store misses the cache.
+type Store struct {
+	Id, Def string
+}
+
+// Separates the id from the hash of the definition in bucket names.
+const bucketSep = 0
+
+// Bucket names start with the id, for Remove(), and end with a hash of the
+// definition, keeping credentials out of the cache.
+func (st Store) bucket() []byte {
+	sum := sha256.Sum256([]byte(st.Def))
+	name := append([]byte(st.Id), bucketSep)
+	return append(name, hex.EncodeToString(sum[:])...)
+}
+
+// Lister returns a lister of the store st, reading the cached listing if
+// fresh, else listing lser and caching the result.
+func (c *Cache) Lister(st Store, lser stores.Lister) stores.Lister {
+	return lister{cache: c, st: st, lser: lser}
+}
+
+type lister struct {
+	cache *Cache
+	st    Store
+	lser  stores.Lister
+}
+
+func (l lister) Ls() ([]stores.LsEntry, error) {
+	ls, ok, err := l.cache.get(l.st)
+	if err != nil || ok {
+		return ls, err
+	}
+	ls, err = l.lser.Ls()
+	if err != nil {
+		return nil, err
+	}
+	return ls, l.cache.put(l.st, ls)
+}
+
+// Returns the cached listing of the store st, if fresh.
+func (c *Cache) get(st Store) (ls []stores.LsEntry, ok bool, err error) {
+	err = c.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(st.bucket())
+		if b == nil {
+			return nil
+		}
+		var listed time.Time
+		err := listed.UnmarshalBinary(b.Get(keyListed))
+		if err != nil {
+			return err
+		}
+		if time.Since(listed) >= c.ttl {
+			return nil
+		}
+		hashes := b.Bucket(bucketHashes)
+		ls = make([]stores.LsEntry, 0, hashes.Stats().KeyN)
+		err = hashes.ForEach(func(k, v []byte) error {
+			e, err := decodeEntry(k, v)
+			ls = append(ls, e)
+			return err
+		})
+		ok = err == nil
+		return err
+	})
+	if err != nil {
+		err = fmt.Errorf("lscache %s: %v", st.Id, err)
+	}
+	return
+}
+
+// Replaces the cached listing of the store st.
+func (c *Cache) put(st Store, ls []stores.LsEntry) error {
+	listed, err := time.Now().MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return c.db.Update(func(tx *bolt.Tx) error {
+		name := st.bucket()
+		if tx.Bucket(name) != nil {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+		}
+		b, err := tx.CreateBucket(name)
+		if err != nil {
+			return err
+		}
+		if err := b.Put(keyListed, listed); err != nil {
+			return err
+		}
+		hashes, err := b.CreateBucket(bucketHashes)
+		if err != nil {
+			return err
+		}
+		for _, e := range ls {
+			if err := hashes.Put(encodeEntry(e)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Add records a copy written to the store st. Copies of stores not listed yet
+// are left to their listing.
+func (c *Cache) Add(st Store, e stores.LsEntry) error {
+	return c.db.Batch(func(tx *bolt.Tx) error {
+		b := tx.Bucket(st.bucket())
+		if b == nil {
+			return nil
+		}
+		return b.Bucket(bucketHashes).Put(encodeEntry(e))
+	})
+}
+
+// Remove drops the cached listings of stores with the given id, whatever
+// their definition, so that they get listed again.
+func (c *Cache) Remove(id string) error {
+	prefix := append([]byte(id), bucketSep)
+	return c.db.Update(func(tx *bolt.Tx) error {
+		var names [][]byte
+		err := tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			if bytes.HasPrefix(name, prefix) {
+				names = append(names, append([]byte{}, name...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func encodeEntry(e stores.LsEntry) (k, v []byte) {
+	v = make([]byte, binary.MaxVarintLen64)
+	v = v[:binary.PutVarint(v, e.Size)]
+	return e.Hash[:], v
+}
+
+func decodeEntry(k, v []byte) (e stores.LsEntry, err error) {
+	err = e.Hash.LoadSlice(k)
+	if err != nil {
+		return
+	}
+	size, n := binary.Varint(v)
+	if n <= 0 {
+		err = fmt.Errorf("invalid size of %x", k)
+	}
+	e.Size = size
+	return
+}
+
+// Proc returns a proc recording to the cache the chunks written by proc to the
+// store st.
+func (c *Cache) Proc(st Store, proc procs.Proc) procs.Proc {
+	return recordProc{cache: c, st: st, Proc: proc}
+}
+
+type recordProc struct {
+	cache *Cache
+	st    Store
+	procs.Proc
+}
+
+var _ procs.WrapperProc = recordProc{}
+
+func (p recordProc) Underlying() procs.Proc {
+	return p.Proc
+}
+
+func (p recordProc) Process(c *scat.Chunk) <-chan procs.Res {
+	ch := p.Proc.Process(c)
+	out := make(chan procs.Res)
+	go func() {
+		defer close(out)
+		var err error
+		for res := range ch {
+			if res.Err != nil {
+				err = res.Err
+			}
+			out <- res
+		}
+		sz, ok := c.Data().(scat.Sizer)
+		if err != nil || !ok {
+			return
+		}
+		e := stores.LsEntry{Hash: c.Hash(), Size: int64(sz.Size())}
+		// a missing record only costs a redundant copy
+		if err := p.cache.Add(p.st, e); err != nil {
+			fmt.Fprintf(os.Stderr, "lscache: %v\n", err)
+		}
+	}()
+	return out
+}
@@ -0,0 +1,185 @@
+package lscache_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pbtrung/scat"
+	"github.com/pbtrung/scat/checksum"
+	"github.com/pbtrung/scat/procs"
+	"github.com/pbtrung/scat/stores"
+	"github.com/pbtrung/scat/stores/lscache"
+	"github.com/pbtrung/scat/testutil"
+	assert "github.com/stretchr/testify/require"
+)
+
+var (
+	s1 = lscache.Store{Id: "s1", Def: "mem"}
+	s2 = lscache.Store{Id: "s2", Def: "mem"}
+)
+
+type countLister struct {
+	n  int
+	ls []stores.LsEntry
+}
+
+func (l *countLister) Ls() ([]stores.LsEntry, error) {
+	l.n++
+	return l.ls, nil
+}
+
+func TestLister(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cache")
+	ha := checksum.SumBytes([]byte("a"))
+	hb := checksum.SumBytes([]byte("b"))
+	lser := &countLister{ls: []stores.LsEntry{{Hash: ha, Size: 1}}}
+
+	cache, err := lscache.Open(path, time.Hour)
+	assert.NoError(t, err)
+
+	// copies of unlisted stores left to their listing
+	assert.NoError(t, cache.Add(s1, stores.LsEntry{Hash: hb, Size: 2}))
+
+	ls, err := cache.Lister(s1, lser).Ls()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, lser.n)
+	assert.Equal(t, lser.ls, ls)
+
+	// cached, with copies added
+	assert.NoError(t, cache.Add(s1, stores.LsEntry{Hash: hb, Size: 2}))
+	ls, err = cache.Lister(s1, lser).Ls()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, lser.n)
+	assert.ElementsMatch(t, []stores.LsEntry{
+		{Hash: ha, Size: 1},
+		{Hash: hb, Size: 2},
+	}, ls)
+
+	// other store
+	_, err = cache.Lister(s2, lser).Ls()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, lser.n)
+	assert.NoError(t, cache.Close())
+
+	// persisted
+	cache, err = lscache.Open(path, time.Hour)
+	assert.NoError(t, err)
+	ls, err = cache.Lister(s1, lser).Ls()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, lser.n)
+	assert.Equal(t, 2, len(ls))
+	assert.NoError(t, cache.Close())
+
+	// expired: listing replaced
+	cache, err = lscache.Open(path, 0)
+	assert.NoError(t, err)
+	defer cache.Close()
+	ls, err = cache.Lister(s1, lser).Ls()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, lser.n)
+	assert.Equal(t, lser.ls, ls)
+}
+
+func TestListerDef(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	cache, err := lscache.Open(filepath.Join(dir, "cache"), time.Hour)
+	assert.NoError(t, err)
+	defer cache.Close()
+	lser := &countLister{}
+	_, err = cache.Lister(s1, lser).Ls()
+	assert.NoError(t, err)
+
+	// id reused for another store
+	other := lscache.Store{Id: "s1", Def: "cp(other)"}
+	_, err = cache.Lister(other, lser).Ls()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, lser.n)
+}
+
+func TestRemove(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	cache, err := lscache.Open(filepath.Join(dir, "cache"), time.Hour)
+	assert.NoError(t, err)
+	defer cache.Close()
+	other := lscache.Store{Id: "s1", Def: "cp(other)"}
+	lser := &countLister{}
+	for _, st := range []lscache.Store{s1, other, s2} {
+		_, err = cache.Lister(st, lser).Ls()
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 3, lser.n)
+
+	assert.NoError(t, cache.Remove("s1"))
+	for _, st := range []lscache.Store{s1, other, s2} {
+		_, err = cache.Lister(st, lser).Ls()
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 5, lser.n)
+}
+
+func TestListerErr(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	cache, err := lscache.Open(filepath.Join(dir, "cache"), time.Hour)
+	assert.NoError(t, err)
+	defer cache.Close()
+	someErr := errors.New("some err")
+	_, err = cache.Lister(s1, errLister{someErr}).Ls()
+	assert.Equal(t, someErr, err)
+
+	// not cached
+	lser := &countLister{}
+	_, err = cache.Lister(s1, lser).Ls()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, lser.n)
+}
+
+type errLister struct {
+	err error
+}
+
+func (l errLister) Ls() ([]stores.LsEntry, error) {
+	return nil, l.err
+}
+
+func TestProc(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	cache, err := lscache.Open(filepath.Join(dir, "cache"), time.Hour)
+	assert.NoError(t, err)
+	defer cache.Close()
+	_, err = cache.Lister(s1, &countLister{}).Ls()
+	assert.NoError(t, err)
+
+	process := func(data string, proc procs.Proc) error {
+		c := scat.NewChunk(0, scat.BytesData(data))
+		c.SetHash(checksum.SumBytes([]byte(data)))
+		_, err := testutil.ReadChunks(cache.Proc(s1, proc).Process(c))
+		return err
+	}
+	someErr := errors.New("some err")
+	failing := procs.InplaceFunc(func(*scat.Chunk) error {
+		return someErr
+	})
+	assert.NoError(t, process("abc", procs.Nop))
+	assert.Equal(t, someErr, process("de", failing))
+
+	ls, err := cache.Lister(s1, &countLister{}).Ls()
+	assert.NoError(t, err)
+	assert.Equal(t, []stores.LsEntry{
+		{Hash: checksum.SumBytes([]byte("abc")), Size: 3},
+	}, ls)
+}
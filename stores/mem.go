@@ -16,7 +16,10 @@ type Mem struct {
 
 type memMap map[checksum.Hash][]byte
 
-var _ Store = (*Mem)(nil)
+var (
+	_ Store   = (*Mem)(nil)
+	_ Deleter = (*Mem)(nil)
+)
 
 func NewMem() *Mem {
 	return &Mem{
@@ -75,10 +78,11 @@ func (s *Mem) Get(hash checksum.Hash) []byte {
 	return s.data[hash]
 }
 
-func (s *Mem) Delete(hash checksum.Hash) {
+func (s *Mem) Delete(hash checksum.Hash) error {
 	s.dataMu.Lock()
 	defer s.dataMu.Unlock()
 	delete(s.data, hash)
+	return nil
 }
 
 func (s *Mem) Ls() ([]LsEntry, error) {
@@ -31,3 +31,12 @@ func TestMemMissingData(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, data, string(b))
 }
+
+func TestMemDelete(t *testing.T) {
+	mem := stores.NewMem()
+	c := scat.NewChunk(0, nil)
+	mem.Set(c.Hash(), []byte("xxx"))
+	assert.NoError(t, mem.Delete(c.Hash()))
+	assert.Nil(t, mem.Get(c.Hash()))
+	assert.NoError(t, mem.Delete(c.Hash()))
+}
@@ -81,3 +81,18 @@ func (man *Man) Resources(use uint64) (ress []Res) {
 	}
 	return
 }
+
+// Free returns the quota left of the resource with the given id, Unlimited
+// if it has none, false if it was deleted or reached its quota.
+func (man *Man) Free(id interface{}) (free uint64, ok bool) {
+	man.mu.RLock()
+	defer man.mu.RUnlock()
+	u, ok := man.m[id]
+	if !ok {
+		return
+	}
+	if u.max == Unlimited {
+		return Unlimited, true
+	}
+	return u.max - u.use, true
+}
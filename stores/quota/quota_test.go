@@ -90,3 +90,25 @@ type resource string
 func (res resource) Id() interface{} {
 	return res
 }
+
+func TestManFree(t *testing.T) {
+	man := quota.NewMan()
+	a := resource("a")
+	b := resource("b")
+	man.AddResQuota(a, 10)
+	man.AddRes(b)
+	man.AddUse(a, 4)
+	man.AddUse(b, 4)
+
+	free, ok := man.Free(a)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(6), free)
+	free, ok = man.Free(b)
+	assert.True(t, ok)
+	assert.Equal(t, quota.Unlimited, free)
+
+	// full
+	man.AddUse(a, 6)
+	_, ok = man.Free(a)
+	assert.False(t, ok)
+}
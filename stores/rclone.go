@@ -17,11 +17,18 @@ import (
 
 var (
 	rcloneNotFoundRe   *regexp.Regexp
+	rcloneQuotaRe      *regexp.Regexp
 	errRcloneZeroBytes = errors.New("downloaded 0 bytes")
 )
 
+const (
+	rcloneExitUsage = 2
+	rcloneExitFatal = 7
+)
+
 func init() {
 	rcloneNotFoundRe = regexp.MustCompile(`\b(?i:not found)\b`)
+	rcloneQuotaRe = regexp.MustCompile(`\b(?i:quota)`)
 }
 
 type Rclone struct {
@@ -30,7 +37,31 @@ type Rclone struct {
 }
 
 func (rc Rclone) Proc() procs.Proc {
-	return procs.NewPathCmdIn(rc.procCmd, rc.Tmp)
+	return procs.Filter{
+		Proc: procs.NewPathCmdIn(rc.procCmd, rc.Tmp),
+		Filter: func(res procs.Res) procs.Res {
+			if res.Err != nil {
+				res.Err = rcloneUploadErr(res.Err)
+			}
+			return res
+		},
+	}
+}
+
+// Classifies upload errors, by exit code as listed in the "Exit Code"
+// section of rclone docs.
+func rcloneUploadErr(err error) error {
+	exit, ok := err.(*exec.ExitError)
+	if !ok {
+		return err
+	}
+	switch {
+	case rcloneQuotaRe.Match(exit.Stderr):
+		return Error{ErrQuota, exit}
+	case exit.ExitCode() == rcloneExitUsage, exit.ExitCode() == rcloneExitFatal:
+		return Error{ErrPermanent, exit}
+	}
+	return err
 }
 
 func (rc Rclone) procCmd(_ *scat.Chunk, path string) (*exec.Cmd, error) {
@@ -101,6 +132,17 @@ func (rc Rclone) loadCmd(c *scat.Chunk) (*exec.Cmd, error) {
 	return cmd, nil
 }
 
+func (rc Rclone) Delete(hash checksum.Hash) error {
+	remote := fmt.Sprintf("%s/%x", rc.Remote, hash)
+	_, err := rcloneDeleteFile(remote).Output()
+	if exit, ok := err.(*exec.ExitError); ok {
+		if rcloneNotFoundRe.Match(exit.Stderr) {
+			err = nil
+		}
+	}
+	return err
+}
+
 func (rc Rclone) Ls() (entries []LsEntry, err error) {
 	cmd := rcloneLs(rc.Remote)
 	out, err := cmd.Output()
@@ -135,4 +177,7 @@ var (
 	rcloneCat = func(remote string) *exec.Cmd {
 		return exec.Command("rclone", "cat", remote)
 	}
+	rcloneDeleteFile = func(remote string) *exec.Cmd {
+		return exec.Command("rclone", "deletefile", remote)
+	}
 )
@@ -102,3 +102,36 @@ func TestRcloneLs(t *testing.T) {
 	assert.Equal(t, int64(27), entries[1].Size)
 	assert.Equal(t, e1h, fmt.Sprintf("%x", entries[1].Hash))
 }
+
+func TestRcloneDelete(t *testing.T) {
+	origDeleteFile := rcloneDeleteFile
+	defer func() {
+		rcloneDeleteFile = origDeleteFile
+	}()
+
+	var (
+		remote   string
+		exitCode int
+		errOut   string
+	)
+	rcloneDeleteFile = func(r string) *exec.Cmd {
+		remote = r
+		return exec.Command("bash", "-c", fmt.Sprintf(
+			`echo -n %q >&2; exit %d`, errOut, exitCode,
+		))
+	}
+	rc := Rclone{Remote: "drive:tmp"}
+	hash := testutil.Hash1.Hash
+
+	err := rc.Delete(hash)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("drive:tmp/%x", hash), remote)
+
+	exitCode, errOut = 1, "2017/02/01 10:17:01 ERROR : x: object not found"
+	err = rc.Delete(hash)
+	assert.NoError(t, err)
+
+	exitCode, errOut = 1, "some other err"
+	err = rc.Delete(hash)
+	assert.IsType(t, &exec.ExitError{}, err)
+}
@@ -0,0 +1,325 @@
+package repair
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/klauspost/reedsolomon"
+	"github.com/pbtrung/scat"
+	"github.com/pbtrung/scat/checksum"
+	"github.com/pbtrung/scat/procs"
+	"github.com/pbtrung/scat/stores"
+	"github.com/pbtrung/scat/stores/copies"
+	"github.com/pbtrung/scat/stripe"
+)
+
+var errNoCopy = errors.New("no valid copy available")
+
+// Repairer restores the placement invariants of a stripe config over chunks of
+// an index, copying under-replicated chunks from surviving copies to new
+// locations, and rebuilding lost parity-split shards from the remaining ones.
+//
+// Copies are verified against their hash before use: chunks must be stored
+// as checksummed, or Unproc must undo what was done after the checksum.
+type Repairer struct {
+	Striper stripe.Striper
+	Stores  []stores.Named
+
+	// Reed-Solomon geometry of groups of consecutive index entries, as
+	// written by parity(ndata nparity). Zero NParity disables rebuilding.
+	NData, NParity int
+
+	// Applied to stored data before checksum verification, to undo
+	// processing done after the final checksum of a backup (ex: encrypt).
+	// Copies are still made of stored data as is, but lost shards can't be
+	// rebuilt. Optional.
+	Unproc procs.Proc
+
+	reg     *copies.Reg
+	byId    map[interface{}]stores.Named
+	procs   map[interface{}]procs.Proc
+	unprocs map[interface{}]procs.Proc
+}
+
+type Report struct {
+	Groups   int
+	Copied   map[interface{}]StoreReport
+	Rebuilt  int
+	Lost     int
+	Failures []error
+}
+
+type StoreReport struct {
+	Chunks int
+	Bytes  int64
+}
+
+func (r *Repairer) Repair(hashes []checksum.Hash) (rep Report, err error) {
+	err = r.init()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if e := r.finish(); e != nil && err == nil {
+			err = e
+		}
+	}()
+	rep.Copied = make(map[interface{}]StoreReport)
+	size := r.groupSize()
+	if len(hashes)%size != 0 {
+		err = fmt.Errorf("index length %d isn't a multiple of group size %d",
+			len(hashes), size)
+		return
+	}
+	ids := make([]interface{}, len(r.Stores))
+	dests := make(stripe.Locs, len(r.Stores))
+	for i, st := range r.Stores {
+		ids[i] = st.Id()
+		dests.Add(st.Id())
+	}
+	seq := &stripe.RR{Items: ids}
+	for i := 0; i < len(hashes); i += size {
+		rep.Groups++
+		err = r.repairGroup(hashes[i:i+size], dests, seq, &rep)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (r *Repairer) finish() (err error) {
+	for _, m := range []map[interface{}]procs.Proc{r.procs, r.unprocs} {
+		for _, p := range m {
+			if e := p.Finish(); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	if r.Unproc != nil {
+		if e := r.Unproc.Finish(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return
+}
+
+func (r *Repairer) init() error {
+	r.reg = copies.NewReg()
+	r.byId = make(map[interface{}]stores.Named, len(r.Stores))
+	r.procs = make(map[interface{}]procs.Proc, len(r.Stores))
+	r.unprocs = make(map[interface{}]procs.Proc, len(r.Stores))
+	ml := make(stores.MultiLister, len(r.Stores))
+	for i, st := range r.Stores {
+		r.byId[st.Id()] = st
+		r.procs[st.Id()] = st.Proc()
+		r.unprocs[st.Id()] = st.Unproc()
+		ml[i] = st
+	}
+	return ml.AddEntriesTo([]stores.LsEntryAdder{
+		stores.CopiesEntryAdder{Reg: r.reg},
+	})
+}
+
+func (r *Repairer) groupSize() int {
+	if r.NParity > 0 {
+		return r.NData + r.NParity
+	}
+	return 1
+}
+
+func (r *Repairer) repairGroup(group []checksum.Hash, dests stripe.Locs,
+	seq stripe.Seq, rep *Report,
+) error {
+	cur := make(stripe.S, len(group))
+	for _, h := range group {
+		locs := make(stripe.Locs)
+		for _, o := range r.reg.List(h).Owners() {
+			locs.Add(o.Id())
+		}
+		cur[h] = locs
+	}
+	newS, err := r.Striper.Stripe(cur, dests, seq)
+	if err != nil {
+		return err
+	}
+	pending := 0
+	for _, locs := range newS {
+		pending += len(locs)
+	}
+	if pending == 0 {
+		return nil
+	}
+
+	data := make(map[checksum.Hash][]byte, len(group))
+	for item, locs := range newS {
+		if len(locs) == 0 {
+			continue
+		}
+		h := item.(checksum.Hash)
+		b, err := r.read(h)
+		if err == errNoCopy {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		data[h] = b
+	}
+	if len(data) < countPending(newS) {
+		rebuilt, err := r.rebuild(group, data)
+		if err != nil {
+			rep.Lost += countPending(newS) - len(data)
+			rep.Failures = append(rep.Failures, err)
+			return nil
+		}
+		rep.Rebuilt += rebuilt
+	}
+
+	for item, locs := range newS {
+		h := item.(checksum.Hash)
+		b, ok := data[h]
+		if !ok {
+			continue
+		}
+		for id := range locs {
+			st := r.byId[id]
+			err := r.write(st, h, b)
+			if err != nil {
+				rep.Failures = append(rep.Failures,
+					fmt.Errorf("write %x to %v: %v", h, id, err))
+				continue
+			}
+			r.reg.List(h).Add(st)
+			sr := rep.Copied[id]
+			sr.Chunks++
+			sr.Bytes += int64(len(b))
+			rep.Copied[id] = sr
+		}
+	}
+	return nil
+}
+
+func countPending(s stripe.S) (n int) {
+	for _, locs := range s {
+		if len(locs) > 0 {
+			n++
+		}
+	}
+	return
+}
+
+// Reads a verified copy of the chunk from the first owner having one. Invalid
+// copies get unregistered.
+func (r *Repairer) read(h checksum.Hash) ([]byte, error) {
+	for _, o := range r.reg.List(h).Owners() {
+		st := o.(stores.Named)
+		c := scat.NewChunk(0, nil)
+		c.SetHash(h)
+		b, err := process(r.unprocs[st.Id()], c)
+		if _, ok := err.(procs.MissingDataError); ok {
+			r.reg.List(h).Remove(st)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !r.valid(h, b) {
+			r.reg.List(h).Remove(st)
+			continue
+		}
+		return b, nil
+	}
+	return nil, errNoCopy
+}
+
+// Reconstructs the shards of group missing from data, reading all the others.
+func (r *Repairer) rebuild(group []checksum.Hash, data map[checksum.Hash][]byte,
+) (n int, err error) {
+	if r.NParity == 0 {
+		err = errors.New("lost chunks and no parity to rebuild them from")
+		return
+	}
+	if r.Unproc != nil {
+		err = errors.New("lost chunks, can't rebuild shards stored processed")
+		return
+	}
+	enc, err := reedsolomon.New(r.NData, r.NParity)
+	if err != nil {
+		return
+	}
+	shards := make([][]byte, len(group))
+	missing := []int{}
+	for i, h := range group {
+		b, ok := data[h]
+		if !ok {
+			b, err = r.read(h)
+			if err == errNoCopy {
+				err = nil
+				missing = append(missing, i)
+				continue
+			}
+			if err != nil {
+				return
+			}
+		}
+		shards[i] = b
+	}
+	if len(missing) > r.NParity {
+		err = fmt.Errorf("%d shards lost out of %d, at most %d recoverable",
+			len(missing), len(group), r.NParity)
+		return
+	}
+	err = enc.Reconstruct(shards)
+	if err != nil {
+		return
+	}
+	for _, i := range missing {
+		h := group[i]
+		if !r.valid(h, shards[i]) {
+			err = fmt.Errorf("rebuilt shard %x doesn't match its checksum", h)
+			return
+		}
+		data[h] = shards[i]
+		n++
+	}
+	return
+}
+
+func (r *Repairer) write(st stores.Named, h checksum.Hash, b []byte) error {
+	c := scat.NewChunk(0, scat.BytesData(b))
+	c.SetHash(h)
+	_, err := process(r.procs[st.Id()], c)
+	return err
+}
+
+func process(proc procs.Proc, c *scat.Chunk) (b []byte, err error) {
+	var out *scat.Chunk
+	for res := range proc.Process(c) {
+		if res.Err != nil && err == nil {
+			err = res.Err
+		}
+		if res.Chunk != nil {
+			out = res.Chunk
+		}
+	}
+	if err != nil || out == nil {
+		return
+	}
+	return out.Data().Bytes()
+}
+
+func (r *Repairer) valid(h checksum.Hash, b []byte) bool {
+	if r.Unproc != nil {
+		c := scat.NewChunk(0, scat.BytesData(b))
+		c.SetHash(h)
+		var err error
+		b, err = process(r.Unproc, c)
+		if err != nil {
+			return false
+		}
+	}
+	sum, err := checksum.Sum(bytes.NewReader(b))
+	return err == nil && sum == h
+}
@@ -0,0 +1,148 @@
+package repair_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/klauspost/reedsolomon"
+	"github.com/pbtrung/scat"
+	"github.com/pbtrung/scat/checksum"
+	"github.com/pbtrung/scat/procs"
+	"github.com/pbtrung/scat/stores"
+	"github.com/pbtrung/scat/stores/repair"
+	"github.com/pbtrung/scat/stripe"
+	assert "github.com/stretchr/testify/require"
+)
+
+func sum(t *testing.T, b []byte) checksum.Hash {
+	h, err := checksum.Sum(bytes.NewReader(b))
+	assert.NoError(t, err)
+	return h
+}
+
+func named(id string, mem *stores.Mem) stores.Named {
+	return stores.Named{id, mem}
+}
+
+func countCopies(h checksum.Hash, mems ...*stores.Mem) (n int) {
+	for _, m := range mems {
+		if m.Get(h) != nil {
+			n++
+		}
+	}
+	return
+}
+
+func TestRepairMinCopies(t *testing.T) {
+	var (
+		ha         = sum(t, []byte("a"))
+		hb         = sum(t, []byte("b"))
+		m1, m2, m3 = stores.NewMem(), stores.NewMem(), stores.NewMem()
+	)
+	m1.Set(ha, []byte("a"))
+	m1.Set(hb, []byte("b"))
+	m2.Set(hb, []byte("b"))
+
+	r := repair.Repairer{
+		Striper: stripe.Config{Min: 2},
+		Stores:  []stores.Named{named("m1", m1), named("m2", m2), named("m3", m3)},
+	}
+	rep, err := r.Repair([]checksum.Hash{ha, hb})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, rep.Groups)
+	assert.Equal(t, 0, rep.Lost)
+	assert.Equal(t, 0, len(rep.Failures))
+	assert.Equal(t, 2, countCopies(ha, m1, m2, m3))
+	assert.Equal(t, 2, countCopies(hb, m1, m2, m3))
+	total := 0
+	for _, sr := range rep.Copied {
+		total += sr.Chunks
+	}
+	assert.Equal(t, 1, total)
+
+	// idempotent
+	rep, err = r.Repair([]checksum.Hash{ha, hb})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(rep.Copied))
+}
+
+func TestRepairCorruptCopy(t *testing.T) {
+	var (
+		ha     = sum(t, []byte("a"))
+		m1, m2 = stores.NewMem(), stores.NewMem()
+	)
+	m1.Set(ha, []byte("x"))
+	r := repair.Repairer{
+		Striper: stripe.Config{Min: 2},
+		Stores:  []stores.Named{named("m1", m1), named("m2", m2)},
+	}
+	rep, err := r.Repair([]checksum.Hash{ha})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, rep.Lost)
+	assert.Equal(t, 1, len(rep.Failures))
+	assert.Nil(t, m2.Get(ha))
+}
+
+func TestRepairUnproc(t *testing.T) {
+	var (
+		ha     = sum(t, []byte("a"))
+		m1, m2 = stores.NewMem(), stores.NewMem()
+	)
+	m1.Set(ha, []byte("A"))
+	lower := procs.ChunkFunc(func(c *scat.Chunk) (*scat.Chunk, error) {
+		b, err := c.Data().Bytes()
+		return c.WithData(scat.BytesData(bytes.ToLower(b))), err
+	})
+	r := repair.Repairer{
+		Striper: stripe.Config{Min: 2},
+		Stores:  []stores.Named{named("m1", m1), named("m2", m2)},
+		Unproc:  lower,
+	}
+	rep, err := r.Repair([]checksum.Hash{ha})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, rep.Lost)
+	assert.Equal(t, 0, len(rep.Failures))
+	assert.Equal(t, []byte("A"), m2.Get(ha))
+}
+
+func TestRepairRebuild(t *testing.T) {
+	enc, err := reedsolomon.New(2, 1)
+	assert.NoError(t, err)
+	shards, err := enc.Split([]byte("some data to split"))
+	assert.NoError(t, err)
+	assert.NoError(t, enc.Encode(shards))
+	hashes := make([]checksum.Hash, len(shards))
+	for i, s := range shards {
+		hashes[i] = sum(t, s)
+	}
+
+	m1, m2, m3 := stores.NewMem(), stores.NewMem(), stores.NewMem()
+	m1.Set(hashes[0], shards[0])
+	m2.Set(hashes[1], shards[1])
+	// shard 2 was on a lost store
+
+	r := repair.Repairer{
+		Striper: stripe.Config{Min: 1, Excl: 3},
+		Stores:  []stores.Named{named("m1", m1), named("m2", m2), named("m3", m3)},
+		NData:   2,
+		NParity: 1,
+	}
+	rep, err := r.Repair(hashes)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, rep.Groups)
+	assert.Equal(t, 1, rep.Rebuilt)
+	assert.Equal(t, 0, rep.Lost)
+	assert.Equal(t, shards[2], m3.Get(hashes[2]))
+
+	// too many lost shards
+	m1.Delete(hashes[0])
+	m3.Delete(hashes[2])
+	rep, err = r.Repair(hashes)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, rep.Lost)
+	assert.Equal(t, 1, len(rep.Failures))
+
+	// index not made of whole groups
+	_, err = r.Repair(hashes[:2])
+	assert.Error(t, err)
+}
@@ -0,0 +1,79 @@
+package stores
+
+import (
+	"time"
+
+	"github.com/pbtrung/scat/checksum"
+	"github.com/pbtrung/scat/procs"
+)
+
+// Retry is a store retrying transient failures of Store, as classified by
+// Kind(), up to N times, waiting Backoff before the first retry and doubling
+// the wait for each next one.
+type Retry struct {
+	Store
+	N       int
+	Backoff time.Duration
+}
+
+var (
+	_ Store   = Retry{}
+	_ Deleter = retryDeleter{}
+)
+
+// NewRetry returns a Retry of s, also implementing Deleter, retrying deletes,
+// if s does.
+func NewRetry(s Store, n int, backoff time.Duration) Store {
+	r := Retry{Store: s, N: n, Backoff: backoff}
+	if _, ok := s.(Deleter); ok {
+		return retryDeleter{r}
+	}
+	return r
+}
+
+func (r Retry) Proc() procs.Proc {
+	return r.retry(r.Store.Proc())
+}
+
+func (r Retry) Unproc() procs.Proc {
+	return r.retry(r.Store.Unproc())
+}
+
+func (r Retry) retry(proc procs.Proc) procs.Proc {
+	return procs.Retry{
+		Proc:      proc,
+		N:         r.N,
+		Backoff:   r.Backoff,
+		Retryable: IsTransient,
+	}
+}
+
+func (r Retry) Ls() (ls []LsEntry, err error) {
+	err = r.do(func() (err error) {
+		ls, err = r.Store.Ls()
+		return
+	})
+	return
+}
+
+func (r Retry) do(fn func() error) (err error) {
+	backoff := r.Backoff
+	for i := 0; ; i++ {
+		err = fn()
+		if err == nil || i >= r.N || !IsTransient(err) {
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+type retryDeleter struct {
+	Retry
+}
+
+func (r retryDeleter) Delete(hash checksum.Hash) error {
+	return r.do(func() error {
+		return r.Store.(Deleter).Delete(hash)
+	})
+}
@@ -0,0 +1,470 @@
+package stores
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pbtrung/scat"
+	"github.com/pbtrung/scat/checksum"
+	"github.com/pbtrung/scat/procs"
+)
+
+const (
+	s3DefaultRegion   = "us-east-1"
+	s3DefaultPartSize = 5 * 1024 * 1024 // minimum allowed by S3
+	s3Service         = "s3"
+	s3SignAlgo        = "AWS4-HMAC-SHA256"
+	s3TimeFormat      = "20060102T150405Z"
+	s3DateFormat      = "20060102"
+)
+
+type S3 struct {
+	Endpoint string
+	Bucket   string
+	Prefix   string
+	Region   string
+	Creds    S3Creds
+	Client   *http.Client // HTTPClient if nil
+
+	// Chunks larger than PartSize are uploaded in parts of PartSize bytes
+	PartSize int
+}
+
+type S3Creds struct {
+	AccessKey, SecretKey, SessionToken string
+}
+
+var (
+	_ Store   = S3{}
+	_ Deleter = S3{}
+)
+
+// Credentials and region are taken from the standard AWS environment
+// variables. Endpoints without a scheme default to HTTPS.
+func NewS3(endpoint, bucket, prefix string) S3 {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = s3DefaultRegion
+	}
+	return S3{
+		Endpoint: strings.TrimRight(endpoint, "/"),
+		Bucket:   bucket,
+		Prefix:   strings.Trim(prefix, "/"),
+		Region:   region,
+		Creds: S3Creds{
+			AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		},
+		PartSize: s3DefaultPartSize,
+	}
+}
+
+type S3Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e S3Error) Error() string {
+	return fmt.Sprintf("s3: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Kind classifies the error by its code, else by its status: errors may come
+// with a 200 status.
+func (e S3Error) Kind() ErrKind {
+	switch e.Code {
+	case "SlowDown", "RequestTimeout", "InternalError", "ServiceUnavailable":
+		return ErrTransient
+	case "NoSuchKey":
+		return ErrMissing
+	case "NoSuchBucket":
+		return ErrPermanent
+	}
+	return httpStatusKind(e.StatusCode)
+}
+
+func (s S3) Proc() procs.Proc {
+	return procs.InplaceFunc(s.process)
+}
+
+func (s S3) process(c *scat.Chunk) (err error) {
+	b, err := c.Data().Bytes()
+	if err != nil {
+		return
+	}
+	key := s.key(c.Hash())
+	size, err := s.head(key)
+	if err == nil && size == int64(len(b)) {
+		return
+	}
+	if _, ok := err.(procs.MissingDataError); err != nil && !ok {
+		return
+	}
+	if s.PartSize > 0 && len(b) > s.PartSize {
+		return s.putMultipart(key, b)
+	}
+	_, err = s.do("PUT", key, nil, b)
+	return
+}
+
+func (s S3) Unproc() procs.Proc {
+	return procs.ChunkFunc(s.unprocess)
+}
+
+func (s S3) unprocess(c *scat.Chunk) (new *scat.Chunk, err error) {
+	res, err := s.do("GET", s.key(c.Hash()), nil, nil)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	new = c.WithData(scat.BytesData(b))
+	return
+}
+
+func (s S3) Delete(hash checksum.Hash) error {
+	res, err := s.do("DELETE", s.key(hash), nil, nil)
+	if _, ok := err.(procs.MissingDataError); ok {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+func (s S3) head(key string) (size int64, err error) {
+	res, err := s.do("HEAD", key, nil, nil)
+	if err != nil {
+		return
+	}
+	res.Body.Close()
+	size = res.ContentLength
+	return
+}
+
+func (s S3) Ls() (entries []LsEntry, err error) {
+	prefix := ""
+	if s.Prefix != "" {
+		prefix = s.Prefix + "/"
+	}
+	var (
+		buf   = make([]byte, checksum.Size)
+		entry LsEntry
+		token string
+	)
+	for {
+		query := url.Values{
+			"list-type": {"2"},
+			"prefix":    {prefix},
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		var list s3ListResult
+		err = s.doXML("GET", "", query, nil, &list)
+		if err != nil {
+			return
+		}
+		for _, obj := range list.Contents {
+			name := strings.TrimPrefix(obj.Key, prefix)
+			if strings.Contains(name, "/") {
+				continue
+			}
+			n, err := fmt.Sscanf(name, "%x", &buf)
+			if err != nil || n != 1 {
+				continue
+			}
+			err = entry.Hash.LoadSlice(buf)
+			if err != nil {
+				continue
+			}
+			entry.Size = obj.Size
+			entries = append(entries, entry)
+		}
+		if !list.IsTruncated || list.NextContinuationToken == "" {
+			break
+		}
+		token = list.NextContinuationToken
+	}
+	return
+}
+
+type s3ListResult struct {
+	IsTruncated           bool
+	NextContinuationToken string
+	Contents              []struct {
+		Key  string
+		Size int64
+	}
+}
+
+func (s S3) putMultipart(key string, b []byte) (err error) {
+	var initRes struct {
+		UploadId string
+	}
+	err = s.doXML("POST", key, url.Values{"uploads": {""}}, nil, &initRes)
+	if err != nil {
+		return
+	}
+	uploadId := initRes.UploadId
+	abort := func() {
+		res, err := s.do("DELETE", key, url.Values{"uploadId": {uploadId}}, nil)
+		if err == nil {
+			res.Body.Close()
+		}
+	}
+	type part struct {
+		PartNumber int
+		ETag       string
+	}
+	var complete struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []part   `xml:"Part"`
+	}
+	for i, off := 1, 0; off < len(b); i, off = i+1, off+s.PartSize {
+		end := off + s.PartSize
+		if end > len(b) {
+			end = len(b)
+		}
+		query := url.Values{
+			"partNumber": {fmt.Sprintf("%d", i)},
+			"uploadId":   {uploadId},
+		}
+		res, err := s.do("PUT", key, query, b[off:end])
+		if err != nil {
+			abort()
+			return err
+		}
+		res.Body.Close()
+		etag := res.Header.Get("ETag")
+		complete.Parts = append(complete.Parts, part{i, etag})
+	}
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		abort()
+		return
+	}
+	query := url.Values{"uploadId": {uploadId}}
+	err = s.doXML("POST", key, query, body, nil)
+	if err != nil {
+		abort()
+	}
+	return
+}
+
+func (s S3) key(hash checksum.Hash) string {
+	return path.Join(s.Prefix, fmt.Sprintf("%x", hash))
+}
+
+func (s S3) doXML(method, key string, query url.Values, body []byte,
+	v interface{},
+) (err error) {
+	res, err := s.do(method, key, query, body)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return
+	}
+	// CompleteMultipartUpload may report errors with a 200 status
+	var s3Err s3ErrorBody
+	if xml.Unmarshal(b, &s3Err) == nil && s3Err.XMLName.Local == "Error" {
+		return S3Error{res.StatusCode, s3Err.Code, s3Err.Message}
+	}
+	if v == nil {
+		return
+	}
+	return xml.Unmarshal(b, v)
+}
+
+type s3ErrorBody struct {
+	XMLName xml.Name
+	Code    string
+	Message string
+}
+
+func (s S3) do(method, key string, query url.Values, body []byte) (
+	res *http.Response, err error,
+) {
+	req, err := s.newRequest(method, key, query, body)
+	if err != nil {
+		return
+	}
+	res, err = httpClient(s.Client).Do(req)
+	if err != nil {
+		return
+	}
+	if res.StatusCode/100 == 2 {
+		return
+	}
+	defer res.Body.Close()
+	err = s3ResponseErr(res)
+	res = nil
+	return
+}
+
+func s3ResponseErr(res *http.Response) error {
+	var body s3ErrorBody
+	b, _ := ioutil.ReadAll(io.LimitReader(res.Body, 64*1024))
+	xml.Unmarshal(b, &body)
+	err := S3Error{
+		StatusCode: res.StatusCode,
+		Code:       body.Code,
+		Message:    body.Message,
+	}
+	if err.Code == "" {
+		err.Code = http.StatusText(res.StatusCode)
+	}
+	if res.StatusCode == http.StatusNotFound && err.Code != "NoSuchBucket" {
+		return procs.MissingDataError{err}
+	}
+	return err
+}
+
+func (s S3) newRequest(method, key string, query url.Values, body []byte) (
+	req *http.Request, err error,
+) {
+	uri := "/" + s.Bucket
+	if key != "" {
+		uri += "/" + key
+	}
+	u, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return
+	}
+	u.Path = path.Join(u.Path, uri)
+	u.RawPath = s3EscapePath(u.Path)
+	u.RawQuery = s3CanonicalQuery(query)
+	req, err = http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.ContentLength = int64(len(body))
+	s.sign(req, body, time.Now().UTC())
+	return
+}
+
+// AWS Signature Version 4, see:
+// https://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html
+func (s S3) sign(req *http.Request, body []byte, now time.Time) {
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	req.Header.Set("X-Amz-Date", now.Format(s3TimeFormat))
+	if s.Creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.Creds.SessionToken)
+	}
+	if s.Creds.AccessKey == "" {
+		return
+	}
+	names := []string{"host"}
+	for k := range req.Header {
+		names = append(names, strings.ToLower(k))
+	}
+	sort.Strings(names)
+	headers := &bytes.Buffer{}
+	for _, name := range names {
+		val := req.Host
+		if val == "" {
+			val = req.URL.Host
+		}
+		if name != "host" {
+			val = strings.Join(req.Header[http.CanonicalHeaderKey(name)], ",")
+		}
+		fmt.Fprintf(headers, "%s:%s\n", name, strings.TrimSpace(val))
+	}
+	signedHeaders := strings.Join(names, ";")
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		headers.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	date := now.Format(s3DateFormat)
+	scope := strings.Join([]string{date, s.Region, s3Service, "aws4_request"}, "/")
+	toSign := strings.Join([]string{
+		s3SignAlgo,
+		now.Format(s3TimeFormat),
+		scope,
+		sha256Hex([]byte(canonical)),
+	}, "\n")
+	key := []byte("AWS4" + s.Creds.SecretKey)
+	for _, part := range []string{date, s.Region, s3Service, "aws4_request"} {
+		key = hmacSha256(key, []byte(part))
+	}
+	sig := hex.EncodeToString(hmacSha256(key, []byte(toSign)))
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3SignAlgo, s.Creds.AccessKey, scope, signedHeaders, sig,
+	))
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func s3EscapePath(p string) string {
+	return s3Escape(p, false)
+}
+
+func s3Escape(str string, escapeSlash bool) string {
+	buf := &bytes.Buffer{}
+	for _, b := range []byte(str) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~':
+			buf.WriteByte(b)
+		case b == '/' && !escapeSlash:
+			buf.WriteByte(b)
+		default:
+			fmt.Fprintf(buf, "%%%02X", b)
+		}
+	}
+	return buf.String()
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSha256(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
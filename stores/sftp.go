@@ -0,0 +1,301 @@
+package stores
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pbtrung/scat"
+	"github.com/pbtrung/scat/checksum"
+	"github.com/pbtrung/scat/procs"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const sftpDefaultPort = "22"
+
+type Sftp struct {
+	Host string
+	Dir  Dir
+	Pool *SftpPool
+}
+
+var (
+	_ Store   = Sftp{}
+	_ Deleter = Sftp{}
+)
+
+func NewSftp(host string, dir Dir) Sftp {
+	return Sftp{Host: host, Dir: dir, Pool: DefaultSftpPool}
+}
+
+func (s Sftp) Proc() procs.Proc {
+	return procs.InplaceFunc(s.process)
+}
+
+func (s Sftp) process(c *scat.Chunk) error {
+	return s.Pool.with(s.Host, func(client *sftp.Client) (err error) {
+		p := s.path(c)
+		if len(s.Dir.Part) > 0 {
+			err = client.MkdirAll(path.Dir(p))
+			if err != nil {
+				return
+			}
+		}
+		f, err := client.Create(p)
+		if err != nil {
+			return
+		}
+		_, err = io.Copy(f, c.Data().Reader())
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		return
+	})
+}
+
+func (s Sftp) Unproc() procs.Proc {
+	return procs.ChunkFunc(s.unprocess)
+}
+
+func (s Sftp) unprocess(c *scat.Chunk) (new *scat.Chunk, err error) {
+	var b []byte
+	err = s.Pool.with(s.Host, func(client *sftp.Client) error {
+		f, err := client.Open(s.path(c))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		b, err = ioutil.ReadAll(f)
+		return err
+	})
+	if os.IsNotExist(err) {
+		err = procs.MissingDataError{err}
+	}
+	new = c.WithData(scat.BytesData(b))
+	return
+}
+
+func (s Sftp) Delete(hash checksum.Hash) error {
+	p := filepath.ToSlash(s.Dir.FullPath(hash))
+	err := s.Pool.with(s.Host, func(client *sftp.Client) error {
+		return client.Remove(p)
+	})
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	return err
+}
+
+func (s Sftp) Ls() (entries []LsEntry, err error) {
+	err = s.Pool.with(s.Host, func(client *sftp.Client) (err error) {
+		entries, err = s.Dir.Ls(sftpDirLister{client})
+		return
+	})
+	return
+}
+
+// Remote paths are always slash-separated, whatever the local OS
+func (s Sftp) path(c *scat.Chunk) string {
+	return filepath.ToSlash(s.Dir.FullPath(c.Hash()))
+}
+
+type sftpDirLister struct {
+	client *sftp.Client
+}
+
+func (l sftpDirLister) Ls(dir string, depth int) <-chan DirLsRes {
+	ch := make(chan DirLsRes)
+	go func() {
+		defer close(ch)
+		err := l.walk(ch, filepath.ToSlash(dir), depth)
+		if err != nil {
+			ch <- DirLsRes{Err: err}
+		}
+	}()
+	return ch
+}
+
+func (l sftpDirLister) walk(ch chan<- DirLsRes, dir string, depth int) error {
+	fis, err := l.client.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, fi := range fis {
+		switch {
+		case depth > 1 && fi.IsDir():
+			err = l.walk(ch, path.Join(dir, fi.Name()), depth-1)
+			if err != nil {
+				return err
+			}
+		case depth == 1 && fi.Mode().IsRegular():
+			ch <- DirLsRes{Name: fi.Name(), Size: fi.Size()}
+		}
+	}
+	return nil
+}
+
+// SftpPool keeps one SSH connection and SFTP session per host, shared by all
+// stores and procs using that host.
+type SftpPool struct {
+	Dial    SftpDialFn
+	clients map[string]*sftp.Client
+	mu      sync.Mutex
+}
+
+type SftpDialFn func(host string) (*sftp.Client, error)
+
+var DefaultSftpPool = NewSftpPool(DialSftp)
+
+func NewSftpPool(dial SftpDialFn) *SftpPool {
+	return &SftpPool{
+		Dial:    dial,
+		clients: make(map[string]*sftp.Client),
+	}
+}
+
+func (p *SftpPool) get(host string) (client *sftp.Client, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	client, ok := p.clients[host]
+	if ok {
+		return
+	}
+	client, err = p.Dial(host)
+	if err != nil {
+		return
+	}
+	p.clients[host] = client
+	return
+}
+
+// Runs fn with the host's client. On connection loss, the client is dropped
+// from the pool for the next call to reconnect.
+func (p *SftpPool) with(host string, fn func(*sftp.Client) error) error {
+	client, err := p.get(host)
+	if err != nil {
+		return err
+	}
+	err = fn(client)
+	if isConnErr(err) {
+		p.drop(host, client)
+	}
+	return err
+}
+
+func (p *SftpPool) drop(host string, client *sftp.Client) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.clients[host] == client {
+		delete(p.clients, host)
+		client.Close()
+	}
+}
+
+func (p *SftpPool) Close() (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for host, client := range p.clients {
+		if e := client.Close(); e != nil && err == nil {
+			err = e
+		}
+		delete(p.clients, host)
+	}
+	return
+}
+
+func isConnErr(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch err {
+	case io.EOF, io.ErrUnexpectedEOF, sftp.ErrSSHFxConnectionLost:
+		return true
+	}
+	_, ok := err.(net.Error)
+	return ok
+}
+
+// Connects to "[user@]host[:port]", authenticating via ssh-agent, if any, and
+// the default private keys in ~/.ssh. Host keys are checked against
+// ~/.ssh/known_hosts.
+func DialSftp(host string) (*sftp.Client, error) {
+	user, addr := splitSftpHost(host)
+	cfg, err := sshClientConfig(user)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := ssh.Dial("tcp", addr, cfg)
+	if err != nil {
+		return nil, err
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+func splitSftpHost(host string) (user, addr string) {
+	user = os.Getenv("USER")
+	if i := strings.LastIndex(host, "@"); i != -1 {
+		user, host = host[:i], host[i+1:]
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, sftpDefaultPort)
+	}
+	addr = host
+	return
+}
+
+var errSshNoAuth = errors.New("ssh: no agent nor private key available")
+
+func sshClientConfig(user string) (cfg *ssh.ClientConfig, err error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return
+	}
+	sshDir := filepath.Join(home, ".ssh")
+	hostKeyCb, err := knownhosts.New(filepath.Join(sshDir, "known_hosts"))
+	if err != nil {
+		return
+	}
+	signers := []ssh.Signer{}
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			if ss, err := agent.NewClient(conn).Signers(); err == nil {
+				signers = append(signers, ss...)
+			}
+		}
+	}
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		b, err := ioutil.ReadFile(filepath.Join(sshDir, name))
+		if err != nil {
+			continue
+		}
+		signer, err := ssh.ParsePrivateKey(b)
+		if err != nil {
+			continue // passphrase-protected: use ssh-agent
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) == 0 {
+		err = errSshNoAuth
+		return
+	}
+	cfg = &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signers...)},
+		HostKeyCallback: hostKeyCb,
+	}
+	return
+}
@@ -0,0 +1,102 @@
+package stores_test
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"testing"
+
+	"github.com/pbtrung/scat"
+	"github.com/pbtrung/scat/procs"
+	"github.com/pbtrung/scat/stores"
+	"github.com/pbtrung/scat/testutil"
+	"github.com/pkg/sftp"
+	assert "github.com/stretchr/testify/require"
+)
+
+func newMemSftpPool() (
+	pool *stores.SftpPool, ndials *int) {
+	ndials = new(int)
+	handlers := sftp.InMemHandler()
+	pool = stores.NewSftpPool(func(host string) (*sftp.Client, error) {
+		if host != "somehost" {
+			return nil, errors.New("unknown host")
+		}
+		*ndials++
+		cliConn, srvConn := net.Pipe()
+		srv := sftp.NewRequestServer(srvConn, handlers)
+		go srv.Serve()
+		return sftp.NewClientPipe(cliConn, cliConn)
+	})
+	return
+}
+
+func TestSftp(t *testing.T) {
+	pool, ndials := newMemSftpPool()
+	defer pool.Close()
+	var (
+		hash = testutil.Hash1.Hash
+		hex  = fmt.Sprintf("%x", hash)
+	)
+	store := stores.Sftp{
+		Host: "somehost",
+		Dir:  stores.Dir{"/some/dir", stores.StrPart{2, 1}},
+		Pool: pool,
+	}
+
+	// write
+	c := scat.NewChunk(0, scat.BytesData("abc"))
+	c.SetHash(hash)
+	chunks, err := testutil.ReadChunks(store.Proc().Process(c))
+	assert.NoError(t, err)
+	assert.Equal(t, []*scat.Chunk{c}, chunks)
+
+	// read
+	c = scat.NewChunk(0, nil)
+	c.SetHash(hash)
+	chunks, err = testutil.ReadChunks(store.Unproc().Process(c))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(chunks))
+	b, err := chunks[0].Data().Bytes()
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", string(b))
+
+	// ls
+	ls, err := store.Ls()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(ls))
+	assert.Equal(t, hash, ls[0].Hash)
+	assert.Equal(t, int64(3), ls[0].Size)
+
+	// missing
+	c = scat.NewChunk(0, nil)
+	c.SetHash(testutil.Hashes[1].Hash)
+	_, err = testutil.ReadChunks(store.Unproc().Process(c))
+	assert.IsType(t, procs.MissingDataError{}, err)
+
+	// pooled connection
+	assert.Equal(t, 1, *ndials)
+
+	// written at the expected path
+	client, err := pool.Dial("somehost")
+	assert.NoError(t, err)
+	defer client.Close()
+	fi, err := client.Stat(path.Join("/some/dir", hex[:2], hex[2:3], hex))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), fi.Size())
+
+	// delete
+	assert.NoError(t, store.Delete(hash))
+	assert.NoError(t, store.Delete(hash))
+	ls, err = store.Ls()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(ls))
+}
+
+func TestSftpDialError(t *testing.T) {
+	pool, _ := newMemSftpPool()
+	store := stores.Sftp{Host: "otherhost", Pool: pool}
+	_, err := store.Ls()
+	assert.Error(t, err)
+}
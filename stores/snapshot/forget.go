@@ -0,0 +1,69 @@
+package snapshot
+
+import (
+	"fmt"
+	"time"
+)
+
+// Policy selects snapshots to keep: the last N ones, and the newest one of
+// each of the last N days, weeks and months having snapshots. A snapshot
+// kept by any rule is kept. The zero Policy keeps everything.
+type Policy struct {
+	Last, Daily, Weekly, Monthly int
+}
+
+func (p Policy) IsZero() bool {
+	return p == Policy{}
+}
+
+// Apply splits snaps, sorted oldest first as returned by Repo.List, into
+// those to keep and to forget, both sorted the same way.
+func (p Policy) Apply(snaps []Snapshot) (keep, forget []Snapshot) {
+	if p.IsZero() {
+		return snaps, nil
+	}
+	type bucket struct {
+		n    int
+		key  func(time.Time) string
+		last string
+	}
+	buckets := []*bucket{
+		{n: p.Daily, key: func(t time.Time) string {
+			return t.Format("2006-01-02")
+		}},
+		{n: p.Weekly, key: func(t time.Time) string {
+			y, w := t.ISOWeek()
+			return fmt.Sprintf("%d-%d", y, w)
+		}},
+		{n: p.Monthly, key: func(t time.Time) string {
+			return t.Format("2006-01")
+		}},
+	}
+	kept := make([]bool, len(snaps))
+	for i := len(snaps) - 1; i >= 0 && i >= len(snaps)-p.Last; i-- {
+		kept[i] = true
+	}
+	for i := len(snaps) - 1; i >= 0; i-- {
+		t := snaps[i].Time.Local()
+		for _, b := range buckets {
+			if b.n == 0 {
+				continue
+			}
+			k := b.key(t)
+			if k == b.last {
+				continue
+			}
+			b.last = k
+			b.n--
+			kept[i] = true
+		}
+	}
+	for i, s := range snaps {
+		if kept[i] {
+			keep = append(keep, s)
+		} else {
+			forget = append(forget, s)
+		}
+	}
+	return
+}
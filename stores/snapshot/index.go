@@ -0,0 +1,155 @@
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/pbtrung/scat"
+	"github.com/pbtrung/scat/checksum"
+	"github.com/pbtrung/scat/procs"
+	"github.com/pbtrung/scat/split"
+	"github.com/pbtrung/scat/stores"
+	"github.com/pbtrung/scat/stores/gc"
+)
+
+var errNoStores = errors.New("no stores")
+
+// PutIndex splits the index read from r into checksummed chunks written to
+// every store, returning their hashes in order.
+func PutIndex(r io.Reader, strs []stores.Named) (hashes []checksum.Hash,
+	err error,
+) {
+	if len(strs) == 0 {
+		err = errNoStores
+		return
+	}
+	ps := make([]procs.Proc, len(strs))
+	for i, st := range strs {
+		ps[i] = st.Proc()
+	}
+	defer func() {
+		if e := finish(ps); e != nil && err == nil {
+			err = e
+		}
+	}()
+	it := split.NewSplitter(0, r)
+	for it.Next() {
+		c := it.Chunk()
+		var h checksum.Hash
+		h, err = checksum.Sum(c.Data().Reader())
+		if err != nil {
+			return
+		}
+		c.SetHash(h)
+		for i, p := range ps {
+			err = process(p, c, nil)
+			if err != nil {
+				err = fmt.Errorf("store %v: %v", strs[i].Id(), err)
+				return
+			}
+		}
+		hashes = append(hashes, h)
+	}
+	err = it.Err()
+	return
+}
+
+// GetIndex writes to w the index made of the given chunks, reading each one
+// from the first store having a valid copy.
+func GetIndex(hashes []checksum.Hash, strs []stores.Named, w io.Writer,
+) (err error) {
+	ps := make([]procs.Proc, len(strs))
+	for i, st := range strs {
+		ps[i] = st.Unproc()
+	}
+	defer func() {
+		if e := finish(ps); e != nil && err == nil {
+			err = e
+		}
+	}()
+	for _, h := range hashes {
+		var b []byte
+		b, err = getChunk(h, ps)
+		if err != nil {
+			return
+		}
+		_, err = w.Write(b)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// AddLive adds to live the chunks of the index of every snapshot of the
+// repository, and the chunks referenced by these indexes, read from strs.
+func (r Repo) AddLive(live gc.Live, strs []stores.Named) error {
+	snaps, err := r.List()
+	if err != nil {
+		return err
+	}
+	for _, s := range snaps {
+		buf := &bytes.Buffer{}
+		err = GetIndex(s.Index, strs, buf)
+		if err != nil {
+			return fmt.Errorf("snapshot %s: %v", s.Id, err)
+		}
+		err = live.AddIndex(buf)
+		if err != nil {
+			return fmt.Errorf("snapshot %s: %v", s.Id, err)
+		}
+		for _, h := range s.Index {
+			live[h] = struct{}{}
+		}
+	}
+	return nil
+}
+
+func getChunk(h checksum.Hash, ps []procs.Proc) ([]byte, error) {
+	for _, p := range ps {
+		c := scat.NewChunk(0, nil)
+		c.SetHash(h)
+		var b []byte
+		err := process(p, c, func(out *scat.Chunk) (err error) {
+			b, err = out.Data().Bytes()
+			return
+		})
+		if err != nil {
+			continue
+		}
+		sum, err := checksum.Sum(bytes.NewReader(b))
+		if err == nil && sum == h {
+			return b, nil
+		}
+	}
+	return nil, procs.MissingDataError{
+		fmt.Errorf("no valid copy of index chunk %x", h),
+	}
+}
+
+func process(p procs.Proc, c *scat.Chunk, fn func(*scat.Chunk) error,
+) (err error) {
+	for res := range p.Process(c) {
+		if res.Err != nil {
+			if err == nil {
+				err = res.Err
+			}
+			continue
+		}
+		if fn != nil && err == nil {
+			err = fn(res.Chunk)
+		}
+	}
+	return
+}
+
+func finish(ps []procs.Proc) (err error) {
+	for _, p := range ps {
+		if e := p.Finish(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return
+}
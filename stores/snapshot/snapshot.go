@@ -0,0 +1,196 @@
+// Package snapshot keeps a repository of backup snapshots: timestamped,
+// tagged records of the index of a backup and the proc strings used to write
+// and read it. Records are small JSON files in a local directory, while
+// indexes are chunked and written to stores like backup data.
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pbtrung/scat/checksum"
+)
+
+const (
+	configName   = "config.json"
+	snapshotsDir = "snapshots"
+	recordExt    = ".json"
+	idTimeFmt    = "20060102T150405Z"
+)
+
+var (
+	ErrNotFound  = errors.New("snapshot not found")
+	ErrAmbiguous = errors.New("ambiguous snapshot id prefix")
+)
+
+type Config struct {
+	// Stores receiving index chunks, as id=store pairs (see
+	// argproc.NewStores)
+	Stores string
+}
+
+type Snapshot struct {
+	Id     string
+	Time   time.Time
+	Tags   []string
+	Proc   string // backup proc string
+	Unproc string `json:",omitempty"` // restore proc string
+
+	// Chunks of the index, in order
+	Index []checksum.Hash
+}
+
+func (s Snapshot) HasTag(tag string) bool {
+	for _, t := range s.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+type Repo struct {
+	Dir    string
+	Config Config
+}
+
+func Init(dir string, cfg Config) (repo Repo, err error) {
+	err = os.MkdirAll(filepath.Join(dir, snapshotsDir), 0755)
+	if err != nil {
+		return
+	}
+	path := filepath.Join(dir, configName)
+	if _, err = os.Stat(path); err == nil {
+		err = fmt.Errorf("%s: repository already initialized", dir)
+		return
+	}
+	err = writeJSON(path, cfg)
+	repo = Repo{Dir: dir, Config: cfg}
+	return
+}
+
+func Open(dir string) (repo Repo, err error) {
+	repo.Dir = dir
+	err = readJSON(filepath.Join(dir, configName), &repo.Config)
+	return
+}
+
+// Save writes the record of s, setting its Id from its time and index if
+// unset.
+func (r Repo) Save(s *Snapshot) error {
+	if s.Id == "" {
+		s.Id = newId(*s)
+	}
+	return writeJSON(r.recordPath(s.Id), s)
+}
+
+func newId(s Snapshot) string {
+	id := s.Time.UTC().Format(idTimeFmt)
+	if len(s.Index) > 0 {
+		id += fmt.Sprintf("-%x", s.Index[0][:4])
+	}
+	return id
+}
+
+// List returns all snapshots, oldest first.
+func (r Repo) List() (snaps []Snapshot, err error) {
+	dir := filepath.Join(r.Dir, snapshotsDir)
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != recordExt {
+			continue
+		}
+		s := Snapshot{}
+		err = readJSON(filepath.Join(dir, f.Name()), &s)
+		if err != nil {
+			return
+		}
+		snaps = append(snaps, s)
+	}
+	sort.Sort(byTime(snaps))
+	return
+}
+
+// Get returns the snapshot whose id is or starts with the given one.
+func (r Repo) Get(id string) (s Snapshot, err error) {
+	snaps, err := r.List()
+	if err != nil {
+		return
+	}
+	found := 0
+	for _, snap := range snaps {
+		if snap.Id == id {
+			return snap, nil
+		}
+		if strings.HasPrefix(snap.Id, id) {
+			s = snap
+			found++
+		}
+	}
+	switch found {
+	case 0:
+		err = ErrNotFound
+	case 1:
+	default:
+		err = ErrAmbiguous
+	}
+	return
+}
+
+// Remove deletes the record of a snapshot. Chunks of its index and of its
+// backup are left on stores, for collection by gc given AddLive.
+func (r Repo) Remove(id string) error {
+	err := os.Remove(r.recordPath(id))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (r Repo) recordPath(id string) string {
+	return filepath.Join(r.Dir, snapshotsDir, id+recordExt)
+}
+
+type byTime []Snapshot
+
+func (s byTime) Len() int      { return len(s) }
+func (s byTime) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byTime) Less(i, j int) bool {
+	if s[i].Time.Equal(s[j].Time) {
+		return s[i].Id < s[j].Id
+	}
+	return s[i].Time.Before(s[j].Time)
+}
+
+func readJSON(path string, v interface{}) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// Writes to a temp file renamed into place, so that records are never
+// partially written.
+func writeJSON(path string, v interface{}) (err error) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return
+	}
+	tmp := path + ".tmp"
+	err = ioutil.WriteFile(tmp, append(b, '\n'), 0644)
+	if err != nil {
+		return
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,167 @@
+package snapshot_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pbtrung/scat/checksum"
+	"github.com/pbtrung/scat/split"
+	"github.com/pbtrung/scat/stores"
+	"github.com/pbtrung/scat/stores/gc"
+	"github.com/pbtrung/scat/stores/snapshot"
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestRepo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cfg := snapshot.Config{Stores: "a=mem"}
+	_, err = snapshot.Init(dir, cfg)
+	assert.NoError(t, err)
+	_, err = snapshot.Init(dir, cfg)
+	assert.Error(t, err)
+	repo, err := snapshot.Open(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, cfg, repo.Config)
+
+	t0 := time.Date(2017, 2, 1, 10, 0, 0, 0, time.UTC)
+	s1 := snapshot.Snapshot{
+		Time:  t0.Add(time.Hour),
+		Tags:  []string{"foo"},
+		Proc:  "index foo_index",
+		Index: []checksum.Hash{checksum.SumBytes([]byte("a"))},
+	}
+	s2 := snapshot.Snapshot{Time: t0, Proc: "index -"}
+	assert.NoError(t, repo.Save(&s1))
+	assert.NoError(t, repo.Save(&s2))
+	assert.Equal(t, "20170201T110000Z-1f40fc92", s1.Id)
+	assert.Equal(t, "20170201T100000Z", s2.Id)
+
+	snaps, err := repo.List()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(snaps))
+	assert.Equal(t, s2.Id, snaps[0].Id)
+	assert.Equal(t, s1.Index, snaps[1].Index)
+	assert.True(t, snaps[1].HasTag("foo"))
+
+	s, err := repo.Get("20170201T11")
+	assert.NoError(t, err)
+	assert.Equal(t, s1.Id, s.Id)
+	_, err = repo.Get("2017")
+	assert.Equal(t, snapshot.ErrAmbiguous, err)
+	_, err = repo.Get("x")
+	assert.Equal(t, snapshot.ErrNotFound, err)
+
+	assert.NoError(t, repo.Remove(s2.Id))
+	assert.Equal(t, snapshot.ErrNotFound, repo.Remove(s2.Id))
+	snaps, err = repo.List()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(snaps))
+}
+
+func TestPolicy(t *testing.T) {
+	day := 24 * time.Hour
+	// monday
+	t0 := time.Date(2017, 1, 30, 12, 0, 0, 0, time.Local)
+	snaps := []snapshot.Snapshot{}
+	for i, d := range []time.Duration{
+		0, time.Hour, day, 2 * day, 7 * day, 8 * day, 8*day + time.Hour,
+	} {
+		snaps = append(snaps, snapshot.Snapshot{
+			Id:   string('a' + rune(i)),
+			Time: t0.Add(d),
+		})
+	}
+	ids := func(snaps []snapshot.Snapshot) (res string) {
+		for _, s := range snaps {
+			res += s.Id
+		}
+		return
+	}
+	apply := func(p snapshot.Policy) (string, string) {
+		keep, forget := p.Apply(snaps)
+		return ids(keep), ids(forget)
+	}
+
+	keep, forget := apply(snapshot.Policy{})
+	assert.Equal(t, "abcdefg", keep)
+	assert.Equal(t, "", forget)
+
+	keep, forget = apply(snapshot.Policy{Last: 2})
+	assert.Equal(t, "fg", keep)
+	assert.Equal(t, "abcde", forget)
+
+	keep, _ = apply(snapshot.Policy{Daily: 3})
+	assert.Equal(t, "deg", keep)
+
+	keep, _ = apply(snapshot.Policy{Weekly: 2})
+	assert.Equal(t, "dg", keep)
+
+	keep, _ = apply(snapshot.Policy{Last: 1, Monthly: 2})
+	assert.Equal(t, "cg", keep)
+}
+
+func TestIndex(t *testing.T) {
+	// larger than the max chunk size
+	data := make([]byte, 2*split.DefaultMax+1)
+	_, err := rand.Read(data)
+	assert.NoError(t, err)
+	m1, m2 := stores.NewMem(), stores.NewMem()
+	strs := []stores.Named{{"m1", m1}, {"m2", m2}}
+	hashes, err := snapshot.PutIndex(bytes.NewReader(data), strs)
+	assert.NoError(t, err)
+	assert.True(t, len(hashes) > 1)
+	for _, h := range hashes {
+		assert.NotNil(t, m1.Get(h))
+		assert.NotNil(t, m2.Get(h))
+	}
+
+	// corrupt and missing chunks in the first store
+	m1.Set(hashes[0], []byte("x"))
+	m1.Delete(hashes[1])
+	buf := &bytes.Buffer{}
+	assert.NoError(t, snapshot.GetIndex(hashes, strs, buf))
+	assert.Equal(t, data, buf.Bytes())
+
+	m2.Delete(hashes[1])
+	err = snapshot.GetIndex(hashes, strs, &bytes.Buffer{})
+	assert.Error(t, err)
+}
+
+func TestAddLive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	repo, err := snapshot.Init(dir, snapshot.Config{Stores: "m=mem"})
+	assert.NoError(t, err)
+
+	data := checksum.SumBytes([]byte("data"))
+	idx := fmt.Sprintf("%x 4\n", data)
+	mem := stores.NewMem()
+	strs := []stores.Named{{"m", mem}}
+	hashes, err := snapshot.PutIndex(strings.NewReader(idx), strs)
+	assert.NoError(t, err)
+	s := &snapshot.Snapshot{Time: time.Now(), Index: hashes}
+	assert.NoError(t, repo.Save(s))
+
+	live := gc.NewLive()
+	assert.NoError(t, repo.AddLive(live, strs))
+	assert.True(t, live.Has(data))
+	for _, h := range hashes {
+		assert.True(t, live.Has(h))
+	}
+
+	// forgotten
+	assert.NoError(t, repo.Remove(s.Id))
+	live = gc.NewLive()
+	assert.NoError(t, repo.AddLive(live, strs))
+	assert.False(t, live.Has(data))
+}
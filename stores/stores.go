@@ -19,6 +19,12 @@ type Lister interface {
 	Ls() ([]LsEntry, error)
 }
 
+// Deleter is implemented by stores able to remove chunks. Deleting a missing
+// chunk isn't an error.
+type Deleter interface {
+	Delete(checksum.Hash) error
+}
+
 type LsEntry struct {
 	Hash checksum.Hash
 	Size int64
@@ -32,6 +38,15 @@ func (sl SliceLister) Ls() ([]LsEntry, error) {
 	return []LsEntry(sl), nil
 }
 
+type Named struct {
+	IdVal interface{}
+	Store
+}
+
+func (n Named) Id() interface{} {
+	return n.IdVal
+}
+
 type Copier struct {
 	IdVal interface{}
 	Lister
@@ -0,0 +1,232 @@
+package stripe
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pbtrung/scat/stores/quota"
+)
+
+// Policy orders copiers for striping each chunk, preferred first, in place
+// of the default round-robin. Whatever the order, min and excl of the
+// stripe.Striper are met.
+type Policy interface {
+	Order(ids []interface{}) []interface{}
+}
+
+// Observer is implemented by policies learning from transfers: each copy of
+// size bytes by the copier with the given id, which took d.
+type Observer interface {
+	Observe(id interface{}, size uint64, d time.Duration)
+}
+
+// Implemented by policies configured per copier, to check them against ids
+// of copiers striped to.
+type checker interface {
+	check(ids []interface{}) error
+}
+
+// QuotaWeighted picks copiers randomly, weighted by quota left. Unlimited
+// ones weigh as the limited one with the most quota left.
+type QuotaWeighted struct {
+	Qman *quota.Man
+}
+
+func (p QuotaWeighted) Order(ids []interface{}) []interface{} {
+	free := make(map[interface{}]float64, len(ids))
+	max, unlimited := float64(1), []interface{}{}
+	for _, id := range ids {
+		f, ok := p.Qman.Free(id)
+		switch {
+		case !ok:
+			free[id] = 0
+		case f == quota.Unlimited:
+			unlimited = append(unlimited, id)
+		default:
+			free[id] = float64(f)
+			max = math.Max(max, free[id])
+		}
+	}
+	for _, id := range unlimited {
+		free[id] = max
+	}
+	return weightedOrder(ids, func(id interface{}) float64 {
+		return free[id]
+	})
+}
+
+// RateWeighted picks copiers randomly, weighted by their throughput measured
+// so far. Those not measured yet weigh as the fastest one, to get measured.
+type RateWeighted struct {
+	rates map[interface{}]float64 // bytes per second
+	mu    sync.Mutex
+}
+
+var _ Observer = (*RateWeighted)(nil)
+
+func NewRateWeighted() *RateWeighted {
+	return &RateWeighted{rates: make(map[interface{}]float64)}
+}
+
+// Weight of the last transfer in the moving average of throughput.
+const rateSmoothing = 0.3
+
+func (p *RateWeighted) Observe(id interface{}, size uint64, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	rate := float64(size) / d.Seconds()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if prev, ok := p.rates[id]; ok {
+		rate = prev + rateSmoothing*(rate-prev)
+	}
+	p.rates[id] = rate
+}
+
+func (p *RateWeighted) Order(ids []interface{}) []interface{} {
+	p.mu.Lock()
+	max := float64(1)
+	for _, r := range p.rates {
+		max = math.Max(max, r)
+	}
+	rates := make(map[interface{}]float64, len(ids))
+	for _, id := range ids {
+		r, ok := p.rates[id]
+		if !ok {
+			r = max
+		}
+		rates[id] = r
+	}
+	p.mu.Unlock()
+	return weightedOrder(ids, func(id interface{}) float64 {
+		return rates[id]
+	})
+}
+
+// Returns ids in random order, each id coming before the others with
+// probability proportional to its weight: the ones weighing 0 come last.
+func weightedOrder(ids []interface{},
+	weight func(interface{}) float64,
+) []interface{} {
+	keys := make(map[interface{}]float64, len(ids))
+	for _, id := range ids {
+		keys[id] = rand.ExpFloat64() / weight(id)
+	}
+	res := append([]interface{}{}, ids...)
+	sort.SliceStable(res, func(i, j int) bool {
+		return keys[res[i]] < keys[res[j]]
+	})
+	return res
+}
+
+// Local puts the copiers of Ids first, in that order, for a first copy on
+// local stores, and the others round-robin.
+type Local struct {
+	Ids []interface{}
+	rr  rotation
+}
+
+var _ checker = (*Local)(nil)
+
+func (p *Local) Order(ids []interface{}) []interface{} {
+	local := make(map[interface{}]bool, len(p.Ids))
+	for _, id := range p.Ids {
+		local[id] = true
+	}
+	res := make([]interface{}, 0, len(ids))
+	others := make([]interface{}, 0, len(ids))
+	for _, id := range p.Ids {
+		if contains(ids, id) {
+			res = append(res, id)
+		}
+	}
+	for _, id := range ids {
+		if !local[id] {
+			others = append(others, id)
+		}
+	}
+	return append(res, p.rr.next(others)...)
+}
+
+func (p *Local) check(ids []interface{}) error {
+	for _, id := range p.Ids {
+		if !contains(ids, id) {
+			return fmt.Errorf("local: no such copier: %v", id)
+		}
+	}
+	return nil
+}
+
+// Price of storing on a store, and of retrieving from it, per GiB.
+type Price struct {
+	Storage, Egress float64
+}
+
+// Cost puts cheaper copiers first: by storage price plus egress price, ie
+// the cost of storing and restoring once. Equally priced ones are taken
+// round-robin.
+type Cost struct {
+	Prices map[interface{}]Price
+	rr     rotation
+}
+
+var _ checker = (*Cost)(nil)
+
+func (p *Cost) Order(ids []interface{}) []interface{} {
+	res := p.rr.next(ids)
+	cost := func(i int) float64 {
+		pr := p.Prices[res[i]]
+		return pr.Storage + pr.Egress
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return cost(i) < cost(j)
+	})
+	return res
+}
+
+func (p *Cost) check(ids []interface{}) error {
+	for _, id := range ids {
+		if _, ok := p.Prices[id]; !ok {
+			return fmt.Errorf("cost: no price for copier: %v", id)
+		}
+	}
+	for id := range p.Prices {
+		if !contains(ids, id) {
+			return fmt.Errorf("cost: no such copier: %v", id)
+		}
+	}
+	return nil
+}
+
+// Rotates slices by one more item at each call.
+type rotation struct {
+	cur int
+	mu  sync.Mutex
+}
+
+func (r *rotation) next(items []interface{}) []interface{} {
+	res := make([]interface{}, 0, len(items))
+	if len(items) == 0 {
+		return res
+	}
+	r.mu.Lock()
+	n := r.cur % len(items)
+	r.cur++
+	r.mu.Unlock()
+	res = append(res, items[n:]...)
+	return append(res, items[:n]...)
+}
+
+func contains(ids []interface{}, id interface{}) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
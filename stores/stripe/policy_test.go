@@ -0,0 +1,105 @@
+package stripe_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pbtrung/scat"
+	"github.com/pbtrung/scat/checksum"
+	"github.com/pbtrung/scat/procs"
+	"github.com/pbtrung/scat/stores"
+	"github.com/pbtrung/scat/stores/quota"
+	storestripe "github.com/pbtrung/scat/stores/stripe"
+	"github.com/pbtrung/scat/stripe"
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestQuotaWeighted(t *testing.T) {
+	qman := quota.NewMan()
+	a := stores.Copier{"a", stores.SliceLister{}, procs.Nop}
+	b := stores.Copier{"b", stores.SliceLister{}, procs.Nop}
+	qman.AddResQuota(a, 10)
+	qman.AddRes(b)
+	qman.AddUse(a, 10)
+	p := storestripe.QuotaWeighted{Qman: qman}
+
+	// full last
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, []interface{}{"b", "a"}, p.Order(ids("a", "b")))
+	}
+}
+
+func TestRateWeighted(t *testing.T) {
+	p := storestripe.NewRateWeighted()
+	p.Observe("a", 0, time.Second)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, []interface{}{"b", "a"}, p.Order(ids("a", "b")))
+	}
+}
+
+func TestLocal(t *testing.T) {
+	p := &storestripe.Local{Ids: ids("c")}
+	assert.Equal(t, ids("c", "a", "b"), p.Order(ids("a", "b", "c")))
+	assert.Equal(t, ids("c", "b", "a"), p.Order(ids("a", "b", "c")))
+	assert.Equal(t, ids("c", "a", "b"), p.Order(ids("a", "b", "c")))
+}
+
+func TestCost(t *testing.T) {
+	p := &storestripe.Cost{Prices: map[interface{}]storestripe.Price{
+		"a": {Storage: 0.02, Egress: 0.09},
+		"b": {Storage: 0.005, Egress: 0.01},
+		"c": {Storage: 0.015},
+	}}
+	assert.Equal(t, ids("b", "c", "a"), p.Order(ids("a", "b", "c")))
+
+	// equal prices round-robin
+	p.Prices["c"] = p.Prices["b"]
+	assert.Equal(t, ids("b", "c", "a"), p.Order(ids("a", "b", "c")))
+	assert.Equal(t, ids("c", "b", "a"), p.Order(ids("a", "b", "c")))
+}
+
+func TestStripePolicy(t *testing.T) {
+	copied := map[interface{}]bool{}
+	newSp := func(policy storestripe.Policy) (procs.DynProcer, error) {
+		qman := quota.NewMan()
+		for _, id := range []string{"a", "b", "c"} {
+			qman.AddRes(stores.Copier{id, stores.SliceLister{}, procs.Nop})
+		}
+		cfg := stripe.Config{Min: 2}
+		return storestripe.NewWithOptions(cfg, qman, storestripe.Options{
+			Policy: policy,
+			OnCopy: func(id interface{}, _ uint64) { copied[id] = true },
+		})
+	}
+
+	// cheapest
+	sp, err := newSp(&storestripe.Cost{
+		Prices: map[interface{}]storestripe.Price{
+			"a": {Storage: 3}, "b": {Storage: 1}, "c": {Storage: 2},
+		},
+	})
+	assert.NoError(t, err)
+	chunk := scat.NewChunk(0, scat.BytesData("x"))
+	chunk.SetHash(checksum.SumBytes([]byte("x")))
+	procs, err := sp.Procs(chunk)
+	assert.NoError(t, err)
+	_, err = processByAll(chunk, procs)
+	assert.NoError(t, err)
+	assert.Equal(t, map[interface{}]bool{"b": true, "c": true}, copied)
+
+	// unknown copiers
+	_, err = newSp(&storestripe.Cost{
+		Prices: map[interface{}]storestripe.Price{"a": {}, "b": {}},
+	})
+	assert.Error(t, err)
+	_, err = newSp(&storestripe.Local{Ids: ids("d")})
+	assert.Error(t, err)
+}
+
+func ids(strs ...string) []interface{} {
+	res := make([]interface{}, len(strs))
+	for i, s := range strs {
+		res[i] = s
+	}
+	return res
+}
@@ -2,11 +2,14 @@ package stripe
 
 import (
 	"errors"
+	"fmt"
 	"sync"
+	"time"
 
 	"github.com/pbtrung/scat"
 	"github.com/pbtrung/scat/checksum"
 	"github.com/pbtrung/scat/concur"
+	"github.com/pbtrung/scat/journal"
 	"github.com/pbtrung/scat/procs"
 	"github.com/pbtrung/scat/stores"
 	"github.com/pbtrung/scat/stores/copies"
@@ -15,15 +18,47 @@ import (
 )
 
 type stripeP struct {
-	cfg    stripe.Striper
-	qman   *quota.Man
-	reg    *copies.Reg
-	seq    stripe.Seq
-	seqMu  sync.Mutex
-	finish func() error
+	cfg     stripe.Striper
+	qman    *quota.Man
+	reg     *copies.Reg
+	journal *journal.Journal
+	opts    Options
+	ids     []interface{}
+	seq     stripe.Seq
+	seqMu   sync.Mutex
+	finish  func() error
 }
 
 func New(cfg stripe.Striper, qman *quota.Man) (procs.DynProcer, error) {
+	return NewJournal(cfg, qman, nil)
+}
+
+// Like New(), also recording listings and written copies to j, unless nil.
+// Stores it has fully listed aren't listed again.
+func NewJournal(cfg stripe.Striper, qman *quota.Man, j *journal.Journal,
+) (procs.DynProcer, error) {
+	return NewWithOptions(cfg, qman, Options{Journal: j})
+}
+
+// Options of the proc returned by NewWithOptions(). Zero fields are unused.
+type Options struct {
+	// as for NewJournal()
+	Journal *journal.Journal
+
+	// called with the size of chunks left as is for having enough copies
+	OnDedup func(size uint64)
+
+	// called with the id of copiers and the size of chunks they got a copy
+	// of, or already had
+	OnCopy, OnPresent func(id interface{}, size uint64)
+
+	// orders copiers instead of round-robin
+	Policy Policy
+}
+
+func NewWithOptions(cfg stripe.Striper, qman *quota.Man, opts Options,
+) (procs.DynProcer, error) {
+	j := opts.Journal
 	reg := copies.NewReg()
 	ress := copiersRes(qman.Resources(0))
 	ids := ress.ids()
@@ -32,26 +67,73 @@ func New(cfg stripe.Striper, qman *quota.Man) (procs.DynProcer, error) {
 		rrItems[i] = id
 	}
 	seq := &stripe.RR{Items: rrItems}
-	ml := stores.MultiLister(ress.listers())
-	err := ml.AddEntriesTo([]stores.LsEntryAdder{
+	if c, ok := opts.Policy.(checker); ok {
+		if err := c.check(ids); err != nil {
+			return nil, err
+		}
+	}
+	adders := []stores.LsEntryAdder{
 		stores.QuotaEntryAdder{Qman: qman},
 		stores.CopiesEntryAdder{Reg: reg},
-	})
+	}
+	var err error
+	if j == nil {
+		err = stores.MultiLister(ress.listers()).AddEntriesTo(adders)
+	} else {
+		err = addJournalEntries(j, ress, adders)
+	}
 	dynp := &stripeP{
-		cfg:    cfg,
-		qman:   qman,
-		reg:    reg,
-		seq:    seq,
-		finish: ress.finishFuncs().FirstErr,
+		cfg:     cfg,
+		qman:    qman,
+		reg:     reg,
+		journal: j,
+		opts:    opts,
+		ids:     ids,
+		seq:     seq,
+		finish:  ress.finishFuncs().FirstErr,
 	}
 	return dynp, err
 }
 
-func (sp *stripeP) Procs(chunk *scat.Chunk) ([]procs.Proc, error) {
-	type chunkInfo struct {
-		chunk    *scat.Chunk
-		quotaUse uint64
+func addJournalEntries(j *journal.Journal, ress copiersRes,
+	adders []stores.LsEntryAdder,
+) error {
+	fns := make(concur.Funcs, len(ress))
+	for i := range ress {
+		lser := ress[i].(stores.Lister)
+		id := fmt.Sprint(ress[i].Id())
+		fns[i] = func() error {
+			entries, ok := j.Listed(id)
+			if !ok {
+				ls, err := lser.Ls()
+				if err != nil {
+					return err
+				}
+				entries = make([]journal.Entry, len(ls))
+				for i, e := range ls {
+					entries[i] = journal.Entry{Hash: e.Hash, Size: e.Size}
+				}
+				if err := j.AddListing(id, entries); err != nil {
+					return err
+				}
+			}
+			for _, a := range adders {
+				for _, e := range entries {
+					a.AddLsEntry(lser, stores.LsEntry{Hash: e.Hash, Size: e.Size})
+				}
+			}
+			return nil
+		}
 	}
+	return fns.FirstErr()
+}
+
+type chunkInfo struct {
+	chunk    *scat.Chunk
+	quotaUse uint64
+}
+
+func (sp *stripeP) Procs(chunk *scat.Chunk) ([]procs.Proc, error) {
 	group, ok := procs.GetGroup(chunk)
 	if !ok {
 		group = []*scat.Chunk{chunk}
@@ -84,14 +166,13 @@ func (sp *stripeP) Procs(chunk *scat.Chunk) ([]procs.Proc, error) {
 		}
 		curStripe[hash] = locs
 	}
-	all := copiersRes(sp.qman.Resources(quotaUse)).copiersById()
+	ress := copiersRes(sp.qman.Resources(quotaUse))
+	all := ress.copiersById()
 	dests := make(stripe.Locs, len(all))
 	for _, cp := range all {
 		dests.Add(cp.Id())
 	}
-	sp.seqMu.Lock()
-	newStripe, err := sp.cfg.Stripe(curStripe, dests, sp.seq)
-	sp.seqMu.Unlock()
+	newStripe, err := sp.stripe(curStripe, dests)
 	if err != nil {
 		return nil, err
 	}
@@ -99,6 +180,7 @@ func (sp *stripeP) Procs(chunk *scat.Chunk) ([]procs.Proc, error) {
 	for _, locs := range newStripe {
 		nprocs += len(locs)
 	}
+	sp.callHooks(chunks, curStripe, newStripe)
 	cpProcs := make([]procs.Proc, 1, nprocs+1)
 	{
 		proc := make(sliceProc, 0, len(chunks))
@@ -107,6 +189,7 @@ func (sp *stripeP) Procs(chunk *scat.Chunk) ([]procs.Proc, error) {
 		}
 		cpProcs[0] = proc
 	}
+	plan := newPlan(sp, curStripe, newStripe)
 	for item, locs := range newStripe {
 		hash := item.(checksum.Hash)
 		ci, ok := chunks[hash]
@@ -126,18 +209,22 @@ func (sp *stripeP) Procs(chunk *scat.Chunk) ([]procs.Proc, error) {
 			if !ok {
 				panic("unknown copier ID")
 			}
-			var proc procs.Proc = copier
-			proc = chunkArgProc{proc, ci.chunk}
-			proc = procs.DiscardChunks{proc}
-			proc = procs.OnEnd{proc, func(err error) {
-				defer wg.Done()
-				if err != nil {
-					sp.qman.Delete(copier)
-					return
-				}
-				copies.Add(copier)
-				sp.qman.AddUse(copier, ci.quotaUse)
-			}}
+			var proc procs.Proc = copyProc{
+				sp:     sp,
+				copier: copier,
+				chunk:  ci.chunk,
+				size:   ci.quotaUse,
+				plan:   plan,
+				onCopy: func(cp stores.Copier) {
+					if fn := sp.opts.OnCopy; fn != nil {
+						fn(cp.Id(), ci.quotaUse)
+					}
+					copies.Add(cp)
+					sp.qman.AddUse(cp, ci.quotaUse)
+					sp.addJournalCopy(cp, hash, ci.quotaUse)
+				},
+			}
+			proc = procs.OnEnd{proc, func(error) { wg.Done() }}
 			cProcs = append(cProcs, proc)
 		}
 		cpProcs = append(cpProcs, cProcs...)
@@ -145,6 +232,185 @@ func (sp *stripeP) Procs(chunk *scat.Chunk) ([]procs.Proc, error) {
 	return cpProcs, nil
 }
 
+func (sp *stripeP) callHooks(chunks map[checksum.Hash]chunkInfo,
+	cur, next stripe.S,
+) {
+	for hash, ci := range chunks {
+		if fn := sp.opts.OnPresent; fn != nil {
+			for id := range cur[hash] {
+				fn(id, ci.quotaUse)
+			}
+		}
+		if fn := sp.opts.OnDedup; fn != nil {
+			if len(next[hash]) == 0 && len(cur[hash]) > 0 {
+				fn(ci.quotaUse)
+			}
+		}
+	}
+}
+
+// Stripes s over dests in the order of the policy, if any.
+func (sp *stripeP) stripe(s stripe.S, dests stripe.Locs) (stripe.S, error) {
+	sp.seqMu.Lock()
+	defer sp.seqMu.Unlock()
+	seq := sp.seq
+	if p := sp.opts.Policy; p != nil {
+		seq = &stripe.RR{Items: p.Order(sp.ids)}
+	}
+	return sp.cfg.Stripe(s, dests, seq)
+}
+
+// Copies a chunk to a copier, moving on to other copiers planned in its
+// place on failure.
+type copyProc struct {
+	sp     *stripeP
+	copier stores.Copier
+	chunk  *scat.Chunk
+	size   uint64
+	plan   *plan
+	onCopy func(stores.Copier)
+}
+
+func (p copyProc) Process(c *scat.Chunk) <-chan procs.Res {
+	out := make(chan procs.Res)
+	go func() {
+		defer close(out)
+		var buf []procs.Res
+		cps := []stores.Copier{p.copier}
+		for len(cps) > 0 {
+			cp := cps[0]
+			cps = cps[1:]
+			var proc procs.Proc = chunkArgProc{cp, p.chunk}
+			proc = procs.DiscardChunks{proc}
+			start := time.Now()
+			res, err := readRes(proc.Process(c))
+			if err == nil {
+				p.sp.observe(cp, p.size, time.Since(start))
+				p.onCopy(cp)
+				buf = append(buf, res...)
+				continue
+			}
+			if evict(err) {
+				p.sp.qman.Delete(cp)
+			}
+			more, ok := p.plan.reroute(p.chunk.Hash(), cp.Id(), p.size)
+			if !ok {
+				buf = append(buf, res...)
+				break
+			}
+			cps = append(cps, more...)
+		}
+		for _, res := range buf {
+			out <- res
+		}
+	}()
+	return out
+}
+
+func (p copyProc) Finish() error {
+	return nil
+}
+
+func (sp *stripeP) observe(cp stores.Copier, size uint64, d time.Duration) {
+	if o, ok := sp.opts.Policy.(Observer); ok {
+		o.Observe(cp.Id(), size, d)
+	}
+}
+
+// Tells whether a copier failing with err should be evicted for the rest of
+// the run, rather than given further chunks.
+func evict(err error) bool {
+	switch stores.Kind(err) {
+	case stores.ErrPermanent, stores.ErrQuota:
+		return true
+	}
+	return false
+}
+
+func readRes(ch <-chan procs.Res) (buf []procs.Res, err error) {
+	for res := range ch {
+		buf = append(buf, res)
+		if res.Err != nil && err == nil {
+			err = res.Err
+		}
+	}
+	return
+}
+
+// Locations of the chunks of a group, stored or planned, shared by their
+// copyProcs to reroute failed copies without breaking requirements of the
+// striper: min, excl, domains.
+type plan struct {
+	sp     *stripeP
+	s      stripe.S
+	failed stripe.Locs
+	mu     sync.Mutex
+}
+
+func newPlan(sp *stripeP, cur, next stripe.S) *plan {
+	s := make(stripe.S, len(cur))
+	for it, locs := range cur {
+		all := make(stripe.Locs, len(locs)+len(next[it]))
+		for _, ls := range []stripe.Locs{locs, next[it]} {
+			for l := range ls {
+				all.Add(l)
+			}
+		}
+		s[it] = all
+	}
+	return &plan{sp: sp, s: s, failed: make(stripe.Locs)}
+}
+
+// Returns copiers to copy the chunk with the given hash and size to in place
+// of the failed one, striping again without copiers failed so far, or false
+// if there are none meeting requirements.
+func (p *plan) reroute(h checksum.Hash, failed interface{}, size uint64,
+) ([]stores.Copier, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.s[h], failed)
+	p.failed.Add(failed)
+	all := copiersRes(p.sp.qman.Resources(size)).copiersById()
+	dests := make(stripe.Locs, len(all))
+	for id := range all {
+		if _, ok := p.failed[id]; !ok {
+			dests.Add(id)
+		}
+	}
+	cur := make(stripe.S, len(p.s))
+	for it, locs := range p.s {
+		cur[it] = make(stripe.Locs, len(locs))
+		for l := range locs {
+			cur[it].Add(l)
+		}
+	}
+	next, err := p.sp.stripe(cur, dests)
+	if err != nil {
+		return nil, false
+	}
+	cps := make([]stores.Copier, 0, len(next[h]))
+	for id := range next[h] {
+		_, ok := dests[id]
+		if _, planned := p.s[h][id]; !ok || planned {
+			continue
+		}
+		p.s[h].Add(id)
+		cps = append(cps, all[id])
+	}
+	return cps, len(cps) > 0
+}
+
+func (sp *stripeP) addJournalCopy(cp stores.Copier, h checksum.Hash,
+	size uint64,
+) {
+	if sp.journal == nil {
+		return
+	}
+	e := journal.Entry{Hash: h, Size: int64(size)}
+	// losing the record only costs a redundant copy on resume
+	sp.journal.AddCopy(fmt.Sprint(cp.Id()), e)
+}
+
 func calcQuotaUse(d scat.Data) (uint64, error) {
 	sz, ok := d.(scat.Sizer)
 	if !ok {
@@ -3,12 +3,16 @@ package stripe_test
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"sort"
 	"testing"
 
 	assert "github.com/stretchr/testify/require"
 	"github.com/pbtrung/scat"
 	"github.com/pbtrung/scat/checksum"
+	"github.com/pbtrung/scat/journal"
 	"github.com/pbtrung/scat/procs"
 	"github.com/pbtrung/scat/stores"
 	"github.com/pbtrung/scat/stores/quota"
@@ -203,6 +207,133 @@ func TestStripeQuota(t *testing.T) {
 	assert.Equal(t, 3, int(uses["b"]))
 }
 
+func TestStripeHooks(t *testing.T) {
+	chunk1 := scat.NewChunk(0, make(scat.BytesData, 3))
+	chunk1.SetHash(checksum.SumBytes([]byte("chunk1")))
+	chunk2 := scat.NewChunk(1, make(scat.BytesData, 5))
+	chunk2.SetHash(checksum.SumBytes([]byte("chunk2")))
+	lister := stores.SliceLister{{Hash: chunk1.Hash(), Size: 3}}
+	qman := quota.NewMan()
+	qman.AddRes(stores.Copier{"a", lister, procs.Nop})
+
+	// chunk1 stored already, chunk2 copied
+	striper := &testStriper{s: stripe.S{chunk2.Hash(): testLocs("a")}}
+	dedup := uint64(0)
+	copied := map[interface{}]uint64{}
+	present := map[interface{}]uint64{}
+	sp, err := storestripe.NewWithOptions(striper, qman, storestripe.Options{
+		OnDedup:   func(size uint64) { dedup += size },
+		OnCopy:    func(id interface{}, size uint64) { copied[id] += size },
+		OnPresent: func(id interface{}, size uint64) { present[id] += size },
+	})
+	assert.NoError(t, err)
+	chunk := testutil.Group([]*scat.Chunk{chunk1, chunk2})
+	procs, err := sp.Procs(chunk)
+	assert.NoError(t, err)
+	_, err = processByAll(chunk, procs)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), dedup)
+	assert.Equal(t, map[interface{}]uint64{"a": 5}, copied)
+	assert.Equal(t, map[interface{}]uint64{"a": 3}, present)
+}
+
+// Records calls to a striper.
+type recStriper struct {
+	stripe.Striper
+	calls []striperCall
+}
+
+func (rs *recStriper) Stripe(s stripe.S, dests stripe.Locs, seq stripe.Seq) (
+	stripe.S, error,
+) {
+	rs.calls = append(rs.calls, striperCall{s, dests, seq})
+	return rs.Striper.Stripe(s, dests, seq)
+}
+
+// Orders copiers as listed.
+type fixedOrder []interface{}
+
+func (o fixedOrder) Order([]interface{}) []interface{} {
+	return o
+}
+
+func TestStripeReroute(t *testing.T) {
+	chunk1 := scat.NewChunk(0, nil)
+	chunk1.SetHash(checksum.SumBytes([]byte("hash1")))
+	striper := &recStriper{Striper: stripe.Config{Min: 1}}
+	tester := newStripeTester(func(qman *quota.Man) procs.DynProcer {
+		sp, err := storestripe.NewWithOptions(striper, qman, storestripe.Options{
+			Policy: fixedOrder(ids("a", "b")),
+		})
+		assert.NoError(t, err)
+		return sp
+	})
+	tester.setCopier("a")
+	tester.setCopier("b")
+	tester.reset()
+	dests := func() stripe.Locs {
+		striper.calls = nil
+		chunk := scat.NewChunk(0, nil)
+		chunk.SetHash(checksum.SumBytes([]byte("dests")))
+		procs, err := tester.sp.Procs(chunk)
+		assert.NoError(t, err)
+		processByAll(chunk, procs)
+		return striper.calls[0].dests
+	}
+
+	// transient: rerouted, kept
+	transient := stores.Error{stores.ErrTransient, errors.New("transient")}
+	tester.errs["a"] = transient
+	tester.test(t, chunk1, []string{"a", "b"})
+	assert.Equal(t, testLocs("a", "b"), dests())
+
+	// permanent: rerouted, evicted
+	tester.reset()
+	tester.errs["a"] = errors.New("permanent")
+	tester.test(t, chunk1, []string{"a", "b"})
+	assert.Equal(t, testLocs("b"), dests())
+
+	// no spare left
+	tester.reset()
+	tester.errs["a"] = transient
+	tester.errs["b"] = transient
+	err := tester.testE(t, chunk1, []string{"a", "b"})
+	assert.Equal(t, transient, err)
+}
+
+func TestStripeRerouteDomains(t *testing.T) {
+	chunk1 := scat.NewChunk(0, nil)
+	chunk1.SetHash(checksum.SumBytes([]byte("hash1")))
+	site := stripe.Domain{
+		Values: map[interface{}]string{"a": "x", "b": "y", "c": "x", "d": "y"},
+		Min:    2,
+	}
+	cfg := stripe.Config{Min: 2, Domains: []stripe.Domain{site}}
+	tester := newStripeTester(func(qman *quota.Man) procs.DynProcer {
+		sp, err := storestripe.NewWithOptions(cfg, qman, storestripe.Options{
+			Policy: fixedOrder(ids("a", "b", "c", "d")),
+		})
+		assert.NoError(t, err)
+		return sp
+	})
+	for _, id := range []string{"a", "b", "c", "d"} {
+		tester.setCopier(id)
+	}
+	transient := stores.Error{stores.ErrTransient, errors.New("transient")}
+
+	// rerouted to the other store of the failed one's site
+	tester.reset()
+	tester.errs["b"] = transient
+	tester.test(t, chunk1, []string{"a", "b", "d"})
+
+	// none left on the site
+	tester.reset()
+	tester.errs["b"] = transient
+	tester.errs["d"] = transient
+	err := tester.testE(t, chunk1, []string{"a", "b", "d"})
+	assert.Equal(t, transient, err)
+}
+
 func TestStripeGroupErr(t *testing.T) {
 	chunk1 := scat.NewChunk(0, nil)
 	chunk2 := scat.NewChunk(1, nil)
@@ -229,6 +360,63 @@ func TestStripeFinish(t *testing.T) {
 	})
 }
 
+func TestStripeJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	j, err := journal.Open(filepath.Join(dir, "journal"))
+	assert.NoError(t, err)
+	defer j.Close()
+
+	listed := checksum.SumBytes([]byte("listed"))
+	nls := 0
+	lser := testLister(func() ([]stores.LsEntry, error) {
+		nls++
+		return []stores.LsEntry{{Hash: listed, Size: 2}}, nil
+	})
+	chunk1 := scat.NewChunk(0, make(scat.BytesData, 3))
+	chunk1.SetHash(checksum.SumBytes([]byte("chunk1")))
+	striper := &testStriper{s: stripe.S{chunk1.Hash(): testLocs("a")}}
+	newQman := func() (*quota.Man, map[interface{}]uint64) {
+		qman := quota.NewMan()
+		qman.AddRes(stores.Copier{"a", lser, procs.Nop})
+		uses := map[interface{}]uint64{}
+		qman.OnUse = func(res quota.Res, use, _ uint64) {
+			uses[res.Id()] = use
+		}
+		return qman, uses
+	}
+
+	// listed and copied
+	qman, uses := newQman()
+	sp, err := storestripe.NewJournal(striper, qman, j)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, nls)
+	assert.Equal(t, 2, int(uses["a"]))
+	chunk := testutil.Group([]*scat.Chunk{chunk1})
+	procs, err := sp.Procs(chunk)
+	assert.NoError(t, err)
+	_, err = processByAll(chunk, procs)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, int(uses["a"]))
+
+	// resumed from the journal
+	qman, uses = newQman()
+	_, err = storestripe.NewJournal(striper, qman, j)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, nls)
+	assert.Equal(t, 5, int(uses["a"]))
+	entries, ok := j.Listed("a")
+	assert.True(t, ok)
+	assert.Equal(t, 2, len(entries))
+}
+
+type testLister func() ([]stores.LsEntry, error)
+
+func (fn testLister) Ls() ([]stores.LsEntry, error) {
+	return fn()
+}
+
 func processByAll(c *scat.Chunk, procs []procs.Proc) ([]*scat.Chunk, error) {
 	all := []*scat.Chunk{}
 	var err error
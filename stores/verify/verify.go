@@ -0,0 +1,179 @@
+package verify
+
+import (
+	"errors"
+	"io"
+
+	"github.com/pbtrung/scat"
+	"github.com/pbtrung/scat/checksum"
+	"github.com/pbtrung/scat/concur"
+	"github.com/pbtrung/scat/index"
+	"github.com/pbtrung/scat/procs"
+	"github.com/pbtrung/scat/stores"
+)
+
+var errNotSingleChunk = errors.New("expected a single output chunk")
+
+type Store struct {
+	Id interface{}
+	stores.Lister
+	Unproc procs.Proc
+}
+
+type Verifier struct {
+	Stores []Store
+
+	// Applied to downloaded data before checksum verification, to undo
+	// processing done after the final checksum of a backup (ex: gpg -e).
+	// Optional.
+	Unproc procs.Proc
+
+	// Only check listed entries for presence and non-zero size instead of
+	// downloading them.
+	LsOnly bool
+}
+
+type Report struct {
+	Id      interface{}
+	Ok      int
+	Corrupt int
+	Missing int
+}
+
+type Result struct {
+	Chunks int
+	Lost   int // listed by no store
+	Stores []Report
+}
+
+func ReadIndex(r io.Reader) (hashes []checksum.Hash, err error) {
+	seen := make(map[checksum.Hash]struct{})
+	it := index.NewScanner(0, r)
+	for it.Next() {
+		h := it.Chunk().Hash()
+		if _, ok := seen[h]; ok {
+			continue
+		}
+		seen[h] = struct{}{}
+		hashes = append(hashes, h)
+	}
+	err = it.Err()
+	return
+}
+
+func (v Verifier) Verify(hashes []checksum.Hash) (res Result, err error) {
+	res.Chunks = len(hashes)
+	res.Stores = make([]Report, len(v.Stores))
+	lss := make([]map[checksum.Hash]int64, len(v.Stores))
+	fns := make(concur.Funcs, len(v.Stores))
+	for i := range v.Stores {
+		i := i
+		fns[i] = func() (err error) {
+			lss[i], err = ls(v.Stores[i])
+			return
+		}
+	}
+	err = fns.FirstErr()
+	if err != nil {
+		return
+	}
+	for _, h := range hashes {
+		found := false
+		for _, ls := range lss {
+			if _, ok := ls[h]; ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			res.Lost++
+		}
+	}
+	for i := range v.Stores {
+		i := i
+		fns[i] = func() (err error) {
+			res.Stores[i], err = v.verifyStore(v.Stores[i], lss[i], hashes)
+			return
+		}
+	}
+	err = fns.FirstErr()
+	return
+}
+
+func ls(lser stores.Lister) (sizes map[checksum.Hash]int64, err error) {
+	entries, err := lser.Ls()
+	if err != nil {
+		return
+	}
+	sizes = make(map[checksum.Hash]int64, len(entries))
+	for _, e := range entries {
+		sizes[e.Hash] = e.Size
+	}
+	return
+}
+
+func (v Verifier) verifyStore(st Store, sizes map[checksum.Hash]int64,
+	hashes []checksum.Hash,
+) (rep Report, err error) {
+	rep.Id = st.Id
+	for _, h := range hashes {
+		size, ok := sizes[h]
+		if !ok {
+			continue
+		}
+		if v.LsOnly {
+			if size > 0 {
+				rep.Ok++
+			} else {
+				rep.Corrupt++
+			}
+			continue
+		}
+		c := scat.NewChunk(0, nil)
+		c.SetHash(h)
+		c, err = single(st.Unproc, c)
+		if _, ok := err.(procs.MissingDataError); ok {
+			rep.Missing++
+			err = nil
+			continue
+		}
+		if err != nil {
+			return
+		}
+		if v.check(c) {
+			rep.Ok++
+		} else {
+			rep.Corrupt++
+		}
+	}
+	err = st.Unproc.Finish()
+	return
+}
+
+func (v Verifier) check(c *scat.Chunk) bool {
+	hash := c.Hash()
+	if v.Unproc != nil {
+		var err error
+		c, err = single(v.Unproc, c)
+		if err != nil {
+			return false
+		}
+	}
+	sum, err := checksum.Sum(c.Data().Reader())
+	return err == nil && sum == hash
+}
+
+func single(proc procs.Proc, c *scat.Chunk) (out *scat.Chunk, err error) {
+	n := 0
+	for res := range proc.Process(c) {
+		if res.Err != nil && err == nil {
+			err = res.Err
+		}
+		out = res.Chunk
+		n++
+	}
+	if err == nil && n != 1 {
+		err = errNotSingleChunk
+	}
+	return
+}
@@ -0,0 +1,103 @@
+package verify_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pbtrung/scat"
+	"github.com/pbtrung/scat/checksum"
+	"github.com/pbtrung/scat/index"
+	"github.com/pbtrung/scat/procs"
+	"github.com/pbtrung/scat/stores"
+	"github.com/pbtrung/scat/stores/verify"
+	assert "github.com/stretchr/testify/require"
+)
+
+func sum(t *testing.T, b []byte) checksum.Hash {
+	h, err := checksum.Sum(bytes.NewReader(b))
+	assert.NoError(t, err)
+	return h
+}
+
+func TestReadIndex(t *testing.T) {
+	var (
+		h1 = checksum.SumBytes([]byte("a"))
+		h2 = checksum.SumBytes([]byte("b"))
+	)
+	buf := &bytes.Buffer{}
+	index.Write(buf, h1, 1)
+	index.Write(buf, h2, 1)
+	index.Write(buf, h1, 1)
+	hashes, err := verify.ReadIndex(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, []checksum.Hash{h1, h2}, hashes)
+}
+
+func TestVerify(t *testing.T) {
+	var (
+		ha   = sum(t, []byte("a"))
+		hb   = sum(t, []byte("b"))
+		lost = checksum.SumBytes([]byte("c"))
+	)
+	mem1, mem2 := stores.NewMem(), stores.NewMem()
+	mem1.Set(ha, []byte("a"))
+	mem1.Set(hb, []byte("b"))
+	mem2.Set(ha, []byte("x")) // corrupt
+	mem2.Set(hb, []byte{})    // empty
+	hashes := []checksum.Hash{ha, hb, lost}
+	newStores := func() []verify.Store {
+		return []verify.Store{
+			{"m1", mem1, mem1.Unproc()},
+			{"m2", mem2, mem2.Unproc()},
+		}
+	}
+
+	res, err := verify.Verifier{Stores: newStores()}.Verify(hashes)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, res.Chunks)
+	assert.Equal(t, 1, res.Lost)
+	assert.Equal(t, []verify.Report{
+		{Id: "m1", Ok: 2},
+		{Id: "m2", Corrupt: 2},
+	}, res.Stores)
+
+	// ls only
+	v := verify.Verifier{Stores: newStores(), LsOnly: true}
+	res, err = v.Verify(hashes)
+	assert.NoError(t, err)
+	assert.Equal(t, []verify.Report{
+		{Id: "m1", Ok: 2},
+		{Id: "m2", Ok: 1, Corrupt: 1},
+	}, res.Stores)
+}
+
+func TestVerifyMissing(t *testing.T) {
+	h := checksum.SumBytes([]byte("a"))
+	ls := stores.SliceLister{{Hash: h, Size: 1}}
+	mem := stores.NewMem()
+	v := verify.Verifier{Stores: []verify.Store{{"m", ls, mem.Unproc()}}}
+	res, err := v.Verify([]checksum.Hash{h})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, res.Lost)
+	assert.Equal(t, []verify.Report{{Id: "m", Missing: 1}}, res.Stores)
+}
+
+func TestVerifyUnproc(t *testing.T) {
+	h := sum(t, []byte("a"))
+	mem := stores.NewMem()
+	mem.Set(h, []byte("A"))
+	lower := procs.ChunkFunc(func(c *scat.Chunk) (*scat.Chunk, error) {
+		b, err := c.Data().Bytes()
+		return c.WithData(scat.BytesData(bytes.ToLower(b))), err
+	})
+	strs := []verify.Store{{"m", mem, mem.Unproc()}}
+
+	res, err := verify.Verifier{Stores: strs}.Verify([]checksum.Hash{h})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, res.Stores[0].Corrupt)
+
+	v := verify.Verifier{Stores: strs, Unproc: lower}
+	res, err = v.Verify([]checksum.Hash{h})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, res.Stores[0].Ok)
+}
@@ -0,0 +1,135 @@
+package stores_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pbtrung/scat"
+	"github.com/pbtrung/scat/checksum"
+	"github.com/pbtrung/scat/procs"
+	"github.com/pbtrung/scat/stores"
+	"github.com/pbtrung/scat/testutil"
+	assert "github.com/stretchr/testify/require"
+	"golang.org/x/net/webdav"
+)
+
+func newWebdavServer() *httptest.Server {
+	h := &webdav.Handler{
+		FileSystem: webdav.NewMemFS(),
+		LockSystem: webdav.NewMemLS(),
+	}
+	return httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			user, pass, ok := r.BasicAuth()
+			if !ok || user != "u" || pass != "p" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			h.ServeHTTP(w, r)
+		},
+	))
+}
+
+func TestWebdav(t *testing.T) {
+	srv := newWebdavServer()
+	defer srv.Close()
+
+	hash := testutil.Hash1.Hash
+	store, err := stores.NewWebdav(srv.URL+"/", stores.StrPart{2, 1})
+	assert.NoError(t, err)
+	store.User, store.Pass = "u", "p"
+
+	// empty
+	ls, err := store.Ls()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(ls))
+
+	// write
+	c := scat.NewChunk(0, scat.BytesData("abc"))
+	c.SetHash(hash)
+	chunks, err := testutil.ReadChunks(store.Proc().Process(c))
+	assert.NoError(t, err)
+	assert.Equal(t, []*scat.Chunk{c}, chunks)
+
+	// write: existing collections
+	hash2 := checksum.SumBytes([]byte("x"))
+	hash2[0], hash2[1] = hash[0], hash[1]
+	c = scat.NewChunk(0, scat.BytesData("de"))
+	c.SetHash(hash2)
+	_, err = testutil.ReadChunks(store.Proc().Process(c))
+	assert.NoError(t, err)
+
+	// read
+	c = scat.NewChunk(0, nil)
+	c.SetHash(hash)
+	chunks, err = testutil.ReadChunks(store.Unproc().Process(c))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(chunks))
+	b, err := chunks[0].Data().Bytes()
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", string(b))
+
+	// missing
+	c = scat.NewChunk(0, nil)
+	c.SetHash(testutil.Hashes[1].Hash)
+	_, err = testutil.ReadChunks(store.Unproc().Process(c))
+	assert.IsType(t, procs.MissingDataError{}, err)
+
+	// ls
+	ls, err = store.Ls()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(ls))
+	sizes := map[checksum.Hash]int64{}
+	for _, e := range ls {
+		sizes[e.Hash] = e.Size
+	}
+	assert.Equal(t, int64(3), sizes[hash])
+	assert.Equal(t, int64(2), sizes[hash2])
+
+	// delete
+	assert.NoError(t, store.Delete(hash))
+	assert.NoError(t, store.Delete(hash))
+	ls, err = store.Ls()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(ls))
+	assert.Equal(t, hash2, ls[0].Hash)
+
+	// path
+	hex := fmt.Sprintf("%x", hash)
+	res, err := http.Get(srv.URL + "/" + hex[:2] + "/" + hex[2:3] + "/" + hex)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+}
+
+func TestWebdavAuth(t *testing.T) {
+	srv := newWebdavServer()
+	defer srv.Close()
+	store, err := stores.NewWebdav(srv.URL, nil)
+	assert.NoError(t, err)
+	store.User, store.Pass = "u", "wrong"
+	c := scat.NewChunk(0, scat.BytesData("abc"))
+	_, err = testutil.ReadChunks(store.Proc().Process(c))
+	assert.Equal(t, http.StatusUnauthorized, err.(stores.WebdavError).StatusCode)
+}
+
+func TestWebdavURLAuth(t *testing.T) {
+	srv := newWebdavServer()
+	defer srv.Close()
+	os.Setenv("SCAT_WEBDAV_USER", "env")
+	defer os.Unsetenv("SCAT_WEBDAV_USER")
+	rawurl := strings.Replace(srv.URL, "://", "://u:p@", 1)
+	store, err := stores.NewWebdav(rawurl, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "u", store.User)
+	assert.Equal(t, "p", store.Pass)
+	assert.Nil(t, store.URL.User)
+	c := scat.NewChunk(0, scat.BytesData("abc"))
+	c.SetHash(checksum.SumBytes([]byte("abc")))
+	_, err = testutil.ReadChunks(store.Proc().Process(c))
+	assert.NoError(t, err)
+}
@@ -21,6 +21,19 @@ type Seq interface {
 var sortItems = func([]item) {}
 
 func (s S) Stripe(dests Locs, seq Seq, min, excl int) (S, error) {
+	return s.stripe(dests, seq, min, excl, nil)
+}
+
+// Domain requires copies of each item on locations of at least Min distinct
+// values of Values, ex: their provider or site, failing together. Locations
+// without a value share the empty one.
+type Domain struct {
+	Values map[interface{}]string
+	Min    int
+}
+
+func (s S) stripe(dests Locs, seq Seq, min, excl int, domains []Domain,
+) (S, error) {
 	items := make([]item, 0, len(s))
 	prios := make(map[loc]int)
 	for it, got := range s {
@@ -104,6 +117,18 @@ func (s S) Stripe(dests Locs, seq Seq, min, excl int) (S, error) {
 			}
 		}
 	}
+	nexcl := excl
+	if max := len(res); nexcl > max {
+		nexcl = max
+	}
+	for _, it := range items {
+		for i := range domains {
+			err := res.spread(it, s[it], dests, seq, nexcl, domains, i)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
 	for it, got := range s {
 		new := res[it]
 		for old := range got {
@@ -113,6 +138,96 @@ func (s S) Stripe(dests Locs, seq Seq, min, excl int) (S, error) {
 	return res, nil
 }
 
+// Spreads locations of it over domains[i].Min distinct values, taking dests
+// in seq order: swapping new locations sharing a value with others, or adding.
+// Swaps don't take other domains below their Min, so that spreading over one
+// doesn't undo another.
+func (res S) spread(it item, got, dests Locs, seq Seq, nexcl int,
+	domains []Domain, i int,
+) error {
+	locs := res[it]
+	d := domains[i]
+	keeps := func(l, cand loc) bool {
+		for j, e := range domains {
+			if j == i {
+				continue
+			}
+			before := len(e.counts(got, locs, dests))
+			delete(locs, l)
+			locs.Add(cand)
+			after := len(e.counts(got, locs, dests))
+			delete(locs, cand)
+			locs.Add(l)
+			if after < before && after < e.Min {
+				return false
+			}
+		}
+		return true
+	}
+	tried := make(Locs, len(dests))
+	for {
+		c := d.counts(got, locs, dests)
+		if len(c) >= d.Min {
+			return nil
+		}
+		cand := seq.Next()
+		if cand == nil {
+			return ErrShort
+		}
+		if _, ok := tried[cand]; ok {
+			return ErrShort
+		}
+		tried.Add(cand)
+		if _, ok := dests[cand]; !ok {
+			continue
+		}
+		if _, ok := got[cand]; ok {
+			continue
+		}
+		if c[d.Values[cand]] > 0 {
+			continue
+		}
+		var swapped loc
+		for l := range locs {
+			if _, old := got[l]; old || c[d.Values[l]] < 2 {
+				continue
+			}
+			if keeps(l, cand) {
+				swapped = l
+				break
+			}
+		}
+		if swapped != nil {
+			delete(locs, swapped)
+		}
+		locs.Add(cand)
+		if res.exclusives() < nexcl {
+			delete(locs, cand)
+			if swapped != nil {
+				locs.Add(swapped)
+			}
+		}
+	}
+}
+
+// counts copies per value among locs and old locations in dests: copies
+// elsewhere, as on failed stores, don't count.
+func (d Domain) counts(got, locs, dests Locs) map[string]int {
+	c := make(map[string]int, len(got)+len(locs))
+	for l := range locs {
+		c[d.Values[l]]++
+	}
+	for l := range got {
+		if _, ok := locs[l]; ok {
+			continue
+		}
+		if _, ok := dests[l]; ok {
+			c[d.Values[l]]++
+		}
+	}
+	return c
+}
+
 func (s S) exclusives() (count int) {
 	for a, aLocs := range s {
 		excl := true
@@ -147,10 +262,11 @@ type Striper interface {
 
 type Config struct {
 	Min, Excl int
+	Domains   []Domain
 }
 
 var _ Striper = Config{}
 
 func (cfg Config) Stripe(s S, dests Locs, seq Seq) (S, error) {
-	return s.Stripe(dests, seq, cfg.Min, cfg.Excl)
+	return s.stripe(dests, seq, cfg.Min, cfg.Excl, cfg.Domains)
 }
@@ -261,3 +261,81 @@ func test(t *testing.T, spec string) {
 	err := scan.Err()
 	assert.NoError(t, err)
 }
+
+func TestStripeDomains(t *testing.T) {
+	provider := Domain{
+		Values: map[interface{}]string{"a1": "x", "a2": "x", "b": "y"},
+		Min:    2,
+	}
+	dests := Locs{"a1": {}, "a2": {}, "b": {}}
+	rr := func() Seq {
+		return &RR{Items: []interface{}{"a1", "a2", "b"}}
+	}
+	values := func(locs Locs) (vals []string) {
+		for l := range locs {
+			vals = append(vals, provider.Values[l])
+		}
+		sort.Strings(vals)
+		return
+	}
+
+	// swapped: 2 copies on distinct values
+	cfg := Config{Min: 2, Domains: []Domain{provider}}
+	res, err := cfg.Stripe(S{"chunk1": Locs{}}, dests, rr())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"x", "y"}, values(res["chunk1"]))
+
+	// added: more copies than min
+	cfg.Min = 1
+	res, err = cfg.Stripe(S{"chunk1": Locs{}}, dests, rr())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"x", "y"}, values(res["chunk1"]))
+
+	// old copies count
+	res, err = cfg.Stripe(S{"chunk1": Locs{"b": {}}}, dests, rr())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"x"}, values(res["chunk1"]))
+	res, err = cfg.Stripe(S{"chunk1": Locs{"a2": {}, "b": {}}}, dests, rr())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(res["chunk1"]))
+
+	// not enough values
+	delete(dests, "b")
+	_, err = cfg.Stripe(S{"chunk1": Locs{}}, dests, rr())
+	assert.Equal(t, ErrShort, err)
+
+	// old copies off dests don't count
+	dests = Locs{"a1": {}, "a2": {}}
+	_, err = cfg.Stripe(S{"chunk1": Locs{"b": {}}}, dests, rr())
+	assert.Equal(t, ErrShort, err)
+}
+
+func TestStripeDomainsConflict(t *testing.T) {
+	provider := Domain{
+		Values: map[interface{}]string{"a": "x", "b": "x", "c": "y", "d": "y"},
+		Min:    2,
+	}
+	site := Domain{
+		Values: map[interface{}]string{"a": "s", "b": "t", "c": "s", "d": "t"},
+		Min:    2,
+	}
+	dests := Locs{"a": {}, "b": {}, "c": {}, "d": {}}
+	distinct := func(d Domain, locs Locs) int {
+		vals := make(map[string]struct{})
+		for l := range locs {
+			vals[d.Values[l]] = struct{}{}
+		}
+		return len(vals)
+	}
+	cfg := Config{Min: 2, Domains: []Domain{provider, site}}
+
+	// swaps for one domain must not undo the other, whatever the map order
+	for i := 0; i < 50; i++ {
+		seq := &RR{Items: []interface{}{"a", "b", "c", "d"}}
+		res, err := cfg.Stripe(S{"chunk1": Locs{}}, dests, seq)
+		assert.NoError(t, err)
+		locs := res["chunk1"]
+		assert.True(t, distinct(provider, locs) >= 2, "%v", locs)
+		assert.True(t, distinct(site, locs) >= 2, "%v", locs)
+	}
+}